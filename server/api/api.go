@@ -19,10 +19,12 @@ import (
 	"github.com/devusSs/crosshairs/api/routes"
 	"github.com/devusSs/crosshairs/config"
 	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/jobs"
 	"github.com/devusSs/crosshairs/logging"
 	"github.com/devusSs/crosshairs/stats"
 	"github.com/devusSs/crosshairs/storage"
 	"github.com/devusSs/crosshairs/updater"
+	"github.com/devusSs/crosshairs/webhooks"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/postgres"
 	ginzap "github.com/gin-contrib/zap"
@@ -190,7 +192,7 @@ func (api *API) SetupCors(cfg *config.Config) {
 	api.Engine.Use(c)
 }
 
-func (api *API) SetupRoutes(db database.Service, strSvc *storage.Service, cfg *config.Config, logsDir string, debug bool) error {
+func (api *API) SetupRoutes(db database.Service, strSvc *storage.Service, jobsSvc *jobs.Service, webhooksSvc *webhooks.Service, cfg *config.Config, logsDir string, debug bool) error {
 	logger := logging.InitZapAPILogger(logsDir, debug)
 
 	api.Engine.Use(ginzap.Ginzap(logger, time.RFC3339, true))
@@ -199,6 +201,16 @@ func (api *API) SetupRoutes(db database.Service, strSvc *storage.Service, cfg *c
 	routes.CFG = cfg
 	routes.Svc = db
 	routes.StorageSvc = strSvc
+	routes.Jobs = jobsSvc
+	routes.Webhooks = webhooksSvc
+
+	passkeys, err := routes.NewWebAuthn(cfg)
+	if err != nil {
+		return err
+	}
+	routes.WebAuthn = passkeys
+
+	routes.RegisterJobHandlers(jobsSvc)
 
 	if err := middleware.SetupPrivateIPBlock(); err != nil {
 		return err
@@ -211,7 +223,9 @@ func (api *API) SetupRoutes(db database.Service, strSvc *storage.Service, cfg *c
 
 	base := api.Engine.Group("/api")
 	{
+		base.Use(middleware.RequestIDMiddleware)
 		base.Use(middleware.CountRequestsMiddleware)
+		base.Use(middleware.LoadUserMiddleware)
 
 		base.GET("/", routes.HomeRoute)
 
@@ -220,7 +234,10 @@ func (api *API) SetupRoutes(db database.Service, strSvc *storage.Service, cfg *c
 			users.POST("/register", routes.RegisterUserRoute)
 			users.GET("/verifyMail", routes.VerifyUserEMailRoute)
 			users.POST("/login", routes.LoginUserRoute)
+			users.POST("/login/2fa", routes.VerifyLoginTwoFactorRoute)
 			users.GET("/me", routes.GetUserRoute)
+			users.GET("/me/export", routes.ExportAccountRoute)
+			users.DELETE("/me", routes.DeleteAccountRoute)
 			users.GET("/logout", routes.LogoutUserRoute)
 			users.POST("/resetPass", routes.ResetPasswordRoute)
 			users.GET("/resetPass", routes.VerifyUserPasswordCodeRoute)
@@ -229,34 +246,140 @@ func (api *API) SetupRoutes(db database.Service, strSvc *storage.Service, cfg *c
 
 			users.POST("/avatar", routes.UploadUserAvatarRoute)
 			users.DELETE("/avatar", routes.DeleteUserAvatarRoute)
+
+			users.PATCH("/displayName", routes.UpdateDisplayNameRoute)
+
+			users.GET("/2fa", routes.GetTwoFactorRoute)
+			users.POST("/2fa/enroll", routes.EnrollTwoFactorRoute)
+			users.POST("/2fa/activate", routes.ActivateTwoFactorRoute)
+			users.DELETE("/2fa", routes.DisableTwoFactorRoute)
+			users.POST("/2fa/recoveryCodes", routes.RegenerateRecoveryCodesRoute)
+
+			users.POST("/passkeys/register/begin", routes.BeginPasskeyRegistrationRoute)
+			users.POST("/passkeys/register/finish", routes.FinishPasskeyRegistrationRoute)
+			users.POST("/passkeys/login/begin", routes.BeginPasskeyLoginRoute)
+			users.POST("/passkeys/login/finish", routes.FinishPasskeyLoginRoute)
+			users.GET("/passkeys", routes.GetPasskeysRoute)
+			users.PATCH("/passkeys/:id", routes.RenamePasskeyRoute)
+			users.DELETE("/passkeys/:id", routes.DeletePasskeyRoute)
 		}
 
 		crosshairs := base.Group("/crosshairs")
 		{
 			crosshairs.POST("/add", routes.AddCrosshairRoute)
+			crosshairs.POST("/generate", routes.GenerateCrosshairRoute)
+			crosshairs.GET("/cfg", routes.ExportCrosshairConfigRoute)
+			crosshairs.POST("/cfg", routes.ImportCrosshairConfigRoute)
+			crosshairs.POST("/import", routes.ImportCrosshairsRoute)
+			crosshairs.GET("/export", routes.ExportCrosshairsRoute)
+			crosshairs.POST("/demo", routes.UploadDemoRoute)
+			crosshairs.POST("/demo/save", routes.SaveDemoCrosshairsRoute)
+			crosshairs.PATCH("/visibility", routes.UpdateCrosshairVisibilityRoute)
+			crosshairs.POST("/share", routes.ShareCrosshairRoute)
+			crosshairs.PATCH("/tags", routes.SetCrosshairTagsRoute)
+			crosshairs.POST("/copy", routes.CopyCrosshairRoute)
+			crosshairs.GET("/diff", routes.DiffCrosshairsRoute)
+			crosshairs.GET("/similar", routes.GetSimilarCrosshairsRoute)
+			crosshairs.GET("/favourites", routes.GetFavouritesRoute)
+			crosshairs.POST("/favourites", routes.AddFavouriteRoute)
+			crosshairs.DELETE("/favourites", routes.DeleteFavouriteRoute)
+			crosshairs.GET("/collections", routes.GetCollectionsRoute)
+			crosshairs.POST("/collections", routes.AddCollectionRoute)
+			crosshairs.GET("/collections/:id", routes.GetCollectionRoute)
+			crosshairs.PATCH("/collections/:id", routes.UpdateCollectionRoute)
+			crosshairs.DELETE("/collections/:id", routes.DeleteCollectionRoute)
+			crosshairs.GET("/collections/:id/cfg", routes.ExportCollectionConfigRoute)
+			crosshairs.PATCH("/:id", routes.UpdateCrosshairRoute)
+			crosshairs.GET("/:id/revisions", routes.GetCrosshairRevisionsRoute)
+			crosshairs.POST("/:id/revisions/:version/restore", routes.RestoreCrosshairRevisionRoute)
 			crosshairs.GET("", routes.GetAllCrosshairsFromUserRoute)
 			crosshairs.DELETE("", routes.DeleteOneOrMultipleCrosshairs)
 		}
 
+		base.GET("/jobs/:id", routes.GetJobRoute)
+		base.GET("/share/:slug", routes.GetSharedCrosshairRoute)
+		base.GET("/gallery", routes.GetGalleryRoute)
+		base.GET("/pros", routes.GetProPlayersRoute)
+
 		admins := base.Group("/admins")
 		{
-			admins.GET("/users", routes.GetAllUsersRoute)
-			admins.GET("/crosshairs", routes.GetAllCrosshairsRoute)
-			admins.GET("/logs", routes.GetAPILogsRoute)
+			// Registered first so every admin route is audited, including denied requests.
+			admins.Use(middleware.AuditMiddleware)
+
+			admins.GET("/users", middleware.RequirePermissionMiddleware(database.PermUsersRead), routes.GetAllUsersRoute)
+			admins.GET("/crosshairs", middleware.RequirePermissionMiddleware(database.PermCrosshairsRead), routes.GetAllCrosshairsRoute)
+			admins.GET("/logs", middleware.RequirePermissionMiddleware(database.PermLogsRead), routes.GetAPILogsRoute)
+
+			quotas := admins.Group("")
+			{
+				quotas.Use(middleware.RequirePermissionMiddleware(database.PermQuotasManage))
+				quotas.GET("/quotas", routes.GetRoleQuotasRoute)
+				quotas.PATCH("/quotas", routes.SetRoleQuotaRoute)
+				quotas.PATCH("/users/quota", routes.SetUserQuotaRoute)
+			}
+
+			moderation := admins.Group("")
+			{
+				moderation.Use(middleware.RequirePermissionMiddleware(database.PermUsersManage))
+				moderation.PATCH("/users/suspend", routes.SuspendUserRoute)
+				moderation.DELETE("/users/suspend", routes.UnsuspendUserRoute)
+				moderation.POST("/users/resetPass", routes.ForcePasswordResetRoute)
+				moderation.DELETE("/users", routes.DeleteUserRoute)
+				moderation.DELETE("/users/2fa", routes.ResetUserTwoFactorRoute)
+			}
+
+			roles := admins.Group("")
+			{
+				roles.Use(middleware.RequirePermissionMiddleware(database.PermRolesManage))
+				roles.GET("/roles", routes.GetRolesRoute)
+				roles.PATCH("/roles", routes.SaveRoleRoute)
+				roles.DELETE("/roles", routes.DeleteRoleRoute)
+				roles.PATCH("/roles/twoFactor", routes.SetRoleTwoFactorRoute)
+				roles.PATCH("/users/role", routes.SetUserRoleRoute)
+			}
+
+			pros := admins.Group("/pros")
+			{
+				pros.Use(middleware.RequirePermissionMiddleware(database.PermProsManage))
+				pros.POST("", routes.AddProPlayerRoute)
+				pros.GET("/:id", routes.GetProPlayerRoute)
+				pros.PATCH("/:id", routes.UpdateProPlayerRoute)
+				pros.DELETE("/:id", routes.DeleteProPlayerRoute)
+			}
+
+			audit := admins.Group("/audit")
+			{
+				audit.Use(middleware.RequirePermissionMiddleware(database.PermAuditRead))
+				audit.GET("", routes.GetAuditLogsRoute)
+				audit.GET("/export", routes.ExportAuditLogsRoute)
+			}
+
+			webhooks := admins.Group("/webhooks")
+			{
+				webhooks.Use(middleware.RequirePermissionMiddleware(database.PermWebhooksManage))
+				webhooks.GET("", routes.GetWebhooksRoute)
+				webhooks.POST("", routes.AddWebhookRoute)
+				webhooks.PATCH("/:id", routes.UpdateWebhookRoute)
+				webhooks.DELETE("/:id", routes.DeleteWebhookRoute)
+				webhooks.POST("/:id/test", routes.TestWebhookRoute)
+				webhooks.GET("/:id/deliveries", routes.GetWebhookDeliveriesRoute)
+			}
 
 			events := admins.Group("/events")
 			{
-				events.GET("", routes.GetAllEventsOrByTypeRoute)
+				events.Use(middleware.RequirePermissionMiddleware(database.PermEventsRead))
+				events.GET("", routes.GetEventsRoute)
 			}
 
 			stats := admins.Group("/stats")
 			{
-				stats.GET("/total", routes.GetTotalStatsRoute)
-				stats.GET("/daily", routes.Get24HourStatsRoute)
+				stats.GET("/total", middleware.RequirePermissionMiddleware(database.PermStatsRead), routes.GetTotalStatsRoute)
+				stats.GET("/daily", middleware.RequirePermissionMiddleware(database.PermStatsRead), routes.Get24HourStatsRoute)
 
 				// Route is only accessable for engineers / users with ACTUAL database access.
 				system := stats.Group("/system")
 				{
+					system.Use(middleware.RequirePermissionMiddleware(database.PermStatsSystem))
 					system.Use(middleware.CheckAllowedHostMiddleware)
 					system.Use(middleware.VerifyEngineerMiddleware)
 					system.GET("", routes.GetSystemStatsRoute)
@@ -2,6 +2,9 @@ package integration
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,6 +13,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/devusSs/crosshairs/api"
@@ -18,6 +22,7 @@ import (
 	"github.com/devusSs/crosshairs/config"
 	"github.com/devusSs/crosshairs/database"
 	"github.com/devusSs/crosshairs/logging"
+	"github.com/devusSs/crosshairs/utils"
 	"github.com/gempir/go-twitch-irc/v4"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -29,6 +34,25 @@ import (
 const (
 	twitchUsersEndpoint = "https://api.twitch.tv/helix/users"
 	twitchTokenEndpoint = "https://id.twitch.tv/oauth2/token"
+
+	oauthStateSize = 32
+	// Time to authorize the app on Twitch.
+	oauthStateTimeout = 10 * time.Minute
+)
+
+// What the callback does with the Twitch account.
+const (
+	// Connects it to the logged in user.
+	oauthActionLink = "link"
+	// Logs in its user, signs them up if needed.
+	oauthActionSignIn = "sign_in"
+)
+
+// Session keys of the OAuth flow, every flow has its own state.
+const (
+	sessionOAuthState  = "twitch_oauth_state"
+	sessionOAuthAction = "twitch_oauth_action"
+	sessionOAuthSince  = "twitch_oauth_since"
 )
 
 var (
@@ -36,28 +60,39 @@ var (
 	clientSecret = ""
 	redirectURL  = ""
 	oauthConfig  *oauth2.Config
-	state        string
 
 	dbService   database.Service
 	botUsername string
 
-	userBotMap map[string]*twitch.Client
+	// Bot clients by channel, only used through botClient, setBotClient and removeBotClient
+	// since HTTP handlers and background jobs access them at the same time.
+	userBotMap   map[string]*twitch.Client
+	userBotMutex sync.Mutex
 )
 
 type twitchUsersData struct {
-	Data []struct {
-		ID              string    `json:"id"`
-		Login           string    `json:"login"`
-		DisplayName     string    `json:"display_name"`
-		Type            string    `json:"type"`
-		BroadcasterType string    `json:"broadcaster_type"`
-		Description     string    `json:"description"`
-		ProfileImageURL string    `json:"profile_image_url"`
-		OfflineImageURL string    `json:"offline_image_url"`
-		ViewCount       int       `json:"view_count"`
-		Email           string    `json:"email"`
-		CreatedAt       time.Time `json:"created_at"`
-	} `json:"data"`
+	Data []twitchUser `json:"data"`
+}
+
+type twitchUser struct {
+	ID              string    `json:"id"`
+	Login           string    `json:"login"`
+	DisplayName     string    `json:"display_name"`
+	Type            string    `json:"type"`
+	BroadcasterType string    `json:"broadcaster_type"`
+	Description     string    `json:"description"`
+	ProfileImageURL string    `json:"profile_image_url"`
+	OfflineImageURL string    `json:"offline_image_url"`
+	ViewCount       int       `json:"view_count"`
+	Email           string    `json:"email"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// The Twitch account and tokens the callback got.
+type twitchGrant struct {
+	user                 *twitchUser
+	token                *oauth2.Token
+	refreshTokenAcquired time.Time
 }
 
 type twitchTokenData struct {
@@ -89,7 +124,9 @@ func InitTwitchAuth(cfg *config.Config, api *api.API, hostURL string, svc databa
 	}
 
 	// Init the map which logs users to Twitch client instances
+	userBotMutex.Lock()
 	userBotMap = make(map[string]*twitch.Client)
+	userBotMutex.Unlock()
 
 	clientID = cfg.TwitchClientID
 	clientSecret = cfg.TwitchClientSecret
@@ -106,10 +143,13 @@ func InitTwitchAuth(cfg *config.Config, api *api.API, hostURL string, svc databa
 	dbService = svc
 	botUsername = cfg.TwitchBotUsername
 
+	routes.DisconnectTwitchBot = disconnectBot
+
 	hostURL = strings.Replace(hostURL, "127.0.0.1", "localhost", 1)
 	redirectURLHost := strings.Split(cfg.TwitchRedirectURL, hostURL)[1]
 
 	api.Engine.GET("/api/integration/twitch/login", handleLogin)
+	api.Engine.GET("/api/integration/twitch/signin", handleSignIn)
 	api.Engine.GET(redirectURLHost, handleCallback)
 	api.Engine.GET("/api/integration/twitch/disconnect", disconnectTwitchRoute)
 
@@ -161,14 +201,124 @@ func handleLogin(c *gin.Context) {
 		return
 	}
 
-	state = fmt.Sprintf("%d", time.Now().UnixNano())
+	redirectToTwitch(c, oauthActionLink)
+}
+
+// Logs in with Twitch, users who are not registered yet are signed up.
+func handleSignIn(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "You are already logged in."
+		resp.SendErrorResponse(c)
+		c.Abort()
+		return
+	}
+
+	redirectToTwitch(c, oauthActionSignIn)
+}
+
+// Stores a new state in the session and redirects to Twitch, the callback only accepts that state once.
+func redirectToTwitch(c *gin.Context, action string) {
+	stateBytes := make([]byte, oauthStateSize)
+	if _, err := rand.Read(stateBytes); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Could not generate state."
+		resp.SendErrorResponse(c)
+		c.Abort()
+		return
+	}
+	state := hex.EncodeToString(stateBytes)
+
+	session := sessions.Default(c)
+	session.Set(sessionOAuthState, state)
+	session.Set(sessionOAuthAction, action)
+	session.Set(sessionOAuthSince, time.Now().Unix())
+	if err := session.Save(); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Could not set session cookie."
+		resp.SendErrorResponse(c)
+		c.Abort()
+		return
+	}
+
 	url := oauthConfig.AuthCodeURL(state)
 	c.Redirect(http.StatusTemporaryRedirect, url)
 }
 
+// Removes the state from the session and returns its action, false if the state does not match or timed out.
+func takeOAuthState(session sessions.Session, queryState string) (string, bool) {
+	state, _ := session.Get(sessionOAuthState).(string)
+	action, _ := session.Get(sessionOAuthAction).(string)
+	since, _ := session.Get(sessionOAuthSince).(int64)
+
+	session.Delete(sessionOAuthState)
+	session.Delete(sessionOAuthAction)
+	session.Delete(sessionOAuthSince)
+	_ = session.Save()
+
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(queryState)) != 1 {
+		return "", false
+	}
+
+	if time.Since(time.Unix(since, 0)) > oauthStateTimeout {
+		return "", false
+	}
+
+	return action, true
+}
+
 func handleCallback(c *gin.Context) {
 	session := sessions.Default(c)
 
+	action, ok := takeOAuthState(session, c.Query("state"))
+	if !ok {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_state"
+		resp.Error.ErrorMessage = "Returned state did not match provided state."
+		resp.SendErrorResponse(c)
+		c.Abort()
+		return
+	}
+
+	code := c.Query("code")
+	token, err := oauthConfig.Exchange(context.Background(), code)
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_token_exchange"
+		resp.Error.ErrorMessage = err.Error()
+		resp.SendErrorResponse(c)
+		c.Abort()
+		return
+	}
+
+	refreshTokenAcquiry := time.Now()
+
+	twitchUser, ok := fetchTwitchUser(c, token)
+	if !ok {
+		return
+	}
+
+	grant := &twitchGrant{
+		user:                 twitchUser,
+		token:                token,
+		refreshTokenAcquired: refreshTokenAcquiry,
+	}
+
+	if action == oauthActionSignIn {
+		signInWithTwitch(c, grant)
+		return
+	}
+
 	if session.Get("user") == nil {
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusUnauthorized
@@ -190,31 +340,252 @@ func handleCallback(c *gin.Context) {
 		return
 	}
 
-	queryState := c.Query("state")
-	if queryState != state {
+	linked, err := dbService.GetUserByTwitchID(&database.UserAccount{TwitchID: twitchUser.ID})
+	if err != nil && !database.IsNotFoundError(err) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Something went wrong, sorry."
+		resp.SendErrorResponse(c)
+		c.Abort()
+		return
+	}
+
+	if err == nil && linked.ID != uuidUser {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusConflict
+		resp.Error.ErrorCode = "conflict"
+		resp.Error.ErrorMessage = "This Twitch account is connected to another account already."
+		resp.SendErrorResponse(c)
+		c.Abort()
+		return
+	}
+
+	if !connectTwitch(c, uuidUser, grant) {
+		return
+	}
+
+	respSucc := responses.SuccessResponse{}
+	respSucc.Code = http.StatusOK
+	respSucc.Data = gin.H{
+		"message":            "Successfully connected your Twitch account.",
+		"available_commands": "!latestCH ; !statusCH",
+	}
+	respSucc.SendSuccessReponse(c)
+}
+
+// Logs in the user the Twitch account is connected to.
+//
+// Unknown Twitch accounts are connected to the user with the same e-mail address or signed up if there is none.
+func signInWithTwitch(c *gin.Context, grant *twitchGrant) {
+	user, err := dbService.GetUserByTwitchID(&database.UserAccount{TwitchID: grant.user.ID})
+	if err == nil {
+		if !routes.CheckLoginAllowed(c, user) {
+			return
+		}
+
+		routes.LoginVerifiedUser(c, user, database.LoginMethodTwitch)
+		return
+	}
+
+	if !database.IsNotFoundError(err) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Something went wrong, sorry."
+		resp.SendErrorResponse(c)
+		c.Abort()
+		return
+	}
+
+	if grant.user.Email == "" {
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusBadRequest
-		resp.Error.ErrorCode = "invalid_state"
-		resp.Error.ErrorMessage = "Returned state did not match provided state."
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Your Twitch account has no verified e-mail address, please register with your e-mail address instead."
 		resp.SendErrorResponse(c)
 		c.Abort()
 		return
 	}
 
-	code := c.Query("code")
-	token, err := oauthConfig.Exchange(context.Background(), code)
-	if err != nil {
+	user, err = dbService.GetUserByEmail(&database.UserAccount{EMail: grant.user.Email})
+	if err == nil {
+		mergeTwitchAccount(c, user, grant)
+		return
+	}
+
+	if !database.IsNotFoundError(err) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Something went wrong, sorry."
+		resp.SendErrorResponse(c)
+		c.Abort()
+		return
+	}
+
+	signUpWithTwitch(c, grant)
+}
+
+// Connects the Twitch account to the existing user with its e-mail address and logs them in.
+//
+// Twitch only hands out verified e-mail addresses, the owner of the Twitch account owns the e-mail address.
+func mergeTwitchAccount(c *gin.Context, user *database.UserAccount, grant *twitchGrant) {
+	if user.TwitchID != "" {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusConflict
+		resp.Error.ErrorCode = "conflict"
+		resp.Error.ErrorMessage = "Your account is connected to another Twitch account, please log in with your e-mail address."
+		resp.SendErrorResponse(c)
+		c.Abort()
+		return
+	}
+
+	// The Twitch account must not replace the second factor.
+	if user.TwoFactorEnabled {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusConflict
+		resp.Error.ErrorCode = "conflict"
+		resp.Error.ErrorMessage = "An account with your e-mail address exists already, please log in with your e-mail address and connect Twitch from your account."
+		resp.SendErrorResponse(c)
+		c.Abort()
+		return
+	}
+
+	if !routes.CheckLoginAllowed(c, user) {
+		return
+	}
+
+	// Whoever registered the unverified account may not own the e-mail address, their password is replaced.
+	if !user.VerifiedMail {
+		password, ok := unusablePassword(c)
+		if !ok {
+			return
+		}
+
+		if err := dbService.ClaimUnverifiedUser(user.ID, password); err != nil {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusInternalServerError
+			resp.Error.ErrorCode = "internal_error"
+			resp.Error.ErrorMessage = "Something went wrong, sorry."
+			resp.SendErrorResponse(c)
+			c.Abort()
+			return
+		}
+
+		user.VerifiedMail = true
+		user.Password = password
+		user.PasswordUnknown = true
+	}
+
+	if !connectTwitch(c, user.ID, grant) {
+		return
+	}
+
+	routes.LoginVerifiedUser(c, user, database.LoginMethodTwitch)
+}
+
+// Registers a new user with the e-mail address of the Twitch account and logs them in.
+//
+// The user has no password they know, it can be set with the password reset.
+func signUpWithTwitch(c *gin.Context, grant *twitchGrant) {
+	password, ok := unusablePassword(c)
+	if !ok {
+		return
+	}
+
+	newUser := database.UserAccount{
+		EMail:            grant.user.Email,
+		Password:         password,
+		Role:             "user",
+		VerificationCode: utils.RandomString(25),
+		VerifiedMail:     true,
+		PasswordUnknown:  true,
+	}
+
+	if routes.UsingReverseProxy {
+		newUser.RegisterIP = c.Request.Header.Get("X-Forwarded-For")
+	} else {
+		newUser.RegisterIP = c.RemoteIP()
+	}
+
+	if _, err := dbService.AddUser(&newUser); err != nil {
+		errString := database.CheckDatabaseError(err)
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusBadRequest
-		resp.Error.ErrorCode = "invalid_token_exchange"
-		resp.Error.ErrorMessage = err.Error()
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = errString
 		resp.SendErrorResponse(c)
 		c.Abort()
 		return
 	}
 
-	refreshTokenAcquiry := time.Now()
+	if err := routes.RecordEvent(c, database.NewEvent(database.UserRegistered, &newUser.ID, nil)); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Something went wrong, sorry."
+		resp.SendErrorResponse(c)
+		c.Abort()
+		return
+	}
+
+	if !connectTwitch(c, newUser.ID, grant) {
+		return
+	}
+
+	routes.LoginVerifiedUser(c, &newUser, database.LoginMethodTwitch)
+}
+
+// Stores the Twitch details and tokens of the user and lets the bot join their channel.
+func connectTwitch(c *gin.Context, userID uuid.UUID, grant *twitchGrant) bool {
+	_, err := dbService.AddUserTwitchDetails(&database.UserAccount{ID: userID, TwitchID: grant.user.ID, TwitchLogin: grant.user.Login, TwitchCreatedAt: grant.user.CreatedAt})
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_sorry"
+		resp.Error.ErrorMessage = "Something went wrong, sorry."
+		resp.SendErrorResponse(c)
+		c.Abort()
+		return false
+	}
+
+	// Add token details to database.
+	_, err = dbService.AddTwitchTokenRefreshStore(&database.TwitchRefreshTokenStore{
+		TwitchID:             grant.user.ID,
+		TwitchLogin:          grant.user.Login,
+		RefreshToken:         grant.token.RefreshToken,
+		RefreshTokenAcquired: grant.refreshTokenAcquired,
+		AccessToken:          grant.token.AccessToken,
+		AccessTokenExpiry:    grant.token.Expiry,
+	})
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Something went wrong, sorry."
+		resp.SendErrorResponse(c)
+		c.Abort()
+		return false
+	}
+
+	if err := routes.RecordEvent(c, database.NewEvent(database.TwitchConnected, &userID, database.TwitchPayload{TwitchID: grant.user.ID, TwitchLogin: grant.user.Login})); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Something went wrong, sorry."
+		resp.SendErrorResponse(c)
+		c.Abort()
+		return false
+	}
+
+	go createBotAndJoinChannel(grant.token, grant.user.Login)
 
+	return true
+}
+
+// Gets the user the token belongs to from the Twitch API, sends an error response if that fails.
+func fetchTwitchUser(c *gin.Context, token *oauth2.Token) (*twitchUser, bool) {
 	client := oauthConfig.Client(context.Background(), token)
 
 	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, twitchUsersEndpoint, nil)
@@ -225,7 +596,7 @@ func handleCallback(c *gin.Context) {
 		resp.Error.ErrorMessage = "Something went wrong, sorry."
 		resp.SendErrorResponse(c)
 		c.Abort()
-		return
+		return nil, false
 	}
 
 	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token.AccessToken))
@@ -239,7 +610,7 @@ func handleCallback(c *gin.Context) {
 		resp.Error.ErrorMessage = "Something went wrong, sorry."
 		resp.SendErrorResponse(c)
 		c.Abort()
-		return
+		return nil, false
 	}
 	defer resp.Body.Close()
 
@@ -250,7 +621,7 @@ func handleCallback(c *gin.Context) {
 		respErr.Error.ErrorMessage = resp.Status
 		respErr.SendErrorResponse(c)
 		c.Abort()
-		return
+		return nil, false
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -261,64 +632,49 @@ func handleCallback(c *gin.Context) {
 		resp.Error.ErrorMessage = "Something went wrong, sorry."
 		resp.SendErrorResponse(c)
 		c.Abort()
-		return
+		return nil, false
 	}
 
 	var data twitchUsersData
 
-	if err := json.Unmarshal(body, &data); err != nil {
+	if err := json.Unmarshal(body, &data); err != nil || len(data.Data) == 0 || data.Data[0].ID == "" {
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusInternalServerError
 		resp.Error.ErrorCode = "internal_sorry"
 		resp.Error.ErrorMessage = "Something went wrong, sorry."
 		resp.SendErrorResponse(c)
 		c.Abort()
-		return
+		return nil, false
 	}
 
-	userID := data.Data[0].ID
-	userLogin := data.Data[0].Login
-	userCreatedAt := data.Data[0].CreatedAt
+	return &data.Data[0], true
+}
 
-	_, err = routes.Svc.AddUserTwitchDetails(&database.UserAccount{ID: uuidUser, TwitchID: userID, TwitchLogin: userLogin, TwitchCreatedAt: userCreatedAt})
-	if err != nil {
+// Returns the hash of a random password nobody knows, users set their own one with the password reset.
+func unusablePassword(c *gin.Context) (string, bool) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusInternalServerError
-		resp.Error.ErrorCode = "internal_sorry"
-		resp.Error.ErrorMessage = "Something went wrong, sorry."
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Could not generate password."
 		resp.SendErrorResponse(c)
 		c.Abort()
-		return
+		return "", false
 	}
 
-	// Add token details to database.
-	_, err = dbService.AddTwitchTokenRefreshStore(&database.TwitchRefreshTokenStore{
-		TwitchID:             userID,
-		TwitchLogin:          userLogin,
-		RefreshToken:         token.RefreshToken,
-		RefreshTokenAcquired: refreshTokenAcquiry,
-		AccessToken:          token.AccessToken,
-		AccessTokenExpiry:    token.Expiry,
-	})
+	hashed, err := utils.HashPassword(hex.EncodeToString(random))
 	if err != nil {
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusInternalServerError
 		resp.Error.ErrorCode = "internal_error"
-		resp.Error.ErrorMessage = "Something went wrong, sorry."
+		resp.Error.ErrorMessage = "Could not hash password."
 		resp.SendErrorResponse(c)
 		c.Abort()
-		return
+		return "", false
 	}
 
-	go createBotAndJoinChannel(token, userLogin)
-
-	respSucc := responses.SuccessResponse{}
-	respSucc.Code = http.StatusOK
-	respSucc.Data = gin.H{
-		"message":            "Successfully connected your Twitch account.",
-		"available_commands": "!latestCH ; !statusCH",
-	}
-	respSucc.SendSuccessReponse(c)
+	return hashed, true
 }
 
 func createBotAndJoinChannel(token *oauth2.Token, channel string) {
@@ -353,7 +709,7 @@ func createBotAndJoinChannel(token *oauth2.Token, channel string) {
 		log.Printf("%s Error saving Twitchbot log data: %s\n", logging.ErrSign, err.Error())
 	}
 
-	userBotMap[channel] = client
+	setBotClient(channel, client)
 
 	if err := client.Connect(); err != nil {
 		log.Printf("%s Error connecting to Twitch channel of \"%s\": %s\n", logging.ErrSign, channel, err.Error())
@@ -373,9 +729,18 @@ func handleCrosshairCommand(client *twitch.Client, channel, user string) {
 		return
 	}
 
+	if len(crosshairs) == 0 {
+		client.Say(user, fmt.Sprintf("@%s -> No crosshairs saved yet.", user))
+		return
+	}
+
 	latestCrosshair := crosshairs[0]
 
-	client.Say(user, fmt.Sprintf("@%s -> Latest crosshair on database: %s", user, latestCrosshair.Code))
+	if latestCrosshair.PreviewURL != "" {
+		client.Say(user, fmt.Sprintf("@%s -> Latest crosshair on database: %s (preview: %s)", user, latestCrosshair.Code, latestCrosshair.PreviewURL))
+	} else {
+		client.Say(user, fmt.Sprintf("@%s -> Latest crosshair on database: %s", user, latestCrosshair.Code))
+	}
 
 	logMessage, err := database.MarshalTwitchBotLogMessage(gin.H{
 		"user":    user,
@@ -461,7 +826,7 @@ func disconnectTwitchRoute(c *gin.Context) {
 		return
 	}
 
-	client, ok := userBotMap[user.TwitchLogin]
+	client, ok := botClient(user.TwitchLogin)
 	if !ok {
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusInternalServerError
@@ -471,7 +836,7 @@ func disconnectTwitchRoute(c *gin.Context) {
 		return
 	}
 
-	if client == nil {
+	if err := client.Disconnect(); err != nil {
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusInternalServerError
 		resp.Error.ErrorCode = "internal_error"
@@ -480,7 +845,8 @@ func disconnectTwitchRoute(c *gin.Context) {
 		return
 	}
 
-	if err := client.Disconnect(); err != nil {
+	_, err = dbService.AddUserTwitchDetails(&database.UserAccount{ID: user.ID, TwitchID: "", TwitchLogin: "", TwitchCreatedAt: time.Time{}})
+	if err != nil {
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusInternalServerError
 		resp.Error.ErrorCode = "internal_error"
@@ -489,8 +855,9 @@ func disconnectTwitchRoute(c *gin.Context) {
 		return
 	}
 
-	_, err = dbService.AddUserTwitchDetails(&database.UserAccount{TwitchID: "", TwitchLogin: "", TwitchCreatedAt: time.Time{}})
-	if err != nil {
+	removeBotClient(user.TwitchLogin)
+
+	if err := routes.RecordEvent(c, database.NewEvent(database.TwitchDisconnected, &user.ID, database.TwitchPayload{TwitchID: user.TwitchID, TwitchLogin: user.TwitchLogin})); err != nil {
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusInternalServerError
 		resp.Error.ErrorCode = "internal_error"
@@ -499,8 +866,6 @@ func disconnectTwitchRoute(c *gin.Context) {
 		return
 	}
 
-	userBotMap[user.TwitchLogin] = nil
-
 	resp := responses.SuccessResponse{}
 	resp.Code = http.StatusOK
 	resp.Data = gin.H{
@@ -510,6 +875,45 @@ func disconnectTwitchRoute(c *gin.Context) {
 	resp.SendSuccessReponse(c)
 }
 
+// Disconnects the bot from the channel, used when the account of the channel is deleted.
+//
+// The hourly account purge calls it outside of any request, the client map is only touched through its lock.
+func disconnectBot(channel string) {
+	client := removeBotClient(channel)
+	if client == nil {
+		return
+	}
+
+	if err := client.Disconnect(); err != nil {
+		log.Printf("%s Error disconnecting from Twitch channel of \"%s\": %s\n", logging.ErrSign, channel, err.Error())
+	}
+}
+
+func botClient(channel string) (*twitch.Client, bool) {
+	userBotMutex.Lock()
+	defer userBotMutex.Unlock()
+
+	client, ok := userBotMap[channel]
+	return client, ok
+}
+
+func setBotClient(channel string, client *twitch.Client) {
+	userBotMutex.Lock()
+	defer userBotMutex.Unlock()
+
+	userBotMap[channel] = client
+}
+
+// Removes the client of the channel and returns it, nil if the bot did not join the channel.
+func removeBotClient(channel string) *twitch.Client {
+	userBotMutex.Lock()
+	defer userBotMutex.Unlock()
+
+	client := userBotMap[channel]
+	delete(userBotMap, channel)
+	return client
+}
+
 func initialiseTwitchUsers() error {
 	users, err := dbService.GetAllUsers()
 	if err != nil {
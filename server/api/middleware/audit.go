@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/logging"
+	"github.com/gin-gonic/gin"
+)
+
+const contextAuditKey = "audit_details"
+
+// Describes what a privileged request did, set by handlers via SetAudit.
+type AuditDetails struct {
+	// e.g. user.suspend, defaults to method and route.
+	Action     string
+	TargetType string
+	TargetID   string
+	// Marshalled to JSON, nil if there was no target before or after the action.
+	Before interface{}
+	After  interface{}
+}
+
+// Adds details to the audit log entry of the request.
+func SetAudit(c *gin.Context, details *AuditDetails) {
+	c.Set(contextAuditKey, details)
+}
+
+// Writes an audit log entry for every request of a logged in user once it has been handled.
+//
+// Requests denied by RequirePermissionMiddleware are written as well, with their status code.
+func AuditMiddleware(c *gin.Context) {
+	c.Next()
+
+	user, ok := CurrentUser(c)
+	if !ok {
+		return
+	}
+
+	entry := &database.AuditLog{
+		RequestID: RequestID(c),
+		ActorID:   user.ID,
+		ActorIP:   c.ClientIP(),
+		Method:    c.Request.Method,
+		Route:     c.FullPath(),
+		URL:       c.Request.RequestURI,
+		Status:    c.Writer.Status(),
+		Action:    fmt.Sprintf("%s %s", c.Request.Method, c.FullPath()),
+	}
+
+	if value, ok := c.Get(contextAuditKey); ok {
+		if details, ok := value.(*AuditDetails); ok {
+			if details.Action != "" {
+				entry.Action = details.Action
+			}
+			entry.TargetType = details.TargetType
+			entry.TargetID = details.TargetID
+			entry.Before = auditJSON(details.Before)
+			entry.After = auditJSON(details.After)
+		}
+	}
+
+	// The response has been sent already, failing to write the entry can only be logged.
+	if err := Svc.AddAuditLog(entry); err != nil {
+		logging.WriteError(fmt.Sprintf("could not write audit log for request %s: %s", entry.RequestID, err.Error()))
+	}
+}
+
+func auditJSON(value interface{}) json.RawMessage {
+	if value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	return data
+}
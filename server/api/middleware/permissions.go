@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	contextUserKey = "session_user"
+	contextRoleKey = "session_role"
+)
+
+// Loads the user of the session once per request, handlers and later middlewares get it via CurrentUser.
+//
+// Requests without a session are passed on as they are, sessions of users which do not exist
+// anymore, have to reset their password or deleted their account are removed. Sessions of
+// suspended users are removed and the request is rejected.
+func LoadUserMiddleware(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		c.Next()
+		return
+	}
+
+	uuidUser, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		c.Next()
+		return
+	}
+
+	user, err := Svc.GetUserByUID(&database.UserAccount{ID: uuidUser})
+	if err != nil {
+		if database.IsNotFoundError(err) {
+			session.Clear()
+			_ = session.Save()
+			c.Next()
+			return
+		}
+
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = database.CheckDatabaseError(err)
+		c.AbortWithStatusJSON(resp.Code, resp)
+		return
+	}
+
+	if user.IsSuspended() {
+		session.Clear()
+		_ = session.Save()
+
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusForbidden
+		resp.Error.ErrorCode = "forbidden"
+		resp.Error.ErrorMessage = SuspensionMessage(user)
+		c.AbortWithStatusJSON(resp.Code, resp)
+		return
+	}
+
+	if user.PasswordResetRequired || user.DeletionScheduledAt != nil {
+		session.Clear()
+		_ = session.Save()
+		c.Next()
+		return
+	}
+
+	c.Set(contextUserKey, user)
+	c.Next()
+}
+
+// Tells a suspended user why and for how long they are suspended.
+func SuspensionMessage(user *database.UserAccount) string {
+	if user.SuspendedUntil == nil {
+		return fmt.Sprintf("Your account has been banned: %s", user.SuspensionReason)
+	}
+	return fmt.Sprintf("Your account has been suspended until %s: %s", user.SuspendedUntil.UTC().Format(time.RFC3339), user.SuspensionReason)
+}
+
+// Returns the user loaded by LoadUserMiddleware, false if the request has no (valid) session.
+func CurrentUser(c *gin.Context) (*database.UserAccount, bool) {
+	value, ok := c.Get(contextUserKey)
+	if !ok {
+		return nil, false
+	}
+	user, ok := value.(*database.UserAccount)
+	return user, ok
+}
+
+// Returns a middleware which only lets users pass whose role has all of the permissions.
+//
+// Users whose role requires two-factor authentication are rejected until they enabled it.
+// Needs LoadUserMiddleware to run before.
+func RequirePermissionMiddleware(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := CurrentUser(c)
+		if !ok {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusUnauthorized
+			resp.Error.ErrorCode = "unauthorized"
+			resp.Error.ErrorMessage = "You are currently not logged in."
+			c.AbortWithStatusJSON(resp.Code, resp)
+			return
+		}
+
+		role, err := userRole(c, user)
+		if err != nil {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusInternalServerError
+			resp.Error.ErrorCode = "internal_error"
+			resp.Error.ErrorMessage = database.CheckDatabaseError(err)
+			c.AbortWithStatusJSON(resp.Code, resp)
+			return
+		}
+
+		if role.RequireTwoFactor && !user.TwoFactorEnabled {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusForbidden
+			resp.Error.ErrorCode = "two_factor_required"
+			resp.Error.ErrorMessage = "Your role requires two-factor authentication, please enable it first."
+			c.AbortWithStatusJSON(resp.Code, resp)
+			return
+		}
+
+		for _, perm := range permissions {
+			if !hasPermission(role, perm) {
+				resp := responses.ErrorResponse{}
+				resp.Code = http.StatusForbidden
+				resp.Error.ErrorCode = "forbidden"
+				resp.Error.ErrorMessage = fmt.Sprintf("Missing permission %s.", perm)
+				c.AbortWithStatusJSON(resp.Code, resp)
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// The role is fetched once per request, nested groups may require further permissions.
+//
+// Users of a role which does not exist anymore get an empty role without permissions.
+func userRole(c *gin.Context, user *database.UserAccount) (*database.Role, error) {
+	if value, ok := c.Get(contextRoleKey); ok {
+		if role, ok := value.(*database.Role); ok {
+			return role, nil
+		}
+	}
+
+	role, err := Svc.GetRole(user.Role)
+	if err != nil {
+		if !database.IsNotFoundError(err) {
+			return nil, err
+		}
+		role = &database.Role{Name: user.Role}
+	}
+
+	c.Set(contextRoleKey, role)
+
+	return role, nil
+}
+
+func hasPermission(role *database.Role, name string) bool {
+	for _, perm := range role.Permissions {
+		if perm.Name == name {
+			return true
+		}
+	}
+	return false
+}
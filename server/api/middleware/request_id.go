@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeader     = "X-Request-ID"
+	contextRequestIDKey = "request_id"
+)
+
+// IDs passed by a reverse proxy are kept if they look sane.
+var requestIDRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Gives every request an ID which is sent back in the X-Request-ID header and written to the audit log.
+func RequestIDMiddleware(c *gin.Context) {
+	requestID := c.GetHeader(requestIDHeader)
+	if !requestIDRegex.MatchString(requestID) {
+		requestID = uuid.NewString()
+	}
+
+	c.Set(contextRequestIDKey, requestID)
+	c.Header(requestIDHeader, requestID)
+	c.Next()
+}
+
+// Returns the ID set by RequestIDMiddleware.
+func RequestID(c *gin.Context) string {
+	return c.GetString(contextRequestIDKey)
+}
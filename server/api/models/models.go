@@ -1,8 +1,10 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
+	"github.com/devusSs/crosshairs/sharecode"
 	"github.com/google/uuid"
 )
 
@@ -22,6 +24,59 @@ type AddCrosshair struct {
 	Note string `json:"note"`
 }
 
+type GenerateCrosshair struct {
+	Settings sharecode.Settings `json:"settings"`
+	Save     bool               `json:"save"`
+	Note     string             `json:"note"`
+}
+
+type ImportCrosshairConfig struct {
+	Config string `json:"config"`
+	Note   string `json:"note"`
+}
+
+type SaveCrosshairs struct {
+	Crosshairs []AddCrosshair `json:"crosshairs"`
+}
+
+type UpdateCrosshairVisibility struct {
+	Code       string `json:"code"`
+	Visibility string `json:"visibility"`
+}
+
+type SetCrosshairTags struct {
+	Code string   `json:"code"`
+	Tags []string `json:"tags"`
+}
+
+// Only the fields which are set are updated.
+type UpdateCrosshair struct {
+	Code *string   `json:"code"`
+	Note *string   `json:"note"`
+	Tags *[]string `json:"tags"`
+}
+
+// Either the id (e.g. from the gallery) or the slug of a shared crosshair.
+type FavouriteCrosshair struct {
+	ID   string `json:"id"`
+	Slug string `json:"slug"`
+}
+
+type CopyCrosshair struct {
+	ID   string `json:"id"`
+	Slug string `json:"slug"`
+	// Defaults to the note of the copied crosshair.
+	Note string `json:"note"`
+}
+
+type ShareCrosshair struct {
+	Code string `json:"code"`
+}
+
+type UpdateDisplayName struct {
+	DisplayName string `json:"display_name"`
+}
+
 type ResetPassword struct {
 	EMail string `json:"e_mail"`
 }
@@ -30,12 +85,76 @@ type ResetPasswordFinal struct {
 	Password string `json:"password"`
 }
 
+// Permissions replace all permissions of the role.
+type SaveRole struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type SetUserRole struct {
+	EMail string `json:"e_mail"`
+	Role  string `json:"role"`
+}
+
+type SetRoleTwoFactor struct {
+	Role     string `json:"role"`
+	Required bool   `json:"required"`
+}
+
+type SuspendUser struct {
+	Reason string `json:"reason"`
+	// Bans the user if not set.
+	Until *time.Time `json:"until"`
+}
+
+type SetRoleQuota struct {
+	Role          string `json:"role"`
+	MaxCrosshairs int    `json:"max_crosshairs"`
+}
+
+// A nil MaxCrosshairs removes the override, the user then gets the quota of their role again.
+type SetUserQuota struct {
+	EMail         string `json:"e_mail"`
+	MaxCrosshairs *int   `json:"max_crosshairs"`
+}
+
+// The current password confirms the deletion.
+type DeleteAccount struct {
+	Password string `json:"password"`
+}
+
+// Enabled defaults to true.
+type AddWebhook struct {
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	EventTypes  []string `json:"event_types"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+// Only the fields which are set are updated, RotateSecret generates a new secret.
+type UpdateWebhook struct {
+	URL          *string  `json:"url"`
+	Description  *string  `json:"description"`
+	EventTypes   []string `json:"event_types"`
+	Enabled      *bool    `json:"enabled"`
+	RotateSecret bool     `json:"rotate_secret"`
+}
+
 // Response models
 type ReturnUser struct {
 	CreatedAt          time.Time `json:"created_at"`
 	EMail              string    `json:"e_mail"`
+	DisplayName        string    `json:"display_name"`
 	Role               string    `json:"role"`
 	ProfilePictureLink string    `json:"profile_picture_link"`
+	// Quota and remaining are nil for users without a limit.
+	CrosshairsRegistered int  `json:"crosshairs_registered"`
+	CrosshairsQuota      *int `json:"crosshairs_quota"`
+	CrosshairsRemaining  *int `json:"crosshairs_remaining"`
+	TwoFactorEnabled     bool `json:"two_factor_enabled"`
+	// False for accounts created with Twitch until the user set a password with the password reset.
+	HasPassword bool `json:"has_password"`
 }
 
 type ReturnUserAvatar struct {
@@ -54,18 +173,215 @@ type ReturnUserAdmin struct {
 	LoginIP              string    `json:"login_ip"`
 	LastLogin            time.Time `json:"last_login"`
 	CrosshairsRegistered int       `json:"crosshairs_registered"`
+	CrosshairQuota       *int      `json:"crosshair_quota"`
 	AvatarURL            string    `json:"avatar_url"`
+
+	Suspended             bool       `json:"suspended"`
+	SuspendedUntil        *time.Time `json:"suspended_until"`
+	SuspensionReason      string     `json:"suspension_reason"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	TwoFactorEnabled      bool       `json:"two_factor_enabled"`
 }
 
 type MultipleUsersAdmin struct {
 	Users []ReturnUserAdmin `json:"users"`
 }
 
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	Builtin     bool     `json:"builtin"`
+	// Users of the role need two-factor authentication for permission protected routes.
+	RequireTwoFactor bool      `json:"require_two_factor"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type Roles struct {
+	Roles []Role `json:"roles"`
+	// Every permission which can be granted to a role.
+	Permissions []Permission `json:"permissions"`
+}
+
+type RoleQuota struct {
+	Role          string    `json:"role"`
+	MaxCrosshairs int       `json:"max_crosshairs"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type RoleQuotas struct {
+	Quotas []RoleQuota `json:"quotas"`
+}
+
 type Crosshair struct {
-	ID    uuid.UUID `json:"id"`
-	Added time.Time `json:"added"`
-	Code  string    `json:"code"`
-	Note  string    `json:"note"`
+	ID         uuid.UUID          `json:"id"`
+	Added      time.Time          `json:"added"`
+	Code       string             `json:"code"`
+	Note       string             `json:"note"`
+	Settings   sharecode.Settings `json:"settings"`
+	PreviewURL string             `json:"preview_url"`
+	Visibility string             `json:"visibility"`
+	Slug       string             `json:"slug,omitempty"`
+	Tags       []string           `json:"tags"`
+	// Only set on crosshairs copied from another user.
+	SourceCrosshairID *uuid.UUID `json:"source_crosshair_id,omitempty"`
+	OriginalAuthor    string     `json:"original_author,omitempty"`
+}
+
+// Crosshair as shown to everyone with the share link, does not expose any account details.
+type SharedCrosshair struct {
+	Code       string             `json:"code"`
+	Note       string             `json:"note"`
+	Settings   sharecode.Settings `json:"settings"`
+	PreviewURL string             `json:"preview_url"`
+	Tags       []string           `json:"tags"`
+	SaveCount  int                `json:"save_count"`
+	Owner      string             `json:"owner"`
+}
+
+type GalleryCrosshair struct {
+	ID         uuid.UUID          `json:"id"`
+	Added      time.Time          `json:"added"`
+	Code       string             `json:"code"`
+	Note       string             `json:"note"`
+	Settings   sharecode.Settings `json:"settings"`
+	PreviewURL string             `json:"preview_url"`
+	Tags       []string           `json:"tags"`
+	SaveCount  int                `json:"save_count"`
+	Owner      string             `json:"owner"`
+}
+
+type GalleryPage struct {
+	Crosshairs []GalleryCrosshair `json:"crosshairs"`
+	// Empty on the last page.
+	NextCursor string `json:"next_cursor"`
+}
+
+type CrosshairRevision struct {
+	Version  int                `json:"version"`
+	Created  time.Time          `json:"created"`
+	Code     string             `json:"code"`
+	Note     string             `json:"note"`
+	Settings sharecode.Settings `json:"settings"`
+	Tags     []string           `json:"tags"`
+}
+
+type CrosshairRevisions struct {
+	Revisions []CrosshairRevision `json:"revisions"`
+}
+
+type SettingDifference struct {
+	Field string      `json:"field"`
+	A     interface{} `json:"a"`
+	B     interface{} `json:"b"`
+}
+
+type CrosshairDiff struct {
+	A          string              `json:"a"`
+	B          string              `json:"b"`
+	Identical  bool                `json:"identical"`
+	Similarity float64             `json:"similarity"`
+	Changes    []SettingDifference `json:"changes"`
+}
+
+// Public crosshair of a user or crosshair of a pro player similar to a given one.
+type SimilarCrosshair struct {
+	// Either public or pro.
+	Source string `json:"source"`
+	// Only set on public crosshairs.
+	ID         *uuid.UUID         `json:"id,omitempty"`
+	Code       string             `json:"code"`
+	Note       string             `json:"note"`
+	Settings   sharecode.Settings `json:"settings"`
+	PreviewURL string             `json:"preview_url"`
+	// Display name of the owner or name of the pro player.
+	Owner      string  `json:"owner"`
+	Team       string  `json:"team,omitempty"`
+	Similarity float64 `json:"similarity"`
+}
+
+type SimilarCrosshairs struct {
+	Crosshairs []SimilarCrosshair `json:"crosshairs"`
+}
+
+type CopiedCrosshair struct {
+	Crosshair   Crosshair `json:"crosshair"`
+	CHsOnRecord int       `json:"chs_on_record"`
+}
+
+type FavouriteCrosshairs struct {
+	Crosshairs []GalleryCrosshair `json:"crosshairs"`
+}
+
+type SaveCollection struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Ids of the user's crosshairs in the order they should be in.
+	Crosshairs []uuid.UUID `json:"crosshairs"`
+}
+
+// Only set fields are updated, crosshairs replaces all crosshairs of the collection.
+type UpdateCollection struct {
+	Name        *string      `json:"name"`
+	Description *string      `json:"description"`
+	Crosshairs  *[]uuid.UUID `json:"crosshairs"`
+}
+
+type Collection struct {
+	ID          uuid.UUID   `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Crosshairs  []Crosshair `json:"crosshairs"`
+}
+
+type Collections struct {
+	Collections []Collection `json:"collections"`
+}
+
+type CollectionConfig struct {
+	ID     uuid.UUID `json:"id"`
+	Name   string    `json:"name"`
+	Key    string    `json:"key"`
+	Config string    `json:"config"`
+}
+
+type SaveProPlayer struct {
+	Name   string `json:"name"`
+	Team   string `json:"team"`
+	Source string `json:"source"`
+	// Defaults to now if not set.
+	LastVerified *time.Time     `json:"last_verified"`
+	Crosshairs   []AddCrosshair `json:"crosshairs"`
+}
+
+type ProCrosshair struct {
+	Code       string             `json:"code"`
+	Note       string             `json:"note"`
+	Settings   sharecode.Settings `json:"settings"`
+	PreviewURL string             `json:"preview_url"`
+}
+
+type ProPlayer struct {
+	ID           uuid.UUID      `json:"id"`
+	Name         string         `json:"name"`
+	Team         string         `json:"team"`
+	Source       string         `json:"source"`
+	LastVerified time.Time      `json:"last_verified"`
+	Crosshairs   []ProCrosshair `json:"crosshairs"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+}
+
+type MultipleProPlayers struct {
+	Players []ProPlayer `json:"players"`
 }
 
 type GetMultipleCrosshairs struct {
@@ -80,3 +396,207 @@ type RequestPWResetLoggedIn struct {
 	CurrentPassword string `json:"current_password"`
 	NewPassword     string `json:"new_password"`
 }
+
+type DemoCrosshair struct {
+	Code     string             `json:"code"`
+	Settings sharecode.Settings `json:"settings"`
+}
+
+type DemoPlayer struct {
+	Name string `json:"name"`
+	// Sent as string since JavaScript can not represent 64 bit integers.
+	SteamID64 string `json:"steam_id_64"`
+	IsBot     bool   `json:"is_bot"`
+	// Nil if the player had no crosshair code in the demo, e.g. bots.
+	Crosshair *DemoCrosshair `json:"crosshair"`
+}
+
+type DemoInfo struct {
+	Map          string  `json:"map"`
+	Server       string  `json:"server"`
+	Client       string  `json:"client"`
+	PlaybackTime float64 `json:"playback_time"`
+	Ticks        int     `json:"ticks"`
+}
+
+type DemoCrosshairs struct {
+	Demo    DemoInfo     `json:"demo"`
+	Players []DemoPlayer `json:"players"`
+}
+
+type Job struct {
+	ID       uuid.UUID `json:"id"`
+	Type     string    `json:"type"`
+	Status   string    `json:"status"`
+	Attempts int       `json:"attempts"`
+	// Set once the job succeeded, structure depends on the job type.
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type AuditLog struct {
+	ID         uuid.UUID       `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	RequestID  string          `json:"request_id"`
+	ActorID    uuid.UUID       `json:"actor_id"`
+	ActorIP    string          `json:"actor_ip"`
+	Method     string          `json:"method"`
+	Route      string          `json:"route"`
+	URL        string          `json:"url"`
+	Status     int             `json:"status"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+}
+
+type AuditLogPage struct {
+	Entries []AuditLog `json:"entries"`
+	// Empty on the last page.
+	NextCursor string `json:"next_cursor"`
+}
+
+type Event struct {
+	ID        uuid.UUID       `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Type      string          `json:"type"`
+	Severity  string          `json:"severity"`
+	UserID    *uuid.UUID      `json:"user_id"`
+	Data      EventData       `json:"data"`
+	Payload   json.RawMessage `json:"payload"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+type EventData struct {
+	URL      string `json:"url"`
+	Method   string `json:"method"`
+	IssuerIP string `json:"issuer"`
+}
+
+type EventPage struct {
+	Events []Event `json:"events"`
+	// Empty on the last page.
+	NextCursor string `json:"next_cursor"`
+}
+
+type Webhook struct {
+	ID          uuid.UUID `json:"id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	EventTypes  []string  `json:"event_types"`
+	Enabled     bool      `json:"enabled"`
+	// Only set when the webhook is created or the secret is rotated.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedBy uuid.UUID `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type MultipleWebhooks struct {
+	Webhooks []Webhook `json:"webhooks"`
+	// Every event type webhooks can subscribe to.
+	EventTypes []string `json:"event_types"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	WebhookID      uuid.UUID       `json:"webhook_id"`
+	EventID        *uuid.UUID      `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	ResponseStatus int             `json:"response_status"`
+	ResponseBody   string          `json:"response_body"`
+	Error          string          `json:"error"`
+	DurationMS     int64           `json:"duration_ms"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+type WebhookDeliveryPage struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	// Empty on the last page.
+	NextCursor string `json:"next_cursor"`
+}
+
+// Everything stored about a user account, part of the data export.
+type ExportedAccount struct {
+	ID              uuid.UUID `json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	EMail           string    `json:"e_mail"`
+	VerifiedMail    bool      `json:"verified_mail"`
+	DisplayName     string    `json:"display_name"`
+	Role            string    `json:"role"`
+	AvatarURL       string    `json:"avatar_url"`
+	RegisterIP      string    `json:"register_ip"`
+	LoginIP         string    `json:"login_ip"`
+	LastLogin       time.Time `json:"last_login"`
+	TwitchID        string    `json:"twitch_id"`
+	TwitchLogin     string    `json:"twitch_login"`
+	TwitchCreatedAt time.Time `json:"twitch_created_at"`
+
+	CrosshairsRegistered int  `json:"crosshairs_registered"`
+	CrosshairQuota       *int `json:"crosshair_quota"`
+
+	SuspendedAt           *time.Time `json:"suspended_at"`
+	SuspendedUntil        *time.Time `json:"suspended_until"`
+	SuspensionReason      string     `json:"suspension_reason"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	TwoFactorEnabled      bool       `json:"two_factor_enabled"`
+}
+
+// A TOTP code of the authenticator app or a recovery code.
+type TwoFactorCode struct {
+	Code string `json:"code"`
+}
+
+type DisableTwoFactor struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type TwoFactorStatus struct {
+	Enabled bool `json:"enabled"`
+	// Set if the role of the user requires two-factor authentication.
+	Required          bool  `json:"required"`
+	RecoveryCodesLeft int64 `json:"recovery_codes_left"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	// otpauth:// URI to show as QR code.
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// Only shown once, they are stored hashed.
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type BeginPasskeyRegistration struct {
+	// Shown in the list of passkeys, e.g. the device or password manager.
+	Name string `json:"name"`
+}
+
+type RenamePasskey struct {
+	Name string `json:"name"`
+}
+
+type Passkey struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Transports []string   `json:"transports"`
+	// Synced passkeys are stored by a password manager and available on all devices of the user.
+	Synced bool `json:"synced"`
+	// Set if the passkey may have been copied, it can not be used to log in anymore.
+	CloneWarning bool `json:"clone_warning"`
+}
@@ -4,3 +4,42 @@ type CrosshairResponse struct {
 	Status      string `json:"status"`
 	CHsOnRecord int    `json:"chs_on_record"`
 }
+
+type GenerateCrosshairResponse struct {
+	Code        string   `json:"code"`
+	Commands    []string `json:"commands"`
+	Saved       bool     `json:"saved"`
+	CHsOnRecord int      `json:"chs_on_record,omitempty"`
+}
+
+type CrosshairConfigResponse struct {
+	Code   string `json:"code"`
+	Note   string `json:"note"`
+	Config string `json:"config"`
+}
+
+type SaveCrosshairsResponse struct {
+	Results     []SavedCrosshair `json:"results"`
+	CHsOnRecord int              `json:"chs_on_record"`
+}
+
+type SavedCrosshair struct {
+	// Only set for bulk imports.
+	Line  int    `json:"line,omitempty"`
+	Code  string `json:"code"`
+	Saved bool   `json:"saved"`
+	Error string `json:"error,omitempty"`
+}
+
+type ImportCrosshairsResponse struct {
+	Imported    int              `json:"imported"`
+	Failed      int              `json:"failed"`
+	Results     []SavedCrosshair `json:"results"`
+	CHsOnRecord int              `json:"chs_on_record"`
+}
+
+type ShareCrosshairResponse struct {
+	Slug       string `json:"slug"`
+	Visibility string `json:"visibility"`
+	Link       string `json:"link"`
+}
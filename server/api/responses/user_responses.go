@@ -6,6 +6,10 @@ package responses
 type LoginUserResponse struct {
 	Message string `json:"message"`
 	Role    string `json:"role"`
+	// Set if the login has to be completed with a two-factor code.
+	TwoFactorRequired bool `json:"two_factor_required"`
+	// Set if the role of the user requires two-factor authentication which is not enabled yet.
+	TwoFactorSetupRequired bool `json:"two_factor_setup_required"`
 }
 
 // This struct serves any route except Login, Logout, GetUser.
@@ -0,0 +1,376 @@
+package routes
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/devusSs/crosshairs/api/middleware"
+	"github.com/devusSs/crosshairs/api/models"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/logging"
+	"github.com/devusSs/crosshairs/storage"
+	"github.com/devusSs/crosshairs/utils"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// Time users have to change their mind after deleting their account.
+	accountDeletionGracePeriod = 7 * 24 * time.Hour
+	// Accounts without a known password confirm their deletion by logging in with Twitch within this time.
+	accountDeletionReauthWindow = 10 * time.Minute
+
+	// Page size used while collecting the events of the export.
+	exportEventsPageSize = 500
+)
+
+// Session keys of the login of the session.
+const (
+	sessionLoginMethod = "login_method"
+	sessionLoginAt     = "login_at"
+)
+
+// Everything stored about a user, written to the export as one file per field.
+type accountExport struct {
+	account     models.ExportedAccount
+	crosshairs  []models.Crosshair
+	collections []models.Collection
+	events      []models.Event
+	passkeys    []models.Passkey
+	botLogs     []*database.TwitchBotLog
+	// Nil if the user did not upload an avatar.
+	avatar []byte
+}
+
+// Downloads everything stored about the logged in user as ZIP file.
+//
+// It holds the account, crosshairs, collections, events, passkeys, Twitch bot logs as JSON files and the avatar.
+func ExportAccountRoute(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	// Everything is collected before writing so errors can still be sent as JSON.
+	export, err := collectAccountExport(user)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !addEvent(c, database.NewEvent(database.UserExportedData, &user.ID, nil)) {
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=crosshairs-export-%s.zip", time.Now().UTC().Format("20060102-150405")))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	if err := writeAccountExport(c.Writer, export); err != nil {
+		// Headers have been sent already, the download ends early.
+		logging.WriteError(fmt.Sprintf("could not write data export of user %s: %s", user.ID, err.Error()))
+	}
+}
+
+// Schedules the deletion of the logged in user's account and logs them out everywhere.
+//
+// The account is purged once the grace period is over, logging in again before cancels the deletion.
+func DeleteAccountRoute(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var deleteAccount models.DeleteAccount
+
+	if err := c.BindJSON(&deleteAccount); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	session := sessions.Default(c)
+
+	// Users who signed up with Twitch never got to know their password, a fresh Twitch login confirms it is them.
+	if user.PasswordUnknown {
+		if !recentLogin(session, database.LoginMethodTwitch, accountDeletionReauthWindow) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusForbidden
+			resp.Error.ErrorCode = "reauthentication_required"
+			resp.Error.ErrorMessage = "Your account has no password. Log in with Twitch again and delete your account within 10 minutes, or set a password with the password reset first."
+			resp.SendErrorResponse(c)
+			return
+		}
+	} else if err := utils.VerifyPassword(user.Password, deleteAccount.Password); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "Passwords do not match."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	scheduledAt := time.Now().Add(accountDeletionGracePeriod)
+
+	if err := Svc.ScheduleUserDeletion(user.ID, &scheduledAt); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !addEvent(c, database.NewEvent(database.UserDeletionRequested, &user.ID, database.DeletionPayload{ScheduledAt: scheduledAt})) {
+		return
+	}
+
+	// Other sessions are removed by the middleware on their next request.
+	session.Clear()
+	session.Options(sessions.Options{Path: "/", MaxAge: -1})
+	if err := session.Save(); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Could not remove session."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: responses.GeneralUserResponse{
+			Message: fmt.Sprintf("Your account will be deleted on %s, log in again before to cancel the deletion.", scheduledAt.UTC().Format(time.RFC3339)),
+		},
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Reports whether the session logged in with the method within the window.
+func recentLogin(session sessions.Session, method string, window time.Duration) bool {
+	loginMethod, _ := session.Get(sessionLoginMethod).(string)
+	loginAt, ok := session.Get(sessionLoginAt).(int64)
+	return ok && loginMethod == method && time.Since(time.Unix(loginAt, 0)) <= window
+}
+
+// Purges the accounts whose deletion grace period is over and returns how many were purged.
+//
+// Accounts which could not be purged are logged and retried on the next run.
+func PurgeDeletedAccounts() (int, error) {
+	users, err := Svc.GetUsersDueForDeletion(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+
+	for _, user := range users {
+		if err := purgeAccount(user); err != nil {
+			log.Printf("%s Error purging account %s: %s\n", logging.ErrSign, user.ID, err.Error())
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// Removes the avatar and every row of the user, the purge itself is kept as event.
+func purgeAccount(user *database.UserAccount) error {
+	// The avatar is removed first, the account would be gone if removing it failed afterwards.
+	if user.AvatarURL != "" {
+		if err := StorageSvc.DeleteUserProfilePicture(user.ID.String()); err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			return err
+		}
+	}
+
+	if err := Svc.DeleteUser(user.ID); err != nil {
+		return err
+	}
+
+	disconnectTwitchBot(user)
+
+	_, err := Svc.AddEvent(database.NewEvent(database.UserPurged, &user.ID, nil))
+	return err
+}
+
+func collectAccountExport(user *database.UserAccount) (*accountExport, error) {
+	export := &accountExport{
+		account:     exportedAccountModel(user),
+		crosshairs:  []models.Crosshair{},
+		collections: []models.Collection{},
+		events:      []models.Event{},
+		passkeys:    []models.Passkey{},
+		botLogs:     []*database.TwitchBotLog{},
+	}
+
+	crosshairs, err := Svc.GetAllCrosshairsFromUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, ch := range crosshairs {
+		export.crosshairs = append(export.crosshairs, crosshairModel(ch))
+	}
+
+	collections, err := Svc.GetCollectionsFromUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, col := range collections {
+		export.collections = append(export.collections, collectionModel(col))
+	}
+
+	export.events, err = userEvents(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys, err := Svc.GetPasskeysFromUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, passkey := range passkeys {
+		export.passkeys = append(export.passkeys, passkeyModel(passkey))
+	}
+
+	if user.TwitchLogin != "" {
+		export.botLogs, err = Svc.GetTwitchBotLogsByTwitchLogin(user.TwitchLogin)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if user.AvatarURL != "" {
+		export.avatar, err = StorageSvc.GetUserProfilePicture(user.ID.String())
+		if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			return nil, err
+		}
+	}
+
+	return export, nil
+}
+
+// Returns every event of the user, newest first.
+func userEvents(userID uuid.UUID) ([]models.Event, error) {
+	query := &database.EventQuery{
+		UserID: &userID,
+		Limit:  exportEventsPageSize,
+	}
+
+	events := []models.Event{}
+
+	for {
+		page, nextCursor, err := Svc.GetEvents(query)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, event := range page {
+			events = append(events, eventModel(event))
+		}
+
+		if nextCursor == "" {
+			return events, nil
+		}
+
+		query.Cursor = nextCursor
+	}
+}
+
+func writeAccountExport(w io.Writer, export *accountExport) error {
+	archive := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"account.json", export.account},
+		{"crosshairs.json", export.crosshairs},
+		{"collections.json", export.collections},
+		{"events.json", export.events},
+		{"passkeys.json", export.passkeys},
+		{"twitch_bot_logs.json", export.botLogs},
+	}
+
+	now := time.Now()
+
+	for _, file := range files {
+		fw, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(fw)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+
+	if export.avatar != nil {
+		fw, err := archive.CreateHeader(&zip.FileHeader{Name: "avatar.png", Method: zip.Store, Modified: now})
+		if err != nil {
+			return err
+		}
+
+		if _, err := fw.Write(export.avatar); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func exportedAccountModel(user *database.UserAccount) models.ExportedAccount {
+	return models.ExportedAccount{
+		ID:                    user.ID,
+		CreatedAt:             user.CreatedAt,
+		UpdatedAt:             user.UpdatedAt,
+		EMail:                 user.EMail,
+		VerifiedMail:          user.VerifiedMail,
+		DisplayName:           user.DisplayName,
+		Role:                  user.Role,
+		AvatarURL:             user.AvatarURL,
+		RegisterIP:            user.RegisterIP,
+		LoginIP:               user.LoginIP,
+		LastLogin:             user.LastLogin,
+		TwitchID:              user.TwitchID,
+		TwitchLogin:           user.TwitchLogin,
+		TwitchCreatedAt:       user.TwitchCreatedAt,
+		CrosshairsRegistered:  user.CrosshairsRegistered,
+		CrosshairQuota:        user.CrosshairQuota,
+		SuspendedAt:           user.SuspendedAt,
+		SuspendedUntil:        user.SuspendedUntil,
+		SuspensionReason:      user.SuspensionReason,
+		PasswordResetRequired: user.PasswordResetRequired,
+		TwoFactorEnabled:      user.TwoFactorEnabled,
+	}
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,11 +16,15 @@ import (
 	"github.com/devusSs/crosshairs/database"
 	"github.com/devusSs/crosshairs/logging"
 	"github.com/devusSs/crosshairs/utils"
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+const (
+	eventsLimitDefault = 100
+	eventsLimitMax     = 500
+)
+
 type zapLogFormat struct {
 	Level     string  `json:"level"`
 	Timestamp float64 `json:"ts"`
@@ -35,47 +40,6 @@ type zapLogFormat struct {
 }
 
 func GetAllUsersRoute(c *gin.Context) {
-	session := sessions.Default(c)
-
-	if session.Get("user") == nil {
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusUnauthorized
-		resp.Error.ErrorCode = "unauthorized"
-		resp.Error.ErrorMessage = "You are currently not logged in."
-		resp.SendErrorResponse(c)
-		return
-	}
-
-	uuidUser, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
-	if err != nil {
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusBadRequest
-		resp.Error.ErrorCode = "invalid_request"
-		resp.Error.ErrorMessage = "Could not parse uuid."
-		resp.SendErrorResponse(c)
-		return
-	}
-
-	user, err := Svc.GetUserByUID(&database.UserAccount{ID: uuidUser})
-	if err != nil {
-		errString := database.CheckDatabaseError(err)
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusBadRequest
-		resp.Error.ErrorCode = "invalid_request"
-		resp.Error.ErrorMessage = errString
-		resp.SendErrorResponse(c)
-		return
-	}
-
-	if user.Role != "admin" {
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusUnauthorized
-		resp.Error.ErrorCode = "unauthorized"
-		resp.Error.ErrorMessage = "You are not an admin."
-		resp.SendErrorResponse(c)
-		return
-	}
-
 	email := c.Query("email")
 
 	if email != "" {
@@ -131,6 +95,12 @@ func GetAllUsersRoute(c *gin.Context) {
 		returnUser.LoginIP = user.LoginIP
 		returnUser.LastLogin = user.LastLogin
 		returnUser.CrosshairsRegistered = user.CrosshairsRegistered
+		returnUser.CrosshairQuota = user.CrosshairQuota
+		returnUser.Suspended = user.IsSuspended()
+		returnUser.SuspendedUntil = user.SuspendedUntil
+		returnUser.SuspensionReason = user.SuspensionReason
+		returnUser.PasswordResetRequired = user.PasswordResetRequired
+		returnUser.TwoFactorEnabled = user.TwoFactorEnabled
 
 		resp := responses.SuccessResponse{
 			Code: http.StatusOK,
@@ -165,6 +135,12 @@ func GetAllUsersRoute(c *gin.Context) {
 		user.LoginIP = u.LoginIP
 		user.LastLogin = u.LastLogin
 		user.CrosshairsRegistered = u.CrosshairsRegistered
+		user.CrosshairQuota = u.CrosshairQuota
+		user.Suspended = u.IsSuspended()
+		user.SuspendedUntil = u.SuspendedUntil
+		user.SuspensionReason = u.SuspensionReason
+		user.PasswordResetRequired = u.PasswordResetRequired
+		user.TwoFactorEnabled = u.TwoFactorEnabled
 		user.AvatarURL = u.AvatarURL
 
 		if user.AvatarURL == "" {
@@ -198,47 +174,6 @@ func GetAllUsersRoute(c *gin.Context) {
 }
 
 func GetAllCrosshairsRoute(c *gin.Context) {
-	session := sessions.Default(c)
-
-	if session.Get("user") == nil {
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusUnauthorized
-		resp.Error.ErrorCode = "unauthorized"
-		resp.Error.ErrorMessage = "You are currently not logged in."
-		resp.SendErrorResponse(c)
-		return
-	}
-
-	uuidUser, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
-	if err != nil {
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusBadRequest
-		resp.Error.ErrorCode = "invalid_request"
-		resp.Error.ErrorMessage = "Could not parse uuid."
-		resp.SendErrorResponse(c)
-		return
-	}
-
-	user, err := Svc.GetUserByUID(&database.UserAccount{ID: uuidUser})
-	if err != nil {
-		errString := database.CheckDatabaseError(err)
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusBadRequest
-		resp.Error.ErrorCode = "invalid_request"
-		resp.Error.ErrorMessage = errString
-		resp.SendErrorResponse(c)
-		return
-	}
-
-	if user.Role != "admin" {
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusUnauthorized
-		resp.Error.ErrorCode = "unauthorized"
-		resp.Error.ErrorMessage = "You are not an admin."
-		resp.SendErrorResponse(c)
-		return
-	}
-
 	crosshairsDB, err := Svc.GetAllCrosshairs()
 	if err != nil {
 		errString := database.CheckDatabaseError(err)
@@ -276,12 +211,8 @@ func GetAllCrosshairsRoute(c *gin.Context) {
 		}
 
 		for _, ch := range crosshairsDB {
-			var crosshair models.Crosshair
 			if ch.RegistrantID == user.ID {
-				crosshair.ID = ch.ID
-				crosshair.Added = ch.CreatedAt
-				crosshair.Code = ch.Code
-				crosshair.Note = ch.Note
+				crosshair := crosshairModel(ch)
 				crosshairs.Crosshairs = append(crosshairs.Crosshairs, crosshair)
 			}
 		}
@@ -295,12 +226,7 @@ func GetAllCrosshairsRoute(c *gin.Context) {
 	}
 
 	for _, ch := range crosshairsDB {
-		crosshair := models.Crosshair{
-			ID:    ch.ID,
-			Added: ch.CreatedAt,
-			Code:  ch.Code,
-			Note:  ch.Note,
-		}
+		crosshair := crosshairModel(ch)
 		crosshairs.Crosshairs = append(crosshairs.Crosshairs, crosshair)
 	}
 
@@ -311,142 +237,32 @@ func GetAllCrosshairsRoute(c *gin.Context) {
 	resp.SendSuccessReponse(c)
 }
 
-func GetAllEventsOrByTypeRoute(c *gin.Context) {
-	session := sessions.Default(c)
-
-	if session.Get("user") == nil {
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusUnauthorized
-		resp.Error.ErrorCode = "unauthorized"
-		resp.Error.ErrorMessage = "You are currently not logged in."
-		resp.SendErrorResponse(c)
-		return
-	}
-
-	uuidUser, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+// Lists events, newest first.
+//
+// Query parameters (all optional): type, user (user id), severity, from, to
+// (RFC 3339 or YYYY-MM-DD), cursor and limit.
+func GetEventsRoute(c *gin.Context) {
+	query, err := parseEventQuery(c)
 	if err != nil {
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusBadRequest
 		resp.Error.ErrorCode = "invalid_request"
-		resp.Error.ErrorMessage = "Could not parse uuid."
+		resp.Error.ErrorMessage = err.Error()
 		resp.SendErrorResponse(c)
 		return
 	}
 
-	user, err := Svc.GetUserByUID(&database.UserAccount{ID: uuidUser})
+	events, nextCursor, err := Svc.GetEvents(query)
 	if err != nil {
-		errString := database.CheckDatabaseError(err)
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusBadRequest
-		resp.Error.ErrorCode = "invalid_request"
-		resp.Error.ErrorMessage = errString
-		resp.SendErrorResponse(c)
-		return
-	}
-
-	if user.Role != "admin" {
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusUnauthorized
-		resp.Error.ErrorCode = "unauthorized"
-		resp.Error.ErrorMessage = "You are not an admin."
-		resp.SendErrorResponse(c)
-		return
-	}
-
-	limit := c.Query("limit")
-	eventType := c.Query("type")
-
-	if eventType != "" {
-		if eventType != "user_registered" && eventType != "user_password_change" && eventType != "user_uploaded_avatar" {
+		if errors.Is(err, database.ErrInvalidCursor) {
 			resp := responses.ErrorResponse{}
 			resp.Code = http.StatusBadRequest
 			resp.Error.ErrorCode = "invalid_request"
-			resp.Error.ErrorMessage = "Specified invalid event types."
+			resp.Error.ErrorMessage = "Invalid cursor provided."
 			resp.SendErrorResponse(c)
 			return
 		}
 
-		if limit != "" {
-			limitInt, err := strconv.Atoi(limit)
-			if err != nil {
-				resp := responses.ErrorResponse{}
-				resp.Code = http.StatusBadRequest
-				resp.Error.ErrorCode = "invalid_request"
-				resp.Error.ErrorMessage = "Could not parse limit."
-				resp.SendErrorResponse(c)
-				return
-			}
-
-			events, err := Svc.GetEventsByTypeWithLimit(eventType, limitInt)
-			if err != nil {
-				errString := database.CheckDatabaseError(err)
-				resp := responses.ErrorResponse{}
-				resp.Code = http.StatusInternalServerError
-				resp.Error.ErrorCode = "internal_error"
-				resp.Error.ErrorMessage = errString
-				resp.SendErrorResponse(c)
-				return
-			}
-
-			resp := responses.SuccessResponse{
-				Code: http.StatusOK,
-				Data: events,
-			}
-			resp.SendSuccessReponse(c)
-			return
-		}
-
-		events, err := Svc.GetEventsByType(eventType)
-		if err != nil {
-			errString := database.CheckDatabaseError(err)
-			resp := responses.ErrorResponse{}
-			resp.Code = http.StatusInternalServerError
-			resp.Error.ErrorCode = "internal_error"
-			resp.Error.ErrorMessage = errString
-			resp.SendErrorResponse(c)
-			return
-		}
-
-		resp := responses.SuccessResponse{
-			Code: http.StatusOK,
-			Data: events,
-		}
-		resp.SendSuccessReponse(c)
-		return
-	}
-
-	if limit != "" {
-		limitInt, err := strconv.Atoi(limit)
-		if err != nil {
-			resp := responses.ErrorResponse{}
-			resp.Code = http.StatusBadRequest
-			resp.Error.ErrorCode = "invalid_request"
-			resp.Error.ErrorMessage = "Could not parse limit."
-			resp.SendErrorResponse(c)
-			return
-		}
-
-		events, err := Svc.GetEventsWithLimit(limitInt)
-		if err != nil {
-			errString := database.CheckDatabaseError(err)
-			resp := responses.ErrorResponse{}
-			resp.Code = http.StatusInternalServerError
-			resp.Error.ErrorCode = "internal_error"
-			resp.Error.ErrorMessage = errString
-			resp.SendErrorResponse(c)
-			return
-		}
-
-		resp := responses.SuccessResponse{
-			Code: http.StatusOK,
-			Data: events,
-		}
-		resp.SendSuccessReponse(c)
-		return
-	}
-
-	events, err := Svc.GetEvents()
-	if err != nil {
 		errString := database.CheckDatabaseError(err)
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusInternalServerError
@@ -456,55 +272,86 @@ func GetAllEventsOrByTypeRoute(c *gin.Context) {
 		return
 	}
 
+	page := models.EventPage{
+		Events:     []models.Event{},
+		NextCursor: nextCursor,
+	}
+
+	for _, event := range events {
+		page.Events = append(page.Events, eventModel(event))
+	}
+
 	resp := responses.SuccessResponse{
 		Code: http.StatusOK,
-		Data: events,
+		Data: page,
 	}
 	resp.SendSuccessReponse(c)
 }
 
-func GetAPILogsRoute(c *gin.Context) {
-	session := sessions.Default(c)
+func parseEventQuery(c *gin.Context) (*database.EventQuery, error) {
+	query := &database.EventQuery{
+		Cursor: c.Query("cursor"),
+		Limit:  eventsLimitDefault,
+	}
 
-	if session.Get("user") == nil {
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusUnauthorized
-		resp.Error.ErrorCode = "unauthorized"
-		resp.Error.ErrorMessage = "You are currently not logged in."
-		resp.SendErrorResponse(c)
-		return
+	if eventType := c.Query("type"); eventType != "" {
+		if !database.IsKnownEventType(eventType) {
+			return nil, errors.New("Specified invalid event type.")
+		}
+		query.Type = database.EventType(eventType)
 	}
 
-	uuidUser, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
-	if err != nil {
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusBadRequest
-		resp.Error.ErrorCode = "invalid_request"
-		resp.Error.ErrorMessage = "Could not parse uuid."
-		resp.SendErrorResponse(c)
-		return
+	if user := c.Query("user"); user != "" {
+		userID, err := uuid.Parse(user)
+		if err != nil {
+			return nil, errors.New("Invalid user provided.")
+		}
+		query.UserID = &userID
+	}
+
+	if severity := database.EventSeverity(c.Query("severity")); severity != "" {
+		if !severity.IsValid() {
+			return nil, errors.New("Severity needs to be info, warning or critical.")
+		}
+		query.Severity = severity
 	}
 
-	user, err := Svc.GetUserByUID(&database.UserAccount{ID: uuidUser})
+	from, to, err := parseTimeRange(c)
 	if err != nil {
-		errString := database.CheckDatabaseError(err)
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusBadRequest
-		resp.Error.ErrorCode = "invalid_request"
-		resp.Error.ErrorMessage = errString
-		resp.SendErrorResponse(c)
-		return
+		return nil, err
 	}
+	query.From = from
+	query.To = to
 
-	if user.Role != "admin" {
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusUnauthorized
-		resp.Error.ErrorCode = "unauthorized"
-		resp.Error.ErrorMessage = "You are not an admin."
-		resp.SendErrorResponse(c)
-		return
+	if limit := c.Query("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > eventsLimitMax {
+			return nil, fmt.Errorf("Limit needs to be between 1 and %d.", eventsLimitMax)
+		}
+		query.Limit = parsed
 	}
 
+	return query, nil
+}
+
+func eventModel(event *database.Event) models.Event {
+	return models.Event{
+		ID:        event.ID,
+		CreatedAt: event.CreatedAt,
+		Type:      string(event.Type),
+		Severity:  string(event.Severity),
+		UserID:    event.UserID,
+		Data: models.EventData{
+			URL:      event.Data.URL,
+			Method:   event.Data.Method,
+			IssuerIP: event.Data.IssuerIP,
+		},
+		Payload:   event.Payload,
+		Timestamp: event.Timestamp,
+	}
+}
+
+func GetAPILogsRoute(c *gin.Context) {
 	lines, err := logging.ReadZapLog()
 	if err != nil {
 		resp := responses.ErrorResponse{}
@@ -0,0 +1,224 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devusSs/crosshairs/api/models"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	auditLimitDefault = 50
+	auditLimitMax     = 200
+	// Page size used while exporting, the export itself is not limited.
+	auditExportPageSize = 500
+)
+
+// Lists audit log entries, newest first.
+//
+// Query parameters (all optional): actor (user id), action, target_type, target_id,
+// from, to (RFC 3339 or YYYY-MM-DD), cursor and limit.
+func GetAuditLogsRoute(c *gin.Context) {
+	query, err := parseAuditQuery(c)
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = err.Error()
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	entries, nextCursor, err := Svc.GetAuditLogs(query)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = "Invalid cursor provided."
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	page := models.AuditLogPage{
+		Entries:    []models.AuditLog{},
+		NextCursor: nextCursor,
+	}
+
+	for _, entry := range entries {
+		page.Entries = append(page.Entries, auditLogModel(entry))
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: page,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Downloads all audit log entries matching the filters of GetAuditLogsRoute as JSON Lines, newest first.
+//
+// Cursor and limit are ignored.
+func ExportAuditLogsRoute(c *gin.Context) {
+	query, err := parseAuditQuery(c)
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = err.Error()
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	query.Cursor = ""
+	query.Limit = auditExportPageSize
+
+	// The first page is fetched before writing so errors can still be sent as JSON.
+	entries, nextCursor, err := Svc.GetAuditLogs(query)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit-%s.jsonl", time.Now().UTC().Format("20060102-150405")))
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+
+	for {
+		for _, entry := range entries {
+			if err := encoder.Encode(auditLogModel(entry)); err != nil {
+				return
+			}
+		}
+
+		if nextCursor == "" {
+			return
+		}
+
+		query.Cursor = nextCursor
+
+		entries, nextCursor, err = Svc.GetAuditLogs(query)
+		if err != nil {
+			// Headers have been sent already, the export ends early.
+			logging.WriteError(fmt.Sprintf("could not export audit log: %s", err.Error()))
+			return
+		}
+	}
+}
+
+func parseAuditQuery(c *gin.Context) (*database.AuditQuery, error) {
+	query := &database.AuditQuery{
+		Action:     strings.TrimSpace(c.Query("action")),
+		TargetType: strings.TrimSpace(c.Query("target_type")),
+		TargetID:   strings.TrimSpace(c.Query("target_id")),
+		Cursor:     c.Query("cursor"),
+		Limit:      auditLimitDefault,
+	}
+
+	if actor := c.Query("actor"); actor != "" {
+		actorID, err := uuid.Parse(actor)
+		if err != nil {
+			return nil, errors.New("Invalid actor provided.")
+		}
+		query.ActorID = &actorID
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return nil, err
+	}
+	query.From = from
+	query.To = to
+
+	if limit := c.Query("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > auditLimitMax {
+			return nil, fmt.Errorf("Limit needs to be between 1 and %d.", auditLimitMax)
+		}
+		query.Limit = parsed
+	}
+
+	return query, nil
+}
+
+// Parses the optional from and to query parameters, RFC 3339 times or dates.
+//
+// To is exclusive, a date includes the whole day.
+func parseTimeRange(c *gin.Context) (*time.Time, *time.Time, error) {
+	var from, to *time.Time
+
+	if value := c.Query("from"); value != "" {
+		parsed, _, err := parseTimeParam(value)
+		if err != nil {
+			return nil, nil, errors.New("Invalid from time provided.")
+		}
+		from = &parsed
+	}
+
+	if value := c.Query("to"); value != "" {
+		parsed, dateOnly, err := parseTimeParam(value)
+		if err != nil {
+			return nil, nil, errors.New("Invalid to time provided.")
+		}
+		if dateOnly {
+			parsed = parsed.AddDate(0, 0, 1)
+		}
+		to = &parsed
+	}
+
+	return from, to, nil
+}
+
+// Accepts RFC 3339 times and dates, reports whether a date was given.
+func parseTimeParam(value string) (time.Time, bool, error) {
+	if parsed, err := time.Parse(time.DateOnly, value); err == nil {
+		return parsed, true, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	return parsed, false, err
+}
+
+func auditLogModel(entry *database.AuditLog) models.AuditLog {
+	return models.AuditLog{
+		ID:         entry.ID,
+		CreatedAt:  entry.CreatedAt,
+		RequestID:  entry.RequestID,
+		ActorID:    entry.ActorID,
+		ActorIP:    entry.ActorIP,
+		Method:     entry.Method,
+		Route:      entry.Route,
+		URL:        entry.URL,
+		Status:     entry.Status,
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetID,
+		Before:     entry.Before,
+		After:      entry.After,
+	}
+}
@@ -0,0 +1,301 @@
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/crosshairlist"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	bulkImportMaxSize = 1 << 20 // 1 MiB
+	bulkImportMax     = 500
+	importDefaultNote = "Imported"
+)
+
+// Saves all crosshairs of a JSON, CSV or plain text list.
+//
+// The format is read from the format query or the Content-Type header. Every entry is
+// saved on its own, invalid entries are reported by their line and do not stop the import.
+func ImportCrosshairsRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var format crosshairlist.Format
+	if c.Query("format") != "" {
+		format, err = crosshairlist.ParseFormat(c.Query("format"))
+	} else {
+		format, err = crosshairlist.FormatFromContentType(c.ContentType())
+	}
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Unknown format, use json, csv or text."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, bulkImportMaxSize)
+
+	entries, err := crosshairlist.Read(format, body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusRequestEntityTooLarge
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = fmt.Sprintf("Import may be at most %d MiB large.", bulkImportMaxSize>>20)
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("Could not read %s list: %s.", format, err.Error())
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if len(entries) == 0 {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "No crosshairs provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if len(entries) > bulkImportMax {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("At most %d crosshairs can be imported at once.", bulkImportMax)
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	user, err := Svc.GetUserByUID(&database.UserAccount{ID: userUID})
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshairs, err := Svc.GetAllCrosshairsFromUser(userUID)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	// Importing the same list twice, e.g. a backup, should not duplicate crosshairs.
+	existing := make(map[string]bool)
+	for _, ch := range crosshairs {
+		existing[ch.Code] = true
+	}
+
+	imported := responses.ImportCrosshairsResponse{Results: []responses.SavedCrosshair{}}
+
+	for _, entry := range entries {
+		result := importCrosshair(c, user, entry, existing)
+
+		if result.Saved {
+			imported.Imported++
+		} else {
+			imported.Failed++
+		}
+
+		imported.Results = append(imported.Results, result)
+	}
+
+	imported.CHsOnRecord = user.CrosshairsRegistered
+
+	code := http.StatusOK
+	if imported.Imported > 0 {
+		code = http.StatusCreated
+	}
+
+	resp := responses.SuccessResponse{
+		Code: code,
+		Data: imported,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Downloads all crosshairs of the user as JSON, CSV or plain text list, oldest first.
+func ExportCrosshairsRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	format, err := crosshairlist.ParseFormat(c.DefaultQuery("format", string(crosshairlist.FormatJSON)))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Unknown format, use json, csv or text."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshairs, err := Svc.GetAllCrosshairsFromUser(userUID)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	// Oldest first so importing the list keeps the order.
+	sort.SliceStable(crosshairs, func(i, j int) bool {
+		return crosshairs[i].CreatedAt.Before(crosshairs[j].CreatedAt)
+	})
+
+	var entries []crosshairlist.Entry
+	for _, ch := range crosshairs {
+		added := ch.CreatedAt
+		entries = append(entries, crosshairlist.Entry{
+			Code:       ch.Code,
+			Note:       ch.Note,
+			Tags:       tagNames(ch.Tags),
+			Visibility: string(ch.Visibility),
+			Added:      &added,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := crosshairlist.Write(format, &buf, entries); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Could not write export."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=crosshairs%s", format.Extension()))
+	c.Data(http.StatusOK, format.ContentType(), buf.Bytes())
+}
+
+// Validates and saves one entry of a bulk import, saved codes are added to existing.
+func importCrosshair(c *gin.Context, user *database.UserAccount, entry crosshairlist.Entry, existing map[string]bool) responses.SavedCrosshair {
+	result := responses.SavedCrosshair{Line: entry.Line, Code: entry.Code}
+
+	if entry.Code == "" {
+		result.Error = "Missing crosshair code."
+		return result
+	}
+
+	if existing[entry.Code] {
+		result.Error = "Crosshair is already saved."
+		return result
+	}
+
+	tags, err := normalizeTags(entry.Tags)
+	if err != nil {
+		result.Error = fmt.Sprintf("Invalid tags provided: %s.", err.Error())
+		return result
+	}
+
+	// Lists without visibility (e.g. hand written ones) import private crosshairs like any other new crosshair.
+	visibility := database.VisibilityPrivate
+	if entry.Visibility != "" {
+		visibility = database.CrosshairVisibility(strings.ToLower(strings.TrimSpace(entry.Visibility)))
+		if !visibility.IsValid() {
+			result.Error = "Visibility needs to be one of private, unlisted or public."
+			return result
+		}
+	}
+
+	note := strings.TrimSpace(entry.Note)
+	if note == "" {
+		note = importDefaultNote
+	}
+
+	crosshair := &database.Crosshair{Code: entry.Code, Note: note, RegisterIP: c.Request.Header.Get("X-Forwarded-For")}
+
+	if errResp := saveCrosshairFrom(user, crosshair); errResp != nil {
+		result.Error = errResp.Error.ErrorMessage
+		return result
+	}
+
+	result.Saved = true
+	existing[entry.Code] = true
+
+	var problems []string
+
+	if visibility != database.VisibilityPrivate {
+		crosshair.Visibility = visibility
+		if _, err := Svc.UpdateCrosshairVisibility(crosshair); err != nil {
+			crosshair.Visibility = database.VisibilityPrivate
+			problems = append(problems, fmt.Sprintf("Saved as private: %s", database.CheckDatabaseError(err)))
+		}
+	}
+
+	if len(tags) > 0 {
+		if _, err := Svc.SetCrosshairTags(crosshair, tags); err != nil {
+			problems = append(problems, fmt.Sprintf("Saved without tags: %s", database.CheckDatabaseError(err)))
+		}
+	}
+
+	result.Error = strings.Join(problems, " ")
+
+	return result
+}
@@ -0,0 +1,541 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/devusSs/crosshairs/api/models"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/sharecode"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	lenCollectionNameMax        = 64
+	lenCollectionDescriptionMax = 256
+	collectionCrosshairsMax     = 20
+
+	// Prefix of the aliases in exported collection configs.
+	collectionAliasPrefix = "xhair"
+	collectionKeyDefault  = "n"
+)
+
+// Keys as used by the game's bind command, e.g. n, mouse4 or kp_end.
+var bindKeyRegex = regexp.MustCompile(`^[a-z0-9_]{1,16}$`)
+
+func GetCollectionsRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	collections, err := Svc.GetCollectionsFromUser(userUID)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	collectionsReturn := models.Collections{Collections: []models.Collection{}}
+
+	for _, col := range collections {
+		collectionsReturn.Collections = append(collectionsReturn.Collections, collectionModel(col))
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: collectionsReturn,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func AddCollectionRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var saveCollection models.SaveCollection
+
+	if err := c.BindJSON(&saveCollection); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	col := &database.Collection{OwnerID: userUID}
+
+	if errResp := setCollectionDetails(col, saveCollection.Name, saveCollection.Description); errResp != nil {
+		errResp.SendErrorResponse(c)
+		return
+	}
+
+	items, errResp := collectionItems(userUID, saveCollection.Crosshairs)
+	if errResp != nil {
+		errResp.SendErrorResponse(c)
+		return
+	}
+	col.Items = items
+
+	if _, err := Svc.AddCollection(col); err != nil {
+		sendCollectionSaveError(c, err)
+		return
+	}
+
+	col, err = Svc.GetCollectionByID(col.ID)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusCreated,
+		Data: collectionModel(col),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func GetCollectionRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	col, ok := ownCollectionFromParam(c, userUID)
+	if !ok {
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: collectionModel(col),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Renames the collection, changes its description and / or replaces its crosshairs.
+func UpdateCollectionRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var updateCollection models.UpdateCollection
+
+	if err := c.BindJSON(&updateCollection); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if updateCollection.Name == nil && updateCollection.Description == nil && updateCollection.Crosshairs == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Nothing to update provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	col, ok := ownCollectionFromParam(c, userUID)
+	if !ok {
+		return
+	}
+
+	name := col.Name
+	if updateCollection.Name != nil {
+		name = *updateCollection.Name
+	}
+
+	description := col.Description
+	if updateCollection.Description != nil {
+		description = *updateCollection.Description
+	}
+
+	if errResp := setCollectionDetails(col, name, description); errResp != nil {
+		errResp.SendErrorResponse(c)
+		return
+	}
+
+	if updateCollection.Crosshairs != nil {
+		items, errResp := collectionItems(userUID, *updateCollection.Crosshairs)
+		if errResp != nil {
+			errResp.SendErrorResponse(c)
+			return
+		}
+		col.Items = items
+	}
+
+	if _, err := Svc.UpdateCollection(col); err != nil {
+		sendCollectionSaveError(c, err)
+		return
+	}
+
+	col, err = Svc.GetCollectionByID(col.ID)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: collectionModel(col),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Deletes the collection, its crosshairs are kept.
+func DeleteCollectionRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	col, ok := ownCollectionFromParam(c, userUID)
+	if !ok {
+		return
+	}
+
+	if err := Svc.DeleteCollection(col.ID); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{}
+	resp.Code = http.StatusNoContent
+	resp.SendSuccessReponse(c)
+}
+
+// Exports all crosshairs of the collection as one cfg, the key cycles through them in order.
+//
+// The config is sent as a file if download=true is set, as JSON otherwise.
+func ExportCollectionConfigRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	key := strings.ToLower(strings.TrimSpace(c.DefaultQuery("key", collectionKeyDefault)))
+	if !bindKeyRegex.MatchString(key) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid key provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	col, ok := ownCollectionFromParam(c, userUID)
+	if !ok {
+		return
+	}
+
+	if len(col.Items) == 0 {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Collection does not contain any crosshairs."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var entries []sharecode.CycleEntry
+
+	for _, item := range col.Items {
+		settings := item.Crosshair.Settings
+		entries = append(entries, sharecode.CycleEntry{Name: item.Crosshair.Note, Settings: &settings})
+	}
+
+	config := sharecode.CycleConfig(col.Name, collectionAliasPrefix, key, entries)
+
+	if c.Query("download") == "true" {
+		c.Header("Content-Disposition", "attachment; filename=collection.cfg")
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(config))
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: models.CollectionConfig{
+			ID:     col.ID,
+			Name:   col.Name,
+			Key:    key,
+			Config: config,
+		},
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Gets a collection of the user by the id in the route, other users' collections are treated as non existent.
+func ownCollectionFromParam(c *gin.Context, userUID uuid.UUID) (*database.Collection, bool) {
+	collectionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid collection id provided."
+		resp.SendErrorResponse(c)
+		return nil, false
+	}
+
+	col, err := Svc.GetCollectionByID(collectionID)
+	if err != nil && !database.IsNotFoundError(err) {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return nil, false
+	}
+
+	if database.IsNotFoundError(err) || col.OwnerID != userUID {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusNotFound
+		resp.Error.ErrorCode = "not_found"
+		resp.Error.ErrorMessage = "No matching collection found."
+		resp.SendErrorResponse(c)
+		return nil, false
+	}
+
+	return col, true
+}
+
+func setCollectionDetails(col *database.Collection, name, description string) *responses.ErrorResponse {
+	name = strings.TrimSpace(name)
+	description = strings.TrimSpace(description)
+
+	if name == "" || len(name) > lenCollectionNameMax {
+		resp := &responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("Name needs to be between 1 and %d characters long.", lenCollectionNameMax)
+		return resp
+	}
+
+	if len(description) > lenCollectionDescriptionMax {
+		resp := &responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("Description may be at most %d characters long.", lenCollectionDescriptionMax)
+		return resp
+	}
+
+	col.Name = name
+	col.Description = description
+
+	return nil
+}
+
+// Turns the crosshair ids into collection items, every crosshair needs to belong to the user.
+func collectionItems(userUID uuid.UUID, ids []uuid.UUID) ([]database.CollectionItem, *responses.ErrorResponse) {
+	if len(ids) > collectionCrosshairsMax {
+		resp := &responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("A collection may contain at most %d crosshairs.", collectionCrosshairsMax)
+		return nil, resp
+	}
+
+	crosshairs, err := Svc.GetAllCrosshairsFromUser(userUID)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := &responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		return nil, resp
+	}
+
+	owned := make(map[uuid.UUID]bool)
+	for _, ch := range crosshairs {
+		owned[ch.ID] = true
+	}
+
+	items := []database.CollectionItem{}
+	added := make(map[uuid.UUID]bool)
+
+	for _, id := range ids {
+		if !owned[id] {
+			resp := &responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = fmt.Sprintf("No matching crosshair found for id %s.", id)
+			return nil, resp
+		}
+
+		if added[id] {
+			resp := &responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = fmt.Sprintf("Crosshair %s was provided more than once.", id)
+			return nil, resp
+		}
+
+		added[id] = true
+		items = append(items, database.CollectionItem{CrosshairID: id})
+	}
+
+	return items, nil
+}
+
+func sendCollectionSaveError(c *gin.Context, err error) {
+	if database.IsDuplicateError(err) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "You already have a collection with that name."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	errString := database.CheckDatabaseError(err)
+	resp := responses.ErrorResponse{}
+	resp.Code = http.StatusInternalServerError
+	resp.Error.ErrorCode = "internal_error"
+	resp.Error.ErrorMessage = errString
+	resp.SendErrorResponse(c)
+}
+
+func collectionModel(col *database.Collection) models.Collection {
+	model := models.Collection{
+		ID:          col.ID,
+		CreatedAt:   col.CreatedAt,
+		UpdatedAt:   col.UpdatedAt,
+		Name:        col.Name,
+		Description: col.Description,
+		Crosshairs:  []models.Crosshair{},
+	}
+
+	for i := range col.Items {
+		model.Crosshairs = append(model.Crosshairs, crosshairModel(&col.Items[i].Crosshair))
+	}
+
+	return model
+}
@@ -0,0 +1,270 @@
+package routes
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/devusSs/crosshairs/api/models"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/sharecode"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	similarLimitDefault = 10
+	similarLimitMax     = 50
+
+	// Amount of public and pro crosshairs each which are preselected by the database and ranked afterwards.
+	similarCandidates = 200
+)
+
+// Compares two crosshairs setting by setting, does not need a session.
+//
+// Both a and b may either be a share code or the id of a crosshair. Ids of private
+// crosshairs can only be used by their owner.
+func DiffCrosshairsRoute(c *gin.Context) {
+	codeA, settingsA, errResp := resolveCrosshairSettings(c, c.Query("a"))
+	if errResp != nil {
+		errResp.SendErrorResponse(c)
+		return
+	}
+
+	codeB, settingsB, errResp := resolveCrosshairSettings(c, c.Query("b"))
+	if errResp != nil {
+		errResp.SendErrorResponse(c)
+		return
+	}
+
+	diff := models.CrosshairDiff{
+		A:          codeA,
+		B:          codeB,
+		Similarity: roundSimilarity(sharecode.Similarity(settingsA, settingsB)),
+		Changes:    []models.SettingDifference{},
+	}
+
+	for _, d := range sharecode.Diff(settingsA, settingsB) {
+		diff.Changes = append(diff.Changes, models.SettingDifference{
+			Field: d.Field,
+			A:     d.A,
+			B:     d.B,
+		})
+	}
+
+	diff.Identical = len(diff.Changes) == 0
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: diff,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Finds the public and pro crosshairs which look the most like the given code, does not need a session.
+func GetSimilarCrosshairsRoute(c *gin.Context) {
+	code := strings.TrimSpace(c.Query("code"))
+
+	settings, err := sharecode.Decode(code)
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("Invalid crosshair code provided: %s.", err.Error())
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	limit := similarLimitDefault
+	if rawLimit := c.Query("limit"); rawLimit != "" {
+		limit, err = strconv.Atoi(rawLimit)
+		if err != nil || limit < 1 || limit > similarLimitMax {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = fmt.Sprintf("Limit needs to be between 1 and %d.", similarLimitMax)
+			resp.SendErrorResponse(c)
+			return
+		}
+	}
+
+	public, err := Svc.GetSimilarPublicCrosshairs(settings, similarCandidates)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	pros, err := Svc.GetSimilarProCrosshairs(settings, similarCandidates)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	owners, err := crosshairOwnerNames(public)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	players, err := proPlayersByCrosshairs(pros)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	similar := models.SimilarCrosshairs{Crosshairs: []models.SimilarCrosshair{}}
+
+	for _, ch := range public {
+		id := ch.ID
+		similar.Crosshairs = append(similar.Crosshairs, models.SimilarCrosshair{
+			Source:     "public",
+			ID:         &id,
+			Code:       ch.Code,
+			Note:       ch.Note,
+			Settings:   ch.Settings,
+			PreviewURL: publicObjectURL(ch.PreviewURL),
+			Owner:      owners[ch.RegistrantID],
+			Similarity: roundSimilarity(sharecode.Similarity(settings, &ch.Settings)),
+		})
+	}
+
+	for _, ch := range pros {
+		crosshair := models.SimilarCrosshair{
+			Source:     "pro",
+			Code:       ch.Code,
+			Note:       ch.Note,
+			Settings:   ch.Settings,
+			PreviewURL: publicObjectURL(ch.PreviewURL),
+			Similarity: roundSimilarity(sharecode.Similarity(settings, &ch.Settings)),
+		}
+
+		if player, ok := players[ch.ProPlayerID]; ok {
+			crosshair.Owner = player.Name
+			crosshair.Team = player.Team
+		}
+
+		similar.Crosshairs = append(similar.Crosshairs, crosshair)
+	}
+
+	sort.SliceStable(similar.Crosshairs, func(i, j int) bool {
+		return similar.Crosshairs[i].Similarity > similar.Crosshairs[j].Similarity
+	})
+
+	if len(similar.Crosshairs) > limit {
+		similar.Crosshairs = similar.Crosshairs[:limit]
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: similar,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Resolves a share code or crosshair id to the code and its settings.
+func resolveCrosshairSettings(c *gin.Context, value string) (string, *sharecode.Settings, *responses.ErrorResponse) {
+	value = strings.TrimSpace(value)
+
+	if value == "" {
+		resp := &responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Both a and b need to be provided."
+		return "", nil, resp
+	}
+
+	crosshairID, err := uuid.Parse(value)
+	if err != nil {
+		settings, err := sharecode.Decode(value)
+		if err != nil {
+			resp := &responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = fmt.Sprintf("Invalid crosshair code provided: %s.", err.Error())
+			return "", nil, resp
+		}
+		return value, settings, nil
+	}
+
+	crosshair, err := Svc.GetCrosshairByID(crosshairID)
+	if err != nil && !database.IsNotFoundError(err) {
+		errString := database.CheckDatabaseError(err)
+		resp := &responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		return "", nil, resp
+	}
+
+	visible := err == nil
+
+	// Private crosshairs are only visible to their owner.
+	if visible && crosshair.Visibility == database.VisibilityPrivate {
+		userUID, err := uuid.Parse(fmt.Sprintf("%s", sessions.Default(c).Get("user")))
+		visible = err == nil && userUID == crosshair.RegistrantID
+	}
+
+	if !visible {
+		resp := &responses.ErrorResponse{}
+		resp.Code = http.StatusNotFound
+		resp.Error.ErrorCode = "not_found"
+		resp.Error.ErrorMessage = "No matching crosshair found."
+		return "", nil, resp
+	}
+
+	return crosshair.Code, &crosshair.Settings, nil
+}
+
+// Fetches the pro players of all crosshairs at once.
+func proPlayersByCrosshairs(crosshairs []*database.ProCrosshair) (map[uuid.UUID]*database.ProPlayer, error) {
+	players := make(map[uuid.UUID]*database.ProPlayer)
+
+	if len(crosshairs) == 0 {
+		return players, nil
+	}
+
+	var ids []uuid.UUID
+	for _, ch := range crosshairs {
+		ids = append(ids, ch.ProPlayerID)
+	}
+
+	found, err := Svc.GetProPlayersByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, player := range found {
+		players[player.ID] = player
+	}
+
+	return players, nil
+}
+
+func roundSimilarity(similarity float64) float64 {
+	return math.Round(similarity*1000) / 1000
+}
@@ -1,14 +1,27 @@
 package routes
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/devusSs/crosshairs/api/models"
 	"github.com/devusSs/crosshairs/api/responses"
 	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/demo"
+	"github.com/devusSs/crosshairs/logging"
+	"github.com/devusSs/crosshairs/preview"
+	"github.com/devusSs/crosshairs/sharecode"
+	"github.com/devusSs/crosshairs/utils"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -17,9 +30,19 @@ import (
 const (
 	lenNoteMin       = 3
 	shareCodePattern = `^CSGO-[A-Za-z0-9]{5}-[A-Za-z0-9]{5}-[A-Za-z0-9]{5}-[A-Za-z0-9]{5}-[A-Za-z0-9]{5}$`
-	crosshairsMax    = 20
+
+	demoMaxSize       = 512 << 20 // 512 MiB, a full competitive match is usually around 100 to 300 MiB
+	demoUploadTimeout = 5 * time.Minute
+	demoDefaultNote   = "Imported from demo"
+
+	slugLength   = 8
+	slugAttempts = 5
+
+	tagsMax = 5
 )
 
+var tagRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,23}$`)
+
 func AddCrosshairRoute(c *gin.Context) {
 	session := sessions.Default(c)
 
@@ -53,91 +76,183 @@ func AddCrosshairRoute(c *gin.Context) {
 		return
 	}
 
-	user, err := Svc.GetUserByUID(&database.UserAccount{ID: userUID})
-	if err != nil {
-		errString := database.CheckDatabaseError(err)
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusBadRequest
-		resp.Error.ErrorCode = "invalid_request"
-		resp.Error.ErrorMessage = errString
-		resp.SendErrorResponse(c)
+	chsOnRecord, ok := addCrosshairForUser(c, userUID, addCrosshair.Code, addCrosshair.Note)
+	if !ok {
 		return
 	}
 
-	if user.Role != "admin" && user.CrosshairsRegistered > crosshairsMax {
+	resp := responses.SuccessResponse{
+		Code: http.StatusCreated,
+		Data: responses.CrosshairResponse{
+			Status:      "Successfully added crosshair",
+			CHsOnRecord: chsOnRecord,
+		},
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func GenerateCrosshairRoute(c *gin.Context) {
+	var generateCrosshair models.GenerateCrosshair
+
+	if err := c.BindJSON(&generateCrosshair); err != nil {
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusBadRequest
 		resp.Error.ErrorCode = "invalid_request"
-		resp.Error.ErrorMessage = "Already registered maximum number of crosshairs."
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
 		resp.SendErrorResponse(c)
 		return
 	}
 
-	matched, err := regexp.Match(shareCodePattern, []byte(addCrosshair.Code))
+	code, err := sharecode.Encode(&generateCrosshair.Settings)
 	if err != nil {
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusBadRequest
 		resp.Error.ErrorCode = "invalid_request"
-		resp.Error.ErrorMessage = "Could not parse crosshair code."
+		resp.Error.ErrorMessage = fmt.Sprintf("Invalid crosshair settings provided: %s.", err.Error())
 		resp.SendErrorResponse(c)
 		return
 	}
 
-	if !matched {
+	generated := responses.GenerateCrosshairResponse{
+		Code:     code,
+		Commands: generateCrosshair.Settings.Commands(),
+	}
+
+	if !generateCrosshair.Save {
+		resp := responses.SuccessResponse{
+			Code: http.StatusOK,
+			Data: generated,
+		}
+		resp.SendSuccessReponse(c)
+		return
+	}
+
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
 		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusBadRequest
-		resp.Error.ErrorCode = "invalid_request"
-		resp.Error.ErrorMessage = "Invalid crosshair code provided."
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You need to be logged in to save a crosshair."
 		resp.SendErrorResponse(c)
 		return
 	}
 
-	if len(addCrosshair.Note) < lenNoteMin {
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusBadRequest
 		resp.Error.ErrorCode = "invalid_request"
-		resp.Error.ErrorMessage = fmt.Sprintf("Crosshair note needs to be at least %d characters long.", lenNoteMin)
+		resp.Error.ErrorMessage = "Could not parse user id."
 		resp.SendErrorResponse(c)
 		return
 	}
 
-	crosshair := &database.Crosshair{
-		RegistrantID: userUID,
-		Code:         addCrosshair.Code,
-		Note:         addCrosshair.Note,
-		RegisterIP:   c.Request.Header.Get("X-Forwarded-For"),
+	chsOnRecord, ok := addCrosshairForUser(c, userUID, code, generateCrosshair.Note)
+	if !ok {
+		return
 	}
 
-	_, err = Svc.AddCrosshair(crosshair)
+	generated.Saved = true
+	generated.CHsOnRecord = chsOnRecord
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusCreated,
+		Data: generated,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Validates and saves a crosshair for the specified user.
+//
+// Sends an error response and returns false if the crosshair could not be added.
+// Returns the amount of crosshairs the user has on record after adding it otherwise.
+func addCrosshairForUser(c *gin.Context, userUID uuid.UUID, code, note string) (int, bool) {
+	user, err := Svc.GetUserByUID(&database.UserAccount{ID: userUID})
 	if err != nil {
 		errString := database.CheckDatabaseError(err)
 		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusInternalServerError
-		resp.Error.ErrorCode = "internal_error"
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
 		resp.Error.ErrorMessage = errString
 		resp.SendErrorResponse(c)
-		return
+		return 0, false
+	}
+
+	if resp := saveCrosshair(user, code, note, c.Request.Header.Get("X-Forwarded-For")); resp != nil {
+		resp.SendErrorResponse(c)
+		return 0, false
+	}
+
+	return user.CrosshairsRegistered, true
+}
+
+// Validates and saves a crosshair for the user and increments user.CrosshairsRegistered.
+//
+// Returns the error response to send if the crosshair could not be added, nil otherwise.
+// Does not send anything itself so it can be used to save multiple crosshairs at once.
+func saveCrosshair(user *database.UserAccount, code, note, registerIP string) *responses.ErrorResponse {
+	return saveCrosshairFrom(user, &database.Crosshair{Code: code, Note: note, RegisterIP: registerIP})
+}
+
+// Like saveCrosshair but takes the crosshair to save, e.g. to keep the attribution of a copied crosshair.
+//
+// Owner, settings and visibility are set on the crosshair before saving it.
+func saveCrosshairFrom(user *database.UserAccount, crosshair *database.Crosshair) *responses.ErrorResponse {
+	settings, err := sharecode.Decode(crosshair.Code)
+	if err != nil {
+		resp := &responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("Invalid crosshair code provided: %s.", err.Error())
+		return resp
+	}
+
+	if len(crosshair.Note) < lenNoteMin {
+		resp := &responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("Crosshair note needs to be at least %d characters long.", lenNoteMin)
+		return resp
 	}
 
-	user, err = Svc.UpdateUserCrosshairCount(&database.UserAccount{ID: userUID})
+	crosshair.RegistrantID = user.ID
+	crosshair.Settings = *settings
+	crosshair.Visibility = database.VisibilityPrivate
+
+	_, err = Svc.AddCrosshair(crosshair)
 	if err != nil {
+		if errors.Is(err, database.ErrQuotaExceeded) {
+			resp := &responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = "Already registered maximum number of crosshairs."
+			return resp
+		}
+
 		errString := database.CheckDatabaseError(err)
-		resp := responses.ErrorResponse{}
+		resp := &responses.ErrorResponse{}
 		resp.Code = http.StatusInternalServerError
 		resp.Error.ErrorCode = "internal_error"
 		resp.Error.ErrorMessage = errString
-		resp.SendErrorResponse(c)
-		return
+		return resp
 	}
 
-	resp := responses.SuccessResponse{
-		Code: http.StatusCreated,
-		Data: responses.CrosshairResponse{
-			Status:      "Successfully added crosshair",
-			CHsOnRecord: user.CrosshairsRegistered + 1,
-		},
+	user.CrosshairsRegistered++
+
+	// There is no request here, the crosshair is saved already so a missing event is only logged.
+	event := database.NewEvent(database.CrosshairAdded, &user.ID, database.CrosshairPayload{CrosshairID: &crosshair.ID, Code: crosshair.Code})
+	event.Data.IssuerIP = crosshair.RegisterIP
+	if _, err := Svc.AddEvent(event); err != nil {
+		log.Printf("%s Error adding event for crosshair %s: %s\n", logging.ErrSign, crosshair.Code, err.Error())
 	}
-	resp.SendSuccessReponse(c)
+
+	// Previews are rendered in the background, a missing preview should not prevent users from saving their crosshair.
+	if _, err := Jobs.Submit(context.Background(), JobRenderPreview, user.ID, renderPreviewPayload{Code: crosshair.Code}); err != nil {
+		log.Printf("%s Error submitting preview job for crosshair %s: %s\n", logging.ErrSign, crosshair.Code, err.Error())
+	}
+
+	return nil
 }
 
 func GetAllCrosshairsFromUserRoute(c *gin.Context) {
@@ -195,12 +310,8 @@ func GetAllCrosshairsFromUserRoute(c *gin.Context) {
 		}
 
 		for _, ch := range crosshairs {
-			var crosshair models.Crosshair
 			if ch.Code == crosshairCode {
-				crosshair.ID = ch.ID
-				crosshair.Added = ch.CreatedAt
-				crosshair.Code = ch.Code
-				crosshair.Note = ch.Note
+				crosshair := crosshairModel(ch)
 
 				resp := responses.SuccessResponse{}
 				resp.Code = http.StatusOK
@@ -245,12 +356,8 @@ func GetAllCrosshairsFromUserRoute(c *gin.Context) {
 		var returnCrosshairs []models.Crosshair
 
 		for _, ch := range crosshairs {
-			var crosshair models.Crosshair
 			if ch.CreatedAt.After(startTime) && ch.CreatedAt.Before(endTime) {
-				crosshair.ID = ch.ID
-				crosshair.Added = ch.CreatedAt
-				crosshair.Code = ch.Code
-				crosshair.Note = ch.Note
+				crosshair := crosshairModel(ch)
 				returnCrosshairs = append(returnCrosshairs, crosshair)
 			}
 		}
@@ -275,11 +382,7 @@ func GetAllCrosshairsFromUserRoute(c *gin.Context) {
 	var returnCrosshairs []models.Crosshair
 
 	for _, ch := range crosshairs {
-		var crosshair models.Crosshair
-		crosshair.ID = ch.ID
-		crosshair.Added = ch.CreatedAt
-		crosshair.Code = ch.Code
-		crosshair.Note = ch.Note
+		crosshair := crosshairModel(ch)
 		returnCrosshairs = append(returnCrosshairs, crosshair)
 	}
 
@@ -325,6 +428,10 @@ func DeleteOneOrMultipleCrosshairs(c *gin.Context) {
 			return
 		}
 
+		if !addEvent(c, database.NewEvent(database.CrosshairDeleted, &userUID, database.CrosshairPayload{Code: code})) {
+			return
+		}
+
 		resp := responses.SuccessResponse{
 			Code: http.StatusNoContent,
 		}
@@ -342,8 +449,764 @@ func DeleteOneOrMultipleCrosshairs(c *gin.Context) {
 		return
 	}
 
+	// No payload, all crosshairs of the user have been deleted.
+	if !addEvent(c, database.NewEvent(database.CrosshairDeleted, &userUID, nil)) {
+		return
+	}
+
 	resp := responses.SuccessResponse{
 		Code: http.StatusNoContent,
 	}
 	resp.SendSuccessReponse(c)
 }
+
+func crosshairModel(ch *database.Crosshair) models.Crosshair {
+	crosshair := models.Crosshair{
+		ID:         ch.ID,
+		Added:      ch.CreatedAt,
+		Code:       ch.Code,
+		Note:       ch.Note,
+		Settings:   ch.Settings,
+		PreviewURL: publicObjectURL(ch.PreviewURL),
+		Visibility: string(ch.Visibility),
+	}
+
+	if ch.Slug != nil {
+		crosshair.Slug = *ch.Slug
+	}
+
+	crosshair.Tags = tagNames(ch.Tags)
+
+	crosshair.SourceCrosshairID = ch.SourceCrosshairID
+	crosshair.OriginalAuthor = ch.OriginalAuthorName
+
+	return crosshair
+}
+
+func tagNames(tags []database.Tag) []string {
+	names := []string{}
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+// Lowercases and validates tags, duplicates are removed.
+func normalizeTags(tags []string) ([]string, error) {
+	var normalized []string
+	seen := make(map[string]bool)
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+
+		if !tagRegex.MatchString(tag) {
+			return nil, fmt.Errorf("tag %q needs to be 2 to 24 characters long and may only contain letters, numbers and -", tag)
+		}
+
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+
+		normalized = append(normalized, tag)
+	}
+
+	if len(normalized) > tagsMax {
+		return nil, fmt.Errorf("a crosshair may only have up to %d tags", tagsMax)
+	}
+
+	return normalized, nil
+}
+
+// Renders the crosshair preview and uploads it to storage, returns the preview link.
+func renderCrosshairPreview(code string, settings *sharecode.Settings) (string, error) {
+	data, err := preview.RenderPNG(settings)
+	if err != nil {
+		return "", err
+	}
+
+	return StorageSvc.UploadCrosshairPreview(code, data)
+}
+
+func ExportCrosshairConfigRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshairCode := c.Query("code")
+	if crosshairCode == "" {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Missing crosshair code."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshairs, err := Svc.GetAllCrosshairsFromUser(userUID)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	for _, ch := range crosshairs {
+		if ch.Code != crosshairCode {
+			continue
+		}
+
+		config := ch.Settings.Config(fmt.Sprintf("%s - %s", ch.Code, ch.Note))
+
+		if c.Query("download") == "true" {
+			c.Header("Content-Disposition", "attachment; filename=crosshair.cfg")
+			c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(config))
+			return
+		}
+
+		resp := responses.SuccessResponse{
+			Code: http.StatusOK,
+			Data: responses.CrosshairConfigResponse{
+				Code:   ch.Code,
+				Note:   ch.Note,
+				Config: config,
+			},
+		}
+		resp.SendSuccessReponse(c)
+		return
+	}
+
+	resp := responses.ErrorResponse{}
+	resp.Code = http.StatusNotFound
+	resp.Error.ErrorCode = "not_found"
+	resp.Error.ErrorMessage = "No matching crosshair found."
+	resp.SendErrorResponse(c)
+}
+
+func ImportCrosshairConfigRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var importConfig models.ImportCrosshairConfig
+
+	if err := c.BindJSON(&importConfig); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	settings, err := sharecode.ParseCommands(importConfig.Config)
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("Could not parse config: %s.", err.Error())
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	code, err := sharecode.Encode(settings)
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("Invalid crosshair settings provided: %s.", err.Error())
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	chsOnRecord, ok := addCrosshairForUser(c, userUID, code, importConfig.Note)
+	if !ok {
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusCreated,
+		Data: responses.GenerateCrosshairResponse{
+			Code:        code,
+			Commands:    settings.Commands(),
+			Saved:       true,
+			CHsOnRecord: chsOnRecord,
+		},
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Reads the crosshairs of all players from an uploaded CS:GO demo.
+//
+// Demos are way larger than the multipart memory limit of the engine and take a while
+// to upload, so the body is streamed to a temporary file instead of using FormFile.
+// Parsing happens in a background job, the response contains the job to poll.
+func UploadDemoRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	// The server wide read timeout is way too short for uploading a demo.
+	rc := http.NewResponseController(c.Writer)
+	if err := rc.SetReadDeadline(time.Now().Add(demoUploadTimeout)); err != nil {
+		log.Printf("%s Could not extend read deadline for demo upload: %s\n", logging.WarnSign, err.Error())
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, demoMaxSize)
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Expected multipart form data."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var demoPath string
+
+	for demoPath == "" {
+		part, err := reader.NextPart()
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				resp := responses.ErrorResponse{}
+				resp.Code = http.StatusRequestEntityTooLarge
+				resp.Error.ErrorCode = "invalid_request"
+				resp.Error.ErrorMessage = fmt.Sprintf("Demo exceeds maximum size of %d MiB.", demoMaxSize>>20)
+				resp.SendErrorResponse(c)
+				return
+			}
+
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = "Missing form file in request."
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		if part.FormName() != "demo" {
+			continue
+		}
+
+		if strings.ToLower(filepath.Ext(part.FileName())) != ".dem" {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = "File needs to be a .dem file."
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		demoPath, err = saveDemoUpload(part)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+
+			switch {
+			case errors.As(err, &maxBytesErr):
+				resp := responses.ErrorResponse{}
+				resp.Code = http.StatusRequestEntityTooLarge
+				resp.Error.ErrorCode = "invalid_request"
+				resp.Error.ErrorMessage = fmt.Sprintf("Demo exceeds maximum size of %d MiB.", demoMaxSize>>20)
+				resp.SendErrorResponse(c)
+			case errors.Is(err, demo.ErrUnsupportedDemo):
+				resp := responses.ErrorResponse{}
+				resp.Code = http.StatusBadRequest
+				resp.Error.ErrorCode = "unsupported_demo"
+				resp.Error.ErrorMessage = "CS2 demos are not supported yet, only CS:GO demos can be read."
+				resp.SendErrorResponse(c)
+			case errors.Is(err, demo.ErrInvalidDemo):
+				resp := responses.ErrorResponse{}
+				resp.Code = http.StatusBadRequest
+				resp.Error.ErrorCode = "invalid_request"
+				resp.Error.ErrorMessage = fmt.Sprintf("Could not read demo: %s.", err.Error())
+				resp.SendErrorResponse(c)
+			default:
+				log.Printf("%s Error saving demo upload: %s\n", logging.ErrSign, err.Error())
+				resp := responses.ErrorResponse{}
+				resp.Code = http.StatusInternalServerError
+				resp.Error.ErrorCode = "internal_error"
+				resp.Error.ErrorMessage = "Something went wrong, sorry."
+				resp.SendErrorResponse(c)
+			}
+			return
+		}
+	}
+
+	job, err := Jobs.Submit(c, JobParseDemo, userUID, parseDemoPayload{Path: demoPath})
+	if err != nil {
+		_ = os.Remove(demoPath)
+
+		log.Printf("%s Error submitting demo job: %s\n", logging.ErrSign, err.Error())
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Something went wrong, sorry."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/api/jobs/%s", job.ID.String()))
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusAccepted,
+		Data: jobModel(job),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Writes the uploaded demo to a temporary file and checks its header, returns the file path.
+func saveDemoUpload(r io.Reader) (string, error) {
+	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp(tmpDir, "demo-*.dem")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, r); err != nil {
+		_ = os.Remove(file.Name())
+		return "", err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		_ = os.Remove(file.Name())
+		return "", err
+	}
+
+	if _, err := demo.ReadHeader(file); err != nil {
+		_ = os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+func demoCrosshairsModel(result *demo.Result) models.DemoCrosshairs {
+	demoCrosshairs := models.DemoCrosshairs{
+		Demo: models.DemoInfo{
+			Map:          result.Header.MapName,
+			Server:       result.Header.ServerName,
+			Client:       result.Header.ClientName,
+			PlaybackTime: result.Header.PlaybackTime,
+			Ticks:        result.Header.Ticks,
+		},
+		Players: []models.DemoPlayer{},
+	}
+
+	for _, player := range result.Players {
+		demoPlayer := models.DemoPlayer{
+			Name:      player.Name,
+			SteamID64: strconv.FormatUint(player.SteamID64, 10),
+			IsBot:     player.IsBot,
+		}
+
+		if player.CrosshairCode != "" {
+			demoPlayer.Crosshair = demoCrosshairModel(player.CrosshairCode)
+		}
+
+		demoCrosshairs.Players = append(demoCrosshairs.Players, demoPlayer)
+	}
+
+	return demoCrosshairs
+}
+
+// The demo parser only returns codes which passed validation, decoding can not fail here.
+func demoCrosshairModel(code string) *models.DemoCrosshair {
+	settings, _ := sharecode.Decode(code)
+	return &models.DemoCrosshair{Code: code, Settings: *settings}
+}
+
+// Saves the crosshairs the user picked from a demo in one request.
+//
+// Every crosshair is handled on its own, crosshairs which fail validation (or exceed
+// the limit) are reported in the results without preventing the others from being saved.
+func SaveDemoCrosshairsRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var saveCrosshairs models.SaveCrosshairs
+
+	if err := c.BindJSON(&saveCrosshairs); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if len(saveCrosshairs.Crosshairs) == 0 {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "No crosshairs provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	user, err := Svc.GetUserByUID(&database.UserAccount{ID: userUID})
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	saved := responses.SaveCrosshairsResponse{}
+
+	for _, ch := range saveCrosshairs.Crosshairs {
+		note := ch.Note
+		if note == "" {
+			note = demoDefaultNote
+		}
+
+		result := responses.SavedCrosshair{Code: ch.Code}
+
+		if errResp := saveCrosshair(user, ch.Code, note, c.Request.Header.Get("X-Forwarded-For")); errResp != nil {
+			result.Error = errResp.Error.ErrorMessage
+		} else {
+			result.Saved = true
+		}
+
+		saved.Results = append(saved.Results, result)
+	}
+
+	saved.CHsOnRecord = user.CrosshairsRegistered
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusCreated,
+		Data: saved,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func UpdateCrosshairVisibilityRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var updateVisibility models.UpdateCrosshairVisibility
+
+	if err := c.BindJSON(&updateVisibility); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	visibility := database.CrosshairVisibility(updateVisibility.Visibility)
+	if !visibility.IsValid() {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Visibility needs to be one of private, unlisted or public."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshair, err := Svc.GetCrosshairFromUserByCode(userUID, updateVisibility.Code)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusNotFound
+		resp.Error.ErrorCode = "not_found"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshair.Visibility = visibility
+
+	if _, err := Svc.UpdateCrosshairVisibility(crosshair); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: crosshairModel(crosshair),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Returns the share link of a crosshair, the slug is only generated on the first request.
+//
+// Private crosshairs become unlisted since they could not be opened with the link otherwise.
+func ShareCrosshairRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var shareCrosshair models.ShareCrosshair
+
+	if err := c.BindJSON(&shareCrosshair); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshair, err := Svc.GetCrosshairFromUserByCode(userUID, shareCrosshair.Code)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusNotFound
+		resp.Error.ErrorCode = "not_found"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if crosshair.Slug == nil {
+		if err := generateCrosshairSlug(crosshair); err != nil {
+			errString := database.CheckDatabaseError(err)
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusInternalServerError
+			resp.Error.ErrorCode = "internal_error"
+			resp.Error.ErrorMessage = errString
+			resp.SendErrorResponse(c)
+			return
+		}
+	}
+
+	if crosshair.Visibility == database.VisibilityPrivate {
+		crosshair.Visibility = database.VisibilityUnlisted
+
+		if _, err := Svc.UpdateCrosshairVisibility(crosshair); err != nil {
+			errString := database.CheckDatabaseError(err)
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusInternalServerError
+			resp.Error.ErrorCode = "internal_error"
+			resp.Error.ErrorMessage = errString
+			resp.SendErrorResponse(c)
+			return
+		}
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: responses.ShareCrosshairResponse{
+			Slug:       *crosshair.Slug,
+			Visibility: string(crosshair.Visibility),
+			Link:       fmt.Sprintf("%s/api/share/%s", strings.TrimSuffix(CFG.Domain, "/"), *crosshair.Slug),
+		},
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Sets a new random slug on the crosshair, retries a few times in case the slug is already taken.
+func generateCrosshairSlug(crosshair *database.Crosshair) error {
+	var err error
+
+	for i := 0; i < slugAttempts; i++ {
+		slug := utils.RandomString(slugLength)
+		crosshair.Slug = &slug
+
+		_, err = Svc.UpdateCrosshairSlug(crosshair)
+		if !database.IsDuplicateError(err) {
+			break
+		}
+	}
+
+	if err != nil {
+		crosshair.Slug = nil
+	}
+
+	return err
+}
+
+func SetCrosshairTagsRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var setTags models.SetCrosshairTags
+
+	if err := c.BindJSON(&setTags); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	tags, err := normalizeTags(setTags.Tags)
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("Invalid tags provided: %s.", err.Error())
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshair, err := Svc.GetCrosshairFromUserByCode(userUID, setTags.Code)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusNotFound
+		resp.Error.ErrorCode = "not_found"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshair, err = Svc.SetCrosshairTags(crosshair, tags)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: crosshairModel(crosshair),
+	}
+	resp.SendSuccessReponse(c)
+}
@@ -3,19 +3,28 @@ package routes
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/devusSs/crosshairs/api/responses"
 	"github.com/devusSs/crosshairs/config"
 	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/jobs"
 	"github.com/devusSs/crosshairs/storage"
+	"github.com/devusSs/crosshairs/webhooks"
 )
 
 var (
 	Svc        database.Service
 	StorageSvc *storage.Service
+	Jobs       *jobs.Service
+	Webhooks   *webhooks.Service
 	CFG        *config.Config
+
+	// Set by the Twitch integration if it is enabled, disconnects the bot from the channel of the Twitch login.
+	// Safe to call from background jobs like the account purge.
+	DisconnectTwitchBot func(login string)
 )
 
 func NotFoundRoute(c *gin.Context) {
@@ -40,3 +49,10 @@ func HomeRoute(c *gin.Context) {
 	resp.Data = gin.H{"message": "Welcome to the Crosshairs API!"}
 	c.JSON(resp.Code, resp)
 }
+
+// Object links point to the internal MinIO host when running in Docker.
+//
+// Relevant for Docker only.
+func publicObjectURL(url string) string {
+	return strings.Replace(url, "http://minio:", fmt.Sprintf("http://%s:", "localhost"), 1)
+}
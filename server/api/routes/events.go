@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/devusSs/crosshairs/api/middleware"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Fills in the request data of the event and stores it, also used by the integrations.
+func RecordEvent(c *gin.Context, event *database.Event) error {
+	event.Data.URL = c.Request.RequestURI
+	event.Data.Method = c.Request.Method
+
+	if UsingReverseProxy {
+		event.Data.IssuerIP = c.Request.Header.Get("X-Forwarded-For")
+	} else {
+		event.Data.IssuerIP = c.RemoteIP()
+	}
+
+	_, err := Svc.AddEvent(event)
+	return err
+}
+
+// Records the event, sends an error response if that fails.
+func addEvent(c *gin.Context, event *database.Event) bool {
+	if err := RecordEvent(c, event); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return false
+	}
+	return true
+}
+
+// Records an action of the logged in admin on another user.
+func addAdminEvent(c *gin.Context, eventType database.EventType, target *database.UserAccount, payload database.AdminActionPayload) bool {
+	if actor, ok := middleware.CurrentUser(c); ok {
+		payload.ActorID = actor.ID
+	}
+	return addEvent(c, database.NewEvent(eventType, &target.ID, payload))
+}
+
+// Records a failed login, userID is nil if there is no user with the e-mail address.
+func addLoginFailedEvent(c *gin.Context, email string, userID *uuid.UUID, reason string) bool {
+	return addEvent(c, database.NewEvent(database.UserLoginFailed, userID, database.LoginFailedPayload{EMail: email, Reason: reason}))
+}
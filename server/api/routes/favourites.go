@@ -0,0 +1,396 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/devusSs/crosshairs/api/models"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/logging"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func AddFavouriteRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var favouriteCrosshair models.FavouriteCrosshair
+
+	if err := c.BindJSON(&favouriteCrosshair); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshair, errResp := findSharedCrosshair(favouriteCrosshair.ID, favouriteCrosshair.Slug)
+	if errResp != nil {
+		errResp.SendErrorResponse(c)
+		return
+	}
+
+	if crosshair.RegistrantID == userUID {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "You can not save your own crosshair."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	added, err := Svc.AddFavourite(&database.Favourite{UserID: userUID, CrosshairID: crosshair.ID})
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	code := http.StatusOK
+	if added {
+		code = http.StatusCreated
+		crosshair.SaveCount++
+	}
+
+	owner, err := Svc.GetUserByUID(&database.UserAccount{ID: crosshair.RegistrantID})
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: code,
+		Data: galleryCrosshairModel(crosshair, displayName(owner)),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func GetFavouritesRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshairs, err := Svc.GetFavouriteCrosshairs(userUID)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	owners, err := crosshairOwnerNames(crosshairs)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	favourites := models.FavouriteCrosshairs{Crosshairs: []models.GalleryCrosshair{}}
+
+	for _, ch := range crosshairs {
+		favourites.Crosshairs = append(favourites.Crosshairs, galleryCrosshairModel(ch, owners[ch.RegistrantID]))
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: favourites,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func DeleteFavouriteRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshairID, err := uuid.Parse(c.Query("id"))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid crosshair id provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	deleted, err := Svc.DeleteFavourite(&database.Favourite{UserID: userUID, CrosshairID: crosshairID})
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !deleted {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusNotFound
+		resp.Error.ErrorCode = "not_found"
+		resp.Error.ErrorMessage = "No matching favourite found."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: "Successfully removed favourite.",
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Copies another user's public or unlisted crosshair into the list of the logged in user.
+//
+// The copy keeps a reference to its source and the original author, copies of copies
+// are attributed to the author of the first crosshair.
+func CopyCrosshairRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var copyCrosshair models.CopyCrosshair
+
+	if err := c.BindJSON(&copyCrosshair); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	source, errResp := findSharedCrosshair(copyCrosshair.ID, copyCrosshair.Slug)
+	if errResp != nil {
+		errResp.SendErrorResponse(c)
+		return
+	}
+
+	if source.RegistrantID == userUID {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "You can not save your own crosshair."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	_, err = Svc.GetCrosshairFromUserByCode(userUID, source.Code)
+	if err == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "You already saved this crosshair."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !database.IsNotFoundError(err) {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	user, err := Svc.GetUserByUID(&database.UserAccount{ID: userUID})
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshair := &database.Crosshair{
+		Code:               source.Code,
+		Note:               copyCrosshair.Note,
+		PreviewURL:         source.PreviewURL,
+		SourceCrosshairID:  &source.ID,
+		OriginalAuthorID:   source.OriginalAuthorID,
+		OriginalAuthorName: source.OriginalAuthorName,
+		RegisterIP:         c.Request.Header.Get("X-Forwarded-For"),
+	}
+
+	if crosshair.Note == "" {
+		crosshair.Note = source.Note
+	}
+
+	if crosshair.OriginalAuthorID == nil {
+		owner, err := Svc.GetUserByUID(&database.UserAccount{ID: source.RegistrantID})
+		if err != nil {
+			errString := database.CheckDatabaseError(err)
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusInternalServerError
+			resp.Error.ErrorCode = "internal_error"
+			resp.Error.ErrorMessage = errString
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		crosshair.OriginalAuthorID = &owner.ID
+		crosshair.OriginalAuthorName = displayName(owner)
+	}
+
+	if errResp := saveCrosshairFrom(user, crosshair); errResp != nil {
+		errResp.SendErrorResponse(c)
+		return
+	}
+
+	// The copy is saved already, a wrong counter should not fail the request.
+	// Users deleting and copying a crosshair again are only counted once.
+	if _, err := Svc.AddCrosshairCopy(&database.CrosshairCopy{UserID: userUID, CrosshairID: source.ID}); err != nil {
+		log.Printf("%s Error incrementing save count of crosshair %s: %s\n", logging.ErrSign, source.ID, err.Error())
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusCreated,
+		Data: models.CopiedCrosshair{
+			Crosshair:   crosshairModel(crosshair),
+			CHsOnRecord: user.CrosshairsRegistered,
+		},
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Finds a crosshair other users may see by its id or share slug.
+//
+// Private crosshairs are treated as non existent.
+func findSharedCrosshair(id, slug string) (*database.Crosshair, *responses.ErrorResponse) {
+	var crosshair *database.Crosshair
+	var err error
+
+	switch {
+	case id != "":
+		crosshairID, parseErr := uuid.Parse(id)
+		if parseErr != nil {
+			resp := &responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = "Invalid crosshair id provided."
+			return nil, resp
+		}
+		crosshair, err = Svc.GetCrosshairByID(crosshairID)
+	case slug != "":
+		crosshair, err = Svc.GetCrosshairBySlug(slug)
+	default:
+		resp := &responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Either id or slug needs to be provided."
+		return nil, resp
+	}
+
+	if err != nil && !database.IsNotFoundError(err) {
+		errString := database.CheckDatabaseError(err)
+		resp := &responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		return nil, resp
+	}
+
+	if database.IsNotFoundError(err) || crosshair.Visibility == database.VisibilityPrivate {
+		resp := &responses.ErrorResponse{}
+		resp.Code = http.StatusNotFound
+		resp.Error.ErrorCode = "not_found"
+		resp.Error.ErrorMessage = "No matching crosshair found."
+		return nil, resp
+	}
+
+	return crosshair, nil
+}
@@ -0,0 +1,194 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/devusSs/crosshairs/api/models"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	galleryLimitDefault = 20
+	galleryLimitMax     = 100
+)
+
+// Lists public crosshairs, does not need a session.
+//
+// Query parameters (all optional): q, tags (comma separated), style, color,
+// min_size, max_size, sort (newest, most_saved), cursor and limit.
+func GetGalleryRoute(c *gin.Context) {
+	query, err := parseGalleryQuery(c)
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = err.Error()
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshairs, nextCursor, err := Svc.GetPublicCrosshairs(query)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = "Invalid cursor provided."
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	owners, err := crosshairOwnerNames(crosshairs)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	page := models.GalleryPage{
+		Crosshairs: []models.GalleryCrosshair{},
+		NextCursor: nextCursor,
+	}
+
+	for _, ch := range crosshairs {
+		page.Crosshairs = append(page.Crosshairs, galleryCrosshairModel(ch, owners[ch.RegistrantID]))
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: page,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func parseGalleryQuery(c *gin.Context) (*database.GalleryQuery, error) {
+	query := &database.GalleryQuery{
+		Search: strings.TrimSpace(c.Query("q")),
+		Cursor: c.Query("cursor"),
+		Sort:   database.SortNewest,
+		Limit:  galleryLimitDefault,
+	}
+
+	if tags := c.Query("tags"); tags != "" {
+		normalized, err := normalizeTags(strings.Split(tags, ","))
+		if err != nil {
+			return nil, errors.New("Invalid tags provided.")
+		}
+		query.Tags = normalized
+	}
+
+	for _, param := range []struct {
+		name  string
+		value **int
+	}{
+		{"style", &query.Style},
+		{"color", &query.Color},
+	} {
+		raw := c.Query(param.name)
+		if raw == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, errors.New("Invalid " + param.name + " provided.")
+		}
+		*param.value = &parsed
+	}
+
+	for _, param := range []struct {
+		name  string
+		value **float64
+	}{
+		{"min_size", &query.MinSize},
+		{"max_size", &query.MaxSize},
+	} {
+		raw := c.Query(param.name)
+		if raw == "" {
+			continue
+		}
+
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, errors.New("Invalid " + param.name + " provided.")
+		}
+		*param.value = &parsed
+	}
+
+	if sort := c.Query("sort"); sort != "" {
+		switch database.GallerySort(sort) {
+		case database.SortNewest, database.SortMostSaved:
+			query.Sort = database.GallerySort(sort)
+		default:
+			return nil, errors.New("Sort needs to be one of newest or most_saved.")
+		}
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > galleryLimitMax {
+			return nil, errors.New("Limit needs to be between 1 and " + strconv.Itoa(galleryLimitMax) + ".")
+		}
+		query.Limit = parsed
+	}
+
+	return query, nil
+}
+
+func galleryCrosshairModel(ch *database.Crosshair, owner string) models.GalleryCrosshair {
+	return models.GalleryCrosshair{
+		ID:         ch.ID,
+		Added:      ch.CreatedAt,
+		Code:       ch.Code,
+		Note:       ch.Note,
+		Settings:   ch.Settings,
+		PreviewURL: publicObjectURL(ch.PreviewURL),
+		Tags:       tagNames(ch.Tags),
+		SaveCount:  ch.SaveCount,
+		Owner:      owner,
+	}
+}
+
+// Fetches the display names of the owners of all crosshairs at once.
+func crosshairOwnerNames(crosshairs []*database.Crosshair) (map[uuid.UUID]string, error) {
+	names := make(map[uuid.UUID]string)
+
+	if len(crosshairs) == 0 {
+		return names, nil
+	}
+
+	var ids []uuid.UUID
+	for _, ch := range crosshairs {
+		ids = append(ids, ch.RegistrantID)
+	}
+
+	users, err := Svc.GetUsersByUIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		names[user.ID] = displayName(user)
+	}
+
+	return names, nil
+}
@@ -0,0 +1,176 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/devusSs/crosshairs/api/models"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/demo"
+	"github.com/devusSs/crosshairs/jobs"
+	"github.com/devusSs/crosshairs/sharecode"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Job types submitted by routes.
+const (
+	JobParseDemo     = "parse_demo"
+	JobRenderPreview = "render_preview"
+)
+
+type parseDemoPayload struct {
+	Path string `json:"path"`
+}
+
+type renderPreviewPayload struct {
+	Code string `json:"code"`
+}
+
+type renderPreviewResult struct {
+	PreviewURL string `json:"preview_url"`
+}
+
+// Registers the handlers of all job types the routes submit.
+func RegisterJobHandlers(svc *jobs.Service) {
+	svc.Register(JobParseDemo, parseDemoJob)
+	svc.Register(JobRenderPreview, renderPreviewJob)
+}
+
+// Parses an uploaded demo, the result is the same as models.DemoCrosshairs.
+//
+// The demo file is removed once it is not needed for another attempt anymore.
+func parseDemoJob(ctx context.Context, job *jobs.Job) (result interface{}, err error) {
+	var payload parseDemoPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, jobs.Permanent(err)
+	}
+
+	defer func() {
+		var retryable bool
+		if err != nil {
+			retryable = !job.LastAttempt() && !errors.Is(err, demo.ErrInvalidDemo) && !errors.Is(err, demo.ErrUnsupportedDemo)
+		}
+
+		if !retryable {
+			_ = os.Remove(payload.Path)
+		}
+	}()
+
+	file, err := os.Open(payload.Path)
+	if err != nil {
+		return nil, jobs.Permanent(err)
+	}
+	defer file.Close()
+
+	parsed, err := demo.Parse(file)
+	if err != nil {
+		if errors.Is(err, demo.ErrInvalidDemo) || errors.Is(err, demo.ErrUnsupportedDemo) {
+			return nil, jobs.Permanent(err)
+		}
+		return nil, err
+	}
+
+	return demoCrosshairsModel(parsed), nil
+}
+
+// Renders the preview of a crosshair and sets it on all crosshairs with the same code.
+func renderPreviewJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	var payload renderPreviewPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, jobs.Permanent(err)
+	}
+
+	settings, err := sharecode.Decode(payload.Code)
+	if err != nil {
+		return nil, jobs.Permanent(err)
+	}
+
+	previewURL, err := renderCrosshairPreview(payload.Code, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Svc.UpdateCrosshairPreviewURL(payload.Code, previewURL); err != nil {
+		return nil, err
+	}
+
+	return renderPreviewResult{PreviewURL: publicObjectURL(previewURL)}, nil
+}
+
+func GetJobRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid job id provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	job, err := Jobs.Get(c, jobID)
+	if err != nil && !errors.Is(err, jobs.ErrJobNotFound) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Something went wrong, sorry."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	// Jobs of other users are treated as non existent.
+	if errors.Is(err, jobs.ErrJobNotFound) || job.UserID != userUID {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusNotFound
+		resp.Error.ErrorCode = "not_found"
+		resp.Error.ErrorMessage = "No matching job found."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: jobModel(job),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func jobModel(job *jobs.Job) models.Job {
+	return models.Job{
+		ID:        job.ID,
+		Type:      job.Type,
+		Status:    string(job.Status),
+		Attempts:  job.Attempts,
+		Result:    job.Result,
+		Error:     job.Error,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+}
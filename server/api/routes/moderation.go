@@ -0,0 +1,328 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/devusSs/crosshairs/api/middleware"
+	"github.com/devusSs/crosshairs/api/models"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/storage"
+	"github.com/devusSs/crosshairs/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const lenSuspensionReasonMax = 256
+
+// Suspends the user until the given time or bans them if no time is given.
+//
+// Their session is removed on their next request.
+func SuspendUserRoute(c *gin.Context) {
+	user, ok := moderatedUserFromQuery(c)
+	if !ok {
+		return
+	}
+
+	var suspend models.SuspendUser
+
+	if err := c.BindJSON(&suspend); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid request body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	suspend.Reason = strings.TrimSpace(suspend.Reason)
+
+	if suspend.Reason == "" || len(suspend.Reason) > lenSuspensionReasonMax {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Reason must not be empty or longer than 256 characters."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if suspend.Until != nil && !suspend.Until.After(time.Now()) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Suspension must end in the future."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if err := Svc.SuspendUser(user.ID, suspend.Until, suspend.Reason); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	eventType := database.AdminSuspendedUser
+	if suspend.Until == nil {
+		eventType = database.AdminBannedUser
+	}
+
+	if !addAdminEvent(c, eventType, user, database.AdminActionPayload{Reason: suspend.Reason, Until: suspend.Until}) {
+		return
+	}
+
+	now := time.Now()
+	after := *user
+	after.SuspendedAt = &now
+	after.SuspendedUntil = suspend.Until
+	after.SuspensionReason = suspend.Reason
+	auditUserChange(c, "user.suspend", user, &after)
+
+	resp := responses.SuccessResponse{}
+	resp.Code = http.StatusNoContent
+	resp.SendSuccessReponse(c)
+}
+
+// Lifts a suspension or ban.
+func UnsuspendUserRoute(c *gin.Context) {
+	user, ok := moderatedUserFromQuery(c)
+	if !ok {
+		return
+	}
+
+	if err := Svc.UnsuspendUser(user.ID); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !addAdminEvent(c, database.AdminUnsuspendedUser, user, database.AdminActionPayload{}) {
+		return
+	}
+
+	after := *user
+	after.SuspendedAt = nil
+	after.SuspendedUntil = nil
+	after.SuspensionReason = ""
+	auditUserChange(c, "user.unsuspend", user, &after)
+
+	resp := responses.SuccessResponse{}
+	resp.Code = http.StatusNoContent
+	resp.SendSuccessReponse(c)
+}
+
+// Logs the user out and sends them a password reset mail, they can not log in before resetting their password.
+func ForcePasswordResetRoute(c *gin.Context) {
+	user, ok := moderatedUserFromQuery(c)
+	if !ok {
+		return
+	}
+
+	before := *user
+
+	user.PasswordResetCode = utils.RandomString(25)
+	user.PasswordResetCodeTime = time.Now()
+	user.PasswordResetRequired = true
+
+	if err := Svc.RequirePasswordReset(user); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !addAdminEvent(c, database.AdminForcedPassReset, user, database.AdminActionPayload{}) {
+		return
+	}
+
+	auditUserChange(c, "user.password_reset", &before, user)
+
+	if err := utils.SendVerificationMail(user, resetPasswordMailData(user.EMail, user.PasswordResetCode)); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Password reset is required now but the e-mail could not be sent."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: responses.GeneralUserResponse{
+			Message: "User has to reset their password, an e-mail has been sent.",
+		},
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Deletes the account with its crosshairs, collections, favourites, avatar and Twitch tokens and disconnects the Twitch bot.
+func DeleteUserRoute(c *gin.Context) {
+	user, ok := moderatedUserFromQuery(c)
+	if !ok {
+		return
+	}
+
+	// The avatar is removed first, the account would be gone if removing it failed afterwards.
+	if user.AvatarURL != "" {
+		if err := StorageSvc.DeleteUserProfilePicture(user.ID.String()); err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusInternalServerError
+			resp.Error.ErrorCode = "internal_error"
+			resp.Error.ErrorMessage = "Could not delete avatar of user."
+			resp.SendErrorResponse(c)
+			return
+		}
+	}
+
+	if err := Svc.DeleteUser(user.ID); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	disconnectTwitchBot(user)
+
+	if !addAdminEvent(c, database.AdminDeletedUser, user, database.AdminActionPayload{}) {
+		return
+	}
+
+	auditUserChange(c, "user.delete", user, nil)
+
+	resp := responses.SuccessResponse{}
+	resp.Code = http.StatusNoContent
+	resp.SendSuccessReponse(c)
+}
+
+// The bot would otherwise stay in the channel of a deleted account until the next restart.
+func disconnectTwitchBot(user *database.UserAccount) {
+	if user.TwitchLogin != "" && DisconnectTwitchBot != nil {
+		DisconnectTwitchBot(user.TwitchLogin)
+	}
+}
+
+// Disables two-factor authentication of a user who lost their authenticator app and recovery codes.
+func ResetUserTwoFactorRoute(c *gin.Context) {
+	user, ok := moderatedUserFromQuery(c)
+	if !ok {
+		return
+	}
+
+	if !user.TwoFactorEnabled {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "User does not have two-factor authentication enabled."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if err := Svc.DisableTwoFactor(user.ID); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !addAdminEvent(c, database.AdminResetTwoFactor, user, database.AdminActionPayload{}) {
+		return
+	}
+
+	after := *user
+	after.TwoFactorEnabled = false
+	auditUserChange(c, "user.two_factor.reset", user, &after)
+
+	resp := responses.SuccessResponse{}
+	resp.Code = http.StatusNoContent
+	resp.SendSuccessReponse(c)
+}
+
+// Gets the user of the email query, admins can not moderate themselves.
+func moderatedUserFromQuery(c *gin.Context) (*database.UserAccount, bool) {
+	email := c.Query("email")
+
+	if !utils.IsEmailValid(email) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid e-mail address provided."
+		resp.SendErrorResponse(c)
+		return nil, false
+	}
+
+	user, err := Svc.GetUserByEmail(&database.UserAccount{EMail: email})
+	if err != nil {
+		if database.IsNotFoundError(err) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusNotFound
+			resp.Error.ErrorCode = "not_found"
+			resp.Error.ErrorMessage = "No matching user found."
+			resp.SendErrorResponse(c)
+			return nil, false
+		}
+
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return nil, false
+	}
+
+	if current, ok := middleware.CurrentUser(c); ok && current.ID == user.ID {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "You can not perform this action on your own account."
+		resp.SendErrorResponse(c)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// Writes the fields of a user admins can change to the audit log, after is nil if the user was deleted.
+func auditUserChange(c *gin.Context, action string, before, after *database.UserAccount) {
+	details := &middleware.AuditDetails{
+		Action:     action,
+		TargetType: "user",
+		TargetID:   before.ID.String(),
+		Before:     userAuditState(before),
+	}
+	if after != nil {
+		details.After = userAuditState(after)
+	}
+	middleware.SetAudit(c, details)
+}
+
+func userAuditState(user *database.UserAccount) gin.H {
+	return gin.H{
+		"e_mail":                  user.EMail,
+		"role":                    user.Role,
+		"crosshair_quota":         user.CrosshairQuota,
+		"suspended_at":            user.SuspendedAt,
+		"suspended_until":         user.SuspendedUntil,
+		"suspension_reason":       user.SuspensionReason,
+		"password_reset_required": user.PasswordResetRequired,
+		"two_factor_enabled":      user.TwoFactorEnabled,
+	}
+}
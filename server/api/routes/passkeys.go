@@ -0,0 +1,702 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/devusSs/crosshairs/api/middleware"
+	"github.com/devusSs/crosshairs/api/models"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/config"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/updater"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+const (
+	lenPasskeyNameMax = 64
+
+	// Time to complete a registration or login on the authenticator.
+	passkeyCeremonyTimeout = 5 * time.Minute
+)
+
+// Session keys of registrations and logins waiting for the response of the authenticator.
+const (
+	sessionPasskeyRegistration     = "passkey_registration"
+	sessionPasskeyRegistrationName = "passkey_registration_name"
+	sessionPasskeyLogin            = "passkey_login"
+)
+
+// WebAuthn verifies the passkey registrations and logins, it is set up with NewWebAuthn.
+var WebAuthn *webauthn.WebAuthn
+
+// NewWebAuthn returns the relying party of the frontend domain, in dev mode the vite dev server is allowed as origin too.
+//
+// Passkeys are bound to the domain, changing it makes every registered passkey unusable.
+func NewWebAuthn(cfg *config.Config) (*webauthn.WebAuthn, error) {
+	origin := strings.TrimSuffix(cfg.Domain, "/")
+	if !strings.Contains(origin, "://") {
+		origin = "https://" + origin
+	}
+
+	domain, err := url.Parse(origin)
+	if err != nil {
+		return nil, err
+	}
+
+	origins := []string{origin}
+	if updater.BuildMode == "dev" {
+		origins = append(origins, "http://localhost:5173")
+	}
+
+	timeout := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    passkeyCeremonyTimeout,
+		TimeoutUVD: passkeyCeremonyTimeout,
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          domain.Hostname(),
+		RPDisplayName: totpIssuer,
+		RPOrigins:     origins,
+		// Passkeys have to be discoverable so users do not need to enter their e-mail,
+		// they have to verify themselves (PIN, biometrics) so a passkey counts as two factors.
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			UserVerification:   protocol.VerificationRequired,
+		},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        timeout,
+			Registration: timeout,
+		},
+	})
+}
+
+// Adapts a user and their passkeys to webauthn.User, the user handle is the ID of the user.
+type passkeyUser struct {
+	user     *database.UserAccount
+	passkeys []*database.Passkey
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	id := u.user.ID
+	return id[:]
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.EMail
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	if u.user.DisplayName != "" {
+		return u.user.DisplayName
+	}
+	return u.user.EMail
+}
+
+func (u *passkeyUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.passkeys))
+	for _, passkey := range u.passkeys {
+		credentials = append(credentials, passkeyCredential(passkey))
+	}
+	return credentials
+}
+
+// Returns the options the frontend passes to navigator.credentials.create() to add a passkey to the logged in user.
+func BeginPasskeyRegistrationRoute(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var begin models.BeginPasskeyRegistration
+
+	if err := c.BindJSON(&begin); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	name, ok := passkeyName(c, begin.Name)
+	if !ok {
+		return
+	}
+
+	passkeys, err := Svc.GetPasskeysFromUser(user.ID)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	// Authenticators holding a passkey of the user already refuse to create another one.
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		exclusions = append(exclusions, passkeyCredential(passkey).Descriptor())
+	}
+
+	creation, sessionData, err := WebAuthn.BeginRegistration(&passkeyUser{user: user, passkeys: passkeys}, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Could not start passkey registration."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set(sessionPasskeyRegistrationName, name)
+	if !savePasskeyCeremony(c, session, sessionPasskeyRegistration, sessionData) {
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: creation,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Verifies the response of navigator.credentials.create() and stores the passkey.
+func FinishPasskeyRegistrationRoute(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	session := sessions.Default(c)
+
+	sessionData, ok := passkeyCeremony(session, sessionPasskeyRegistration)
+	name, _ := session.Get(sessionPasskeyRegistrationName).(string)
+
+	// A registration can only be finished once.
+	session.Delete(sessionPasskeyRegistration)
+	session.Delete(sessionPasskeyRegistrationName)
+	_ = session.Save()
+
+	if !ok {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "No passkey registration has been started."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(c.Request.Body)
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid passkey credential provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	credential, err := WebAuthn.CreateCredential(&passkeyUser{user: user}, *sessionData, parsed)
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "Could not verify the passkey, please try again."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	passkey := &database.Passkey{
+		UserID:          user.ID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      []string{},
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+
+	for _, transport := range credential.Transport {
+		passkey.Transports = append(passkey.Transports, string(transport))
+	}
+
+	passkey, err = Svc.AddPasskey(passkey)
+	if err != nil {
+		code := http.StatusInternalServerError
+		errCode := "internal_error"
+		if database.IsDuplicateError(err) {
+			code = http.StatusConflict
+			errCode = "conflict"
+		}
+
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = code
+		resp.Error.ErrorCode = errCode
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !addEvent(c, database.NewEvent(database.UserAddedPasskey, &user.ID, database.PasskeyPayload{PasskeyID: passkey.ID, Name: passkey.Name})) {
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusCreated,
+		Data: passkeyModel(passkey),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Returns the options the frontend passes to navigator.credentials.get() to log in with a passkey.
+//
+// No e-mail is needed, the authenticator lets the user pick one of their passkeys.
+func BeginPasskeyLoginRoute(c *gin.Context) {
+	assertion, sessionData, err := WebAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Could not start passkey login."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !savePasskeyCeremony(c, sessions.Default(c), sessionPasskeyLogin, sessionData) {
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: assertion,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Verifies the response of navigator.credentials.get() and logs the owner of the passkey in.
+//
+// Passkeys require user verification, two-factor codes are not asked for.
+func FinishPasskeyLoginRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	sessionData, ok := passkeyCeremony(session, sessionPasskeyLogin)
+
+	// A challenge can only be answered once.
+	session.Delete(sessionPasskeyLogin)
+	_ = session.Save()
+
+	if !ok {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "No passkey login has been started."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(c.Request.Body)
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid passkey credential provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var owner *passkeyUser
+
+	credential, err := WebAuthn.ValidateDiscoverableLogin(func(_, userHandle []byte) (webauthn.User, error) {
+		userID, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, err
+		}
+
+		user, err := Svc.GetUserByUID(&database.UserAccount{ID: userID})
+		if err != nil {
+			return nil, err
+		}
+
+		passkeys, err := Svc.GetPasskeysFromUser(user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		owner = &passkeyUser{user: user, passkeys: passkeys}
+		return owner, nil
+	}, *sessionData, parsed)
+	if err != nil {
+		email := ""
+		var userID *uuid.UUID
+		if owner != nil {
+			email = owner.user.EMail
+			userID = &owner.user.ID
+		}
+
+		if !addLoginFailedEvent(c, email, userID, "invalid_passkey") {
+			return
+		}
+
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "Could not verify the passkey."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	user := owner.user
+
+	passkey := ownedPasskey(owner.passkeys, credential.ID)
+
+	now := time.Now()
+	passkey.SignCount = credential.Authenticator.SignCount
+	passkey.CloneWarning = credential.Authenticator.CloneWarning
+	passkey.BackupEligible = credential.Flags.BackupEligible
+	passkey.BackupState = credential.Flags.BackupState
+	if !passkey.CloneWarning {
+		passkey.LastUsedAt = &now
+	}
+
+	if err := Svc.UpdatePasskeyUsage(passkey); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if passkey.CloneWarning {
+		if !addLoginFailedEvent(c, user.EMail, &user.ID, "passkey_clone_warning") {
+			return
+		}
+
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "This passkey may have been copied and can not be used anymore, please remove it and log in with your password."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !user.VerifiedMail {
+		if !addLoginFailedEvent(c, user.EMail, &user.ID, "unverified_e_mail") {
+			return
+		}
+
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "Please confirm your e-mail address first."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !CheckLoginAllowed(c, user) {
+		return
+	}
+
+	completeLogin(c, user, database.LoginMethodPasskey)
+}
+
+// Lists the passkeys of the logged in user, oldest first.
+func GetPasskeysRoute(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	passkeys, err := Svc.GetPasskeysFromUser(user.ID)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	data := []models.Passkey{}
+	for _, passkey := range passkeys {
+		data = append(data, passkeyModel(passkey))
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: data,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func RenamePasskeyRoute(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var rename models.RenamePasskey
+
+	if err := c.BindJSON(&rename); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	name, ok := passkeyName(c, rename.Name)
+	if !ok {
+		return
+	}
+
+	passkey, ok := passkeyFromParam(c, user)
+	if !ok {
+		return
+	}
+
+	passkey.Name = name
+
+	passkey, err := Svc.RenamePasskey(passkey)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: passkeyModel(passkey),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Revokes the passkey, it can not be used to log in anymore.
+func DeletePasskeyRoute(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	passkey, ok := passkeyFromParam(c, user)
+	if !ok {
+		return
+	}
+
+	if err := Svc.DeletePasskeyFromUser(user.ID, passkey.ID); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !addEvent(c, database.NewEvent(database.UserRemovedPasskey, &user.ID, database.PasskeyPayload{PasskeyID: passkey.ID, Name: passkey.Name})) {
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: responses.GeneralUserResponse{
+			Message: "Successfully removed passkey.",
+		},
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func passkeyFromParam(c *gin.Context, user *database.UserAccount) (*database.Passkey, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid passkey id provided."
+		resp.SendErrorResponse(c)
+		return nil, false
+	}
+
+	passkey, err := Svc.GetPasskeyFromUser(user.ID, id)
+	if err != nil {
+		if database.IsNotFoundError(err) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusNotFound
+			resp.Error.ErrorCode = "not_found"
+			resp.Error.ErrorMessage = "No matching passkey found."
+			resp.SendErrorResponse(c)
+			return nil, false
+		}
+
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return nil, false
+	}
+
+	return passkey, true
+}
+
+// Trims the name and sends an error response if it is empty or too long.
+func passkeyName(c *gin.Context, name string) (string, bool) {
+	name = strings.TrimSpace(name)
+
+	if name == "" || len(name) > lenPasskeyNameMax {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("Name needs to be between 1 and %d characters long.", lenPasskeyNameMax)
+		resp.SendErrorResponse(c)
+		return "", false
+	}
+
+	return name, true
+}
+
+// Stores the challenge of the ceremony in the session, it is checked when the authenticator responds.
+func savePasskeyCeremony(c *gin.Context, session sessions.Session, key string, sessionData *webauthn.SessionData) bool {
+	data, err := json.Marshal(sessionData)
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Could not encode passkey challenge."
+		resp.SendErrorResponse(c)
+		return false
+	}
+
+	session.Set(key, string(data))
+	if err := session.Save(); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Could not set session cookie."
+		resp.SendErrorResponse(c)
+		return false
+	}
+
+	return true
+}
+
+// Returns the challenge stored by savePasskeyCeremony, false if there is none.
+func passkeyCeremony(session sessions.Session, key string) (*webauthn.SessionData, bool) {
+	data, ok := session.Get(key).(string)
+	if !ok {
+		return nil, false
+	}
+
+	var sessionData webauthn.SessionData
+	if err := json.Unmarshal([]byte(data), &sessionData); err != nil {
+		return nil, false
+	}
+
+	return &sessionData, true
+}
+
+// Returns the passkey with the credential ID, WebAuthn only validates credentials the user owns.
+func ownedPasskey(passkeys []*database.Passkey, credentialID []byte) *database.Passkey {
+	for _, passkey := range passkeys {
+		if string(passkey.CredentialID) == string(credentialID) {
+			return passkey
+		}
+	}
+	return nil
+}
+
+func passkeyCredential(passkey *database.Passkey) webauthn.Credential {
+	credential := webauthn.Credential{
+		ID:              passkey.CredentialID,
+		PublicKey:       passkey.PublicKey,
+		AttestationType: passkey.AttestationType,
+		Flags: webauthn.CredentialFlags{
+			BackupEligible: passkey.BackupEligible,
+			BackupState:    passkey.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:       passkey.AAGUID,
+			SignCount:    passkey.SignCount,
+			CloneWarning: passkey.CloneWarning,
+		},
+	}
+
+	for _, transport := range passkey.Transports {
+		credential.Transport = append(credential.Transport, protocol.AuthenticatorTransport(transport))
+	}
+
+	return credential
+}
+
+func passkeyModel(passkey *database.Passkey) models.Passkey {
+	model := models.Passkey{
+		ID:           passkey.ID,
+		Name:         passkey.Name,
+		CreatedAt:    passkey.CreatedAt,
+		LastUsedAt:   passkey.LastUsedAt,
+		Transports:   passkey.Transports,
+		Synced:       passkey.BackupState,
+		CloneWarning: passkey.CloneWarning,
+	}
+
+	if model.Transports == nil {
+		model.Transports = []string{}
+	}
+
+	return model
+}
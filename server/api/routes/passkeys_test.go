@@ -0,0 +1,543 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/devusSs/crosshairs/api/middleware"
+	"github.com/devusSs/crosshairs/config"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const passkeyTestOrigin = "https://example.com"
+
+// Keeps users and passkeys in memory, only implements what the passkey routes use.
+type passkeyTestSvc struct {
+	database.Service
+
+	users    map[uuid.UUID]*database.UserAccount
+	passkeys []*database.Passkey
+	events   []database.EventType
+}
+
+func newPasskeyTestSvc(users ...*database.UserAccount) *passkeyTestSvc {
+	svc := &passkeyTestSvc{users: make(map[uuid.UUID]*database.UserAccount)}
+	for _, user := range users {
+		svc.users[user.ID] = user
+	}
+	return svc
+}
+
+func (s *passkeyTestSvc) GetUserByUID(user *database.UserAccount) (*database.UserAccount, error) {
+	stored, ok := s.users[user.ID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *stored
+	return &copied, nil
+}
+
+func (s *passkeyTestSvc) UpdateUserLogin(user *database.UserAccount) (*database.UserAccount, error) {
+	return user, nil
+}
+
+func (s *passkeyTestSvc) GetRole(string) (*database.Role, error) {
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *passkeyTestSvc) AddEvent(event *database.Event) (*database.Event, error) {
+	s.events = append(s.events, event.Type)
+	return event, nil
+}
+
+func (s *passkeyTestSvc) AddPasskey(passkey *database.Passkey) (*database.Passkey, error) {
+	for _, stored := range s.passkeys {
+		if bytes.Equal(stored.CredentialID, passkey.CredentialID) {
+			return nil, gorm.ErrDuplicatedKey
+		}
+	}
+
+	passkey.ID = uuid.New()
+	passkey.CreatedAt = time.Now()
+	copied := *passkey
+	s.passkeys = append(s.passkeys, &copied)
+	return passkey, nil
+}
+
+func (s *passkeyTestSvc) GetPasskeysFromUser(user uuid.UUID) ([]*database.Passkey, error) {
+	passkeys := []*database.Passkey{}
+	for _, passkey := range s.passkeys {
+		if passkey.UserID == user {
+			copied := *passkey
+			passkeys = append(passkeys, &copied)
+		}
+	}
+	return passkeys, nil
+}
+
+func (s *passkeyTestSvc) GetPasskeyFromUser(user, id uuid.UUID) (*database.Passkey, error) {
+	for _, passkey := range s.passkeys {
+		if passkey.UserID == user && passkey.ID == id {
+			copied := *passkey
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *passkeyTestSvc) RenamePasskey(passkey *database.Passkey) (*database.Passkey, error) {
+	for _, stored := range s.passkeys {
+		if stored.ID == passkey.ID {
+			stored.Name = passkey.Name
+		}
+	}
+	return passkey, nil
+}
+
+func (s *passkeyTestSvc) UpdatePasskeyUsage(passkey *database.Passkey) error {
+	for _, stored := range s.passkeys {
+		if stored.ID == passkey.ID {
+			stored.SignCount = passkey.SignCount
+			stored.CloneWarning = passkey.CloneWarning
+			stored.LastUsedAt = passkey.LastUsedAt
+		}
+	}
+	return nil
+}
+
+func (s *passkeyTestSvc) DeletePasskeyFromUser(user, id uuid.UUID) error {
+	for i, passkey := range s.passkeys {
+		if passkey.UserID == user && passkey.ID == id {
+			s.passkeys = append(s.passkeys[:i], s.passkeys[i+1:]...)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// Software authenticator with a P-256 key, answers ceremonies like a platform authenticator
+// with "none" attestation would.
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T, user uuid.UUID) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+
+	return &softAuthenticator{key: key, credentialID: credentialID, userHandle: user[:]}
+}
+
+// User present, user verified and (if attested is set) attested credential data included.
+func (a *softAuthenticator) authenticatorData(attested []byte) []byte {
+	flags := byte(0x01 | 0x04)
+	if attested != nil {
+		flags |= 0x40
+	}
+
+	rpIDHash := sha256.Sum256([]byte("example.com"))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+func (a *softAuthenticator) create(t *testing.T, challenge string) []byte {
+	t.Helper()
+
+	publicKey, err := cbor.Marshal(map[int]interface{}{
+		1:  2,  // EC2
+		3:  -7, // ES256
+		-1: 1,  // P-256
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Empty AAGUID, length of the credential ID, credential ID and public key.
+	attested := make([]byte, 16)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, publicKey...)
+
+	attestation, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]interface{}{
+		"clientDataJSON":    encodeBase64(clientDataJSON(t, "webauthn.create", challenge)),
+		"attestationObject": encodeBase64(attestation),
+		"transports":        []string{"internal"},
+	})
+}
+
+func (a *softAuthenticator) get(t *testing.T, challenge string) []byte {
+	t.Helper()
+
+	a.signCount++
+
+	authenticatorData := a.authenticatorData(nil)
+	clientData := clientDataJSON(t, "webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authenticatorData...), clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]interface{}{
+		"clientDataJSON":    encodeBase64(clientData),
+		"authenticatorData": encodeBase64(authenticatorData),
+		"signature":         encodeBase64(signature),
+		"userHandle":        encodeBase64(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]interface{}) []byte {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":       encodeBase64(a.credentialID),
+		"rawId":    encodeBase64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func clientDataJSON(t *testing.T, ceremony, challenge string) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]string{"type": ceremony, "challenge": challenge, "origin": passkeyTestOrigin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func encodeBase64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Browser with a cookie jar against the passkey routes.
+type passkeyTestClient struct {
+	t       *testing.T
+	engine  *gin.Engine
+	cookies map[string]*http.Cookie
+}
+
+type passkeyTestResponse struct {
+	Code int             `json:"code"`
+	Data json.RawMessage `json:"data"`
+}
+
+func newPasskeyTestClient(t *testing.T, svc *passkeyTestSvc) *passkeyTestClient {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+
+	Svc = svc
+	middleware.Svc = svc
+
+	var err error
+	WebAuthn, err = NewWebAuthn(&config.Config{Domain: passkeyTestOrigin})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := gin.New()
+	engine.Use(sessions.Sessions("session", cookie.NewStore([]byte("secret"))))
+	engine.Use(middleware.LoadUserMiddleware)
+
+	// Stand-ins for the password login and logout.
+	engine.POST("/login/:id", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("user", c.Param("id"))
+		_ = session.Save()
+	})
+	engine.POST("/logout", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Clear()
+		_ = session.Save()
+	})
+
+	engine.POST("/passkeys/register/begin", BeginPasskeyRegistrationRoute)
+	engine.POST("/passkeys/register/finish", FinishPasskeyRegistrationRoute)
+	engine.POST("/passkeys/login/begin", BeginPasskeyLoginRoute)
+	engine.POST("/passkeys/login/finish", FinishPasskeyLoginRoute)
+	engine.GET("/passkeys", GetPasskeysRoute)
+	engine.PATCH("/passkeys/:id", RenamePasskeyRoute)
+	engine.DELETE("/passkeys/:id", DeletePasskeyRoute)
+
+	return &passkeyTestClient{t: t, engine: engine, cookies: make(map[string]*http.Cookie)}
+}
+
+func (c *passkeyTestClient) do(method, path string, body []byte) *passkeyTestResponse {
+	c.t.Helper()
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	c.engine.ServeHTTP(w, req)
+
+	// Sessions saved more than once set the cookie again, the last one wins.
+	for _, cookie := range w.Result().Cookies() {
+		c.cookies[cookie.Name] = cookie
+	}
+
+	resp := &passkeyTestResponse{Code: w.Code}
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+			c.t.Fatalf("%s %s returned invalid JSON: %s", method, path, w.Body.String())
+		}
+	}
+	return resp
+}
+
+// Starts a ceremony and returns its challenge.
+func (c *passkeyTestClient) challenge(path string, body []byte) string {
+	c.t.Helper()
+
+	resp := c.do(http.MethodPost, path, body)
+	if resp.Code != http.StatusOK {
+		c.t.Fatalf("POST %s returned %d: %s", path, resp.Code, resp.Data)
+	}
+
+	var options struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+		} `json:"publicKey"`
+	}
+	if err := json.Unmarshal(resp.Data, &options); err != nil {
+		c.t.Fatal(err)
+	}
+	return options.PublicKey.Challenge
+}
+
+func (c *passkeyTestClient) register(auth *softAuthenticator, name string) *passkeyTestResponse {
+	c.t.Helper()
+
+	challenge := c.challenge("/passkeys/register/begin", []byte(`{"name":"`+name+`"}`))
+	return c.do(http.MethodPost, "/passkeys/register/finish", auth.create(c.t, challenge))
+}
+
+func (c *passkeyTestClient) login(auth *softAuthenticator) *passkeyTestResponse {
+	c.t.Helper()
+
+	challenge := c.challenge("/passkeys/login/begin", nil)
+	return c.do(http.MethodPost, "/passkeys/login/finish", auth.get(c.t, challenge))
+}
+
+func newPasskeyTestUser() *database.UserAccount {
+	return &database.UserAccount{ID: uuid.New(), EMail: uuid.NewString() + "@example.com", VerifiedMail: true}
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	user := newPasskeyTestUser()
+	svc := newPasskeyTestSvc(user)
+	client := newPasskeyTestClient(t, svc)
+	auth := newSoftAuthenticator(t, user.ID)
+
+	if resp := client.do(http.MethodPost, "/passkeys/register/begin", []byte(`{"name":"Laptop"}`)); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("registration without session returned %d, want 401", resp.Code)
+	}
+
+	client.do(http.MethodPost, "/login/"+user.ID.String(), nil)
+
+	challenge := client.challenge("/passkeys/register/begin", []byte(`{"name":"  Laptop  "}`))
+
+	resp := client.do(http.MethodPost, "/passkeys/register/finish", auth.create(t, challenge))
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("registration returned %d: %s", resp.Code, resp.Data)
+	}
+	if len(svc.passkeys) != 1 || svc.passkeys[0].Name != "Laptop" || svc.passkeys[0].UserID != user.ID {
+		t.Fatalf("registration stored %+v", svc.passkeys)
+	}
+	if !bytes.Equal(svc.passkeys[0].CredentialID, auth.credentialID) {
+		t.Error("registration stored another credential ID")
+	}
+
+	// A challenge can only be answered once.
+	if resp := client.do(http.MethodPost, "/passkeys/register/finish", auth.create(t, challenge)); resp.Code != http.StatusBadRequest {
+		t.Errorf("replayed registration returned %d, want 400", resp.Code)
+	}
+
+	// The same authenticator can not be registered twice.
+	if resp := client.register(auth, "Again"); resp.Code != http.StatusConflict {
+		t.Errorf("registering the same authenticator again returned %d, want 409", resp.Code)
+	}
+
+	client.do(http.MethodPost, "/logout", nil)
+	if resp := client.do(http.MethodGet, "/passkeys", nil); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("listing passkeys after logout returned %d, want 401", resp.Code)
+	}
+
+	// Discoverable login, the user is only known from the user handle of the credential.
+	if resp := client.login(auth); resp.Code != http.StatusOK {
+		t.Fatalf("login returned %d: %s", resp.Code, resp.Data)
+	}
+
+	resp = client.do(http.MethodGet, "/passkeys", nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("listing passkeys after login returned %d", resp.Code)
+	}
+	if svc.passkeys[0].SignCount != 1 || svc.passkeys[0].LastUsedAt == nil {
+		t.Errorf("login did not update usage: sign count %d", svc.passkeys[0].SignCount)
+	}
+
+	want := []database.EventType{database.UserAddedPasskey, database.UserLoggedIn}
+	if len(svc.events) != len(want) || svc.events[0] != want[0] || svc.events[1] != want[1] {
+		t.Errorf("recorded events %v, want %v", svc.events, want)
+	}
+}
+
+func TestPasskeyLoginUnknownCredential(t *testing.T) {
+	user := newPasskeyTestUser()
+	svc := newPasskeyTestSvc(user)
+	client := newPasskeyTestClient(t, svc)
+
+	client.do(http.MethodPost, "/login/"+user.ID.String(), nil)
+	if resp := client.register(newSoftAuthenticator(t, user.ID), "Laptop"); resp.Code != http.StatusCreated {
+		t.Fatalf("registration returned %d: %s", resp.Code, resp.Data)
+	}
+	client.do(http.MethodPost, "/logout", nil)
+
+	// Claims to belong to the user but was never registered.
+	if resp := client.login(newSoftAuthenticator(t, user.ID)); resp.Code != http.StatusUnauthorized {
+		t.Errorf("login with unregistered passkey returned %d, want 401", resp.Code)
+	}
+
+	if resp := client.do(http.MethodPost, "/passkeys/login/finish", nil); resp.Code != http.StatusBadRequest {
+		t.Errorf("login without ceremony returned %d, want 400", resp.Code)
+	}
+}
+
+func TestPasskeyLoginCloneWarning(t *testing.T) {
+	user := newPasskeyTestUser()
+	svc := newPasskeyTestSvc(user)
+	client := newPasskeyTestClient(t, svc)
+	auth := newSoftAuthenticator(t, user.ID)
+
+	client.do(http.MethodPost, "/login/"+user.ID.String(), nil)
+	if resp := client.register(auth, "Laptop"); resp.Code != http.StatusCreated {
+		t.Fatalf("registration returned %d: %s", resp.Code, resp.Data)
+	}
+	client.do(http.MethodPost, "/logout", nil)
+
+	if resp := client.login(auth); resp.Code != http.StatusOK {
+		t.Fatalf("login returned %d: %s", resp.Code, resp.Data)
+	}
+	client.do(http.MethodPost, "/logout", nil)
+
+	// A copy of the key still has the old sign count.
+	clone := *auth
+	clone.signCount = 0
+	if resp := client.login(&clone); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("login with cloned passkey returned %d, want 401", resp.Code)
+	}
+	if !svc.passkeys[0].CloneWarning {
+		t.Error("clone warning was not stored")
+	}
+
+	// The passkey stays unusable, also for the original authenticator.
+	if resp := client.login(auth); resp.Code != http.StatusUnauthorized {
+		t.Errorf("login with passkey with clone warning returned %d, want 401", resp.Code)
+	}
+	if resp := client.do(http.MethodGet, "/passkeys", nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("rejected login created a session, listing passkeys returned %d", resp.Code)
+	}
+}
+
+func TestPasskeyRenameAndRevokeOwnership(t *testing.T) {
+	owner, other := newPasskeyTestUser(), newPasskeyTestUser()
+	svc := newPasskeyTestSvc(owner, other)
+	client := newPasskeyTestClient(t, svc)
+
+	passkey, _ := svc.AddPasskey(&database.Passkey{UserID: owner.ID, Name: "Laptop", CredentialID: []byte("credential")})
+	path := "/passkeys/" + passkey.ID.String()
+
+	client.do(http.MethodPost, "/login/"+other.ID.String(), nil)
+
+	if resp := client.do(http.MethodPatch, path, []byte(`{"name":"Mine"}`)); resp.Code != http.StatusNotFound {
+		t.Errorf("renaming passkey of another user returned %d, want 404", resp.Code)
+	}
+	if resp := client.do(http.MethodDelete, path, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("revoking passkey of another user returned %d, want 404", resp.Code)
+	}
+	if len(svc.passkeys) != 1 || svc.passkeys[0].Name != "Laptop" {
+		t.Fatalf("passkey of another user was changed: %+v", svc.passkeys)
+	}
+
+	client.do(http.MethodPost, "/logout", nil)
+	client.do(http.MethodPost, "/login/"+owner.ID.String(), nil)
+
+	if resp := client.do(http.MethodPatch, "/passkeys/invalid", []byte(`{"name":"Phone"}`)); resp.Code != http.StatusBadRequest {
+		t.Errorf("renaming passkey with invalid id returned %d, want 400", resp.Code)
+	}
+	if resp := client.do(http.MethodPatch, path, []byte(`{"name":"   "}`)); resp.Code != http.StatusBadRequest {
+		t.Errorf("renaming passkey to empty name returned %d, want 400", resp.Code)
+	}
+
+	if resp := client.do(http.MethodPatch, path, []byte(`{"name":"Phone"}`)); resp.Code != http.StatusOK {
+		t.Fatalf("renaming own passkey returned %d: %s", resp.Code, resp.Data)
+	}
+	if svc.passkeys[0].Name != "Phone" {
+		t.Errorf("passkey is named %q after renaming, want Phone", svc.passkeys[0].Name)
+	}
+
+	if resp := client.do(http.MethodDelete, path, nil); resp.Code != http.StatusOK {
+		t.Fatalf("revoking own passkey returned %d: %s", resp.Code, resp.Data)
+	}
+	if len(svc.passkeys) != 0 {
+		t.Error("revoked passkey was not deleted")
+	}
+	if resp := client.do(http.MethodDelete, path, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("revoking passkey again returned %d, want 404", resp.Code)
+	}
+
+	if len(svc.events) != 1 || svc.events[0] != database.UserRemovedPasskey {
+		t.Errorf("recorded events %v, want only %s", svc.events, database.UserRemovedPasskey)
+	}
+}
@@ -0,0 +1,330 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/devusSs/crosshairs/api/middleware"
+	"github.com/devusSs/crosshairs/api/models"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/logging"
+	"github.com/devusSs/crosshairs/sharecode"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	lenProNameMax    = 64
+	proCrosshairsMax = 10
+)
+
+// Lists all pro players and their crosshairs, does not need a session.
+func GetProPlayersRoute(c *gin.Context) {
+	players, err := Svc.GetProPlayers()
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	playersReturn := models.MultipleProPlayers{Players: []models.ProPlayer{}}
+
+	for _, player := range players {
+		playersReturn.Players = append(playersReturn.Players, proPlayerModel(player))
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: playersReturn,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func GetProPlayerRoute(c *gin.Context) {
+	player, ok := proPlayerFromParam(c)
+	if !ok {
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: proPlayerModel(player),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func AddProPlayerRoute(c *gin.Context) {
+	var saveProPlayer models.SaveProPlayer
+
+	if err := c.BindJSON(&saveProPlayer); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	player, errResp := proPlayerFromRequest(&saveProPlayer)
+	if errResp != nil {
+		errResp.SendErrorResponse(c)
+		return
+	}
+
+	player, err := Svc.AddProPlayer(player)
+	if err != nil {
+		if database.IsDuplicateError(err) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = "A pro player with that name already exists."
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	submitProPreviews(player)
+
+	middleware.SetAudit(c, &middleware.AuditDetails{
+		Action:     "pro.add",
+		TargetType: "pro_player",
+		TargetID:   player.ID.String(),
+		After:      proPlayerModel(player),
+	})
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusCreated,
+		Data: proPlayerModel(player),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Replaces the details and crosshairs of a pro player.
+func UpdateProPlayerRoute(c *gin.Context) {
+	stored, ok := proPlayerFromParam(c)
+	if !ok {
+		return
+	}
+
+	var saveProPlayer models.SaveProPlayer
+
+	if err := c.BindJSON(&saveProPlayer); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	player, errResp := proPlayerFromRequest(&saveProPlayer)
+	if errResp != nil {
+		errResp.SendErrorResponse(c)
+		return
+	}
+
+	player.ID = stored.ID
+	player.CreatedAt = stored.CreatedAt
+
+	player, err := Svc.UpdateProPlayer(player)
+	if err != nil {
+		if database.IsDuplicateError(err) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = "A pro player with that name already exists."
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	submitProPreviews(player)
+
+	middleware.SetAudit(c, &middleware.AuditDetails{
+		Action:     "pro.update",
+		TargetType: "pro_player",
+		TargetID:   player.ID.String(),
+		Before:     proPlayerModel(stored),
+		After:      proPlayerModel(player),
+	})
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: proPlayerModel(player),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func DeleteProPlayerRoute(c *gin.Context) {
+	player, ok := proPlayerFromParam(c)
+	if !ok {
+		return
+	}
+
+	if err := Svc.DeleteProPlayer(player.ID); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	middleware.SetAudit(c, &middleware.AuditDetails{
+		Action:     "pro.delete",
+		TargetType: "pro_player",
+		TargetID:   player.ID.String(),
+		Before:     proPlayerModel(player),
+	})
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: fmt.Sprintf("Successfully deleted pro player %s.", player.Name),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func proPlayerFromParam(c *gin.Context) (*database.ProPlayer, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid pro player id provided."
+		resp.SendErrorResponse(c)
+		return nil, false
+	}
+
+	player, err := Svc.GetProPlayerByID(id)
+	if err != nil {
+		if database.IsNotFoundError(err) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusNotFound
+			resp.Error.ErrorCode = "not_found"
+			resp.Error.ErrorMessage = "No matching pro player found."
+			resp.SendErrorResponse(c)
+			return nil, false
+		}
+
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return nil, false
+	}
+
+	return player, true
+}
+
+// Validates the request and decodes all crosshairs of the player.
+func proPlayerFromRequest(req *models.SaveProPlayer) (*database.ProPlayer, *responses.ErrorResponse) {
+	name := strings.TrimSpace(req.Name)
+
+	if name == "" || len(name) > lenProNameMax {
+		resp := &responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("Name needs to be between 1 and %d characters long.", lenProNameMax)
+		return nil, resp
+	}
+
+	if len(req.Crosshairs) > proCrosshairsMax {
+		resp := &responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("A pro player may have at most %d crosshairs.", proCrosshairsMax)
+		return nil, resp
+	}
+
+	player := &database.ProPlayer{
+		Name:         name,
+		Team:         strings.TrimSpace(req.Team),
+		Source:       strings.TrimSpace(req.Source),
+		LastVerified: time.Now(),
+		Crosshairs:   []database.ProCrosshair{},
+	}
+
+	if req.LastVerified != nil {
+		player.LastVerified = *req.LastVerified
+	}
+
+	for i, ch := range req.Crosshairs {
+		settings, err := sharecode.Decode(ch.Code)
+		if err != nil {
+			resp := &responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = fmt.Sprintf("Invalid crosshair code provided at position %d: %s.", i, err.Error())
+			return nil, resp
+		}
+
+		player.Crosshairs = append(player.Crosshairs, database.ProCrosshair{
+			Code:     ch.Code,
+			Note:     ch.Note,
+			Settings: *settings,
+		})
+	}
+
+	return player, nil
+}
+
+// Renders previews of the crosshairs of a pro player in the background.
+func submitProPreviews(player *database.ProPlayer) {
+	for _, ch := range player.Crosshairs {
+		if _, err := Jobs.Submit(context.Background(), JobRenderPreview, uuid.Nil, renderPreviewPayload{Code: ch.Code}); err != nil {
+			log.Printf("%s Error submitting preview job for crosshair %s: %s\n", logging.ErrSign, ch.Code, err.Error())
+		}
+	}
+}
+
+func proPlayerModel(player *database.ProPlayer) models.ProPlayer {
+	model := models.ProPlayer{
+		ID:           player.ID,
+		Name:         player.Name,
+		Team:         player.Team,
+		Source:       player.Source,
+		LastVerified: player.LastVerified,
+		Crosshairs:   []models.ProCrosshair{},
+		CreatedAt:    player.CreatedAt,
+		UpdatedAt:    player.UpdatedAt,
+	}
+
+	for _, ch := range player.Crosshairs {
+		model.Crosshairs = append(model.Crosshairs, models.ProCrosshair{
+			Code:       ch.Code,
+			Note:       ch.Note,
+			Settings:   ch.Settings,
+			PreviewURL: publicObjectURL(ch.PreviewURL),
+		})
+	}
+
+	return model
+}
@@ -0,0 +1,207 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/devusSs/crosshairs/api/middleware"
+	"github.com/devusSs/crosshairs/api/models"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/utils"
+	"github.com/gin-gonic/gin"
+)
+
+func GetRoleQuotasRoute(c *gin.Context) {
+	quotas, err := Svc.GetRoleQuotas()
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	quotasReturn := models.RoleQuotas{Quotas: []models.RoleQuota{}}
+
+	for _, quota := range quotas {
+		quotasReturn.Quotas = append(quotasReturn.Quotas, roleQuotaModel(quota))
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: quotasReturn,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Creates or changes the quota of a role, -1 allows an unlimited amount of crosshairs.
+func SetRoleQuotaRoute(c *gin.Context) {
+	var setQuota models.SetRoleQuota
+
+	if err := c.BindJSON(&setQuota); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	setQuota.Role = strings.ToLower(strings.TrimSpace(setQuota.Role))
+
+	if !roleRegex.MatchString(setQuota.Role) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid role provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !validQuota(setQuota.MaxCrosshairs) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Max crosshairs needs to be -1 (unlimited) or greater."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if _, err := Svc.GetRole(setQuota.Role); err != nil {
+		if database.IsNotFoundError(err) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusNotFound
+			resp.Error.ErrorCode = "not_found"
+			resp.Error.ErrorMessage = "No matching role found."
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	quotas, err := Svc.GetRoleQuotas()
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var before interface{}
+	for _, quota := range quotas {
+		if quota.Role == setQuota.Role {
+			before = roleQuotaModel(quota)
+		}
+	}
+
+	quota, err := Svc.SetRoleQuota(&database.RoleQuota{Role: setQuota.Role, MaxCrosshairs: setQuota.MaxCrosshairs})
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	middleware.SetAudit(c, &middleware.AuditDetails{
+		Action:     "quota.role.set",
+		TargetType: "role",
+		TargetID:   quota.Role,
+		Before:     before,
+		After:      roleQuotaModel(quota),
+	})
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: roleQuotaModel(quota),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Grants a user an individual quota which takes precedence over the quota of their role.
+func SetUserQuotaRoute(c *gin.Context) {
+	var setQuota models.SetUserQuota
+
+	if err := c.BindJSON(&setQuota); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !utils.IsEmailValid(setQuota.EMail) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid e-mail address provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if setQuota.MaxCrosshairs != nil && !validQuota(*setQuota.MaxCrosshairs) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Max crosshairs needs to be -1 (unlimited) or greater."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	user, err := Svc.GetUserByEmail(&database.UserAccount{EMail: setQuota.EMail})
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusNotFound
+		resp.Error.ErrorCode = "not_found"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if err := Svc.SetUserCrosshairQuota(user.ID, setQuota.MaxCrosshairs); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	after := *user
+	after.CrosshairQuota = setQuota.MaxCrosshairs
+	auditUserChange(c, "quota.user.set", user, &after)
+
+	resp := responses.SuccessResponse{}
+	resp.Code = http.StatusNoContent
+	resp.SendSuccessReponse(c)
+}
+
+func validQuota(quota int) bool {
+	return quota >= database.QuotaUnlimited
+}
+
+func roleQuotaModel(quota *database.RoleQuota) models.RoleQuota {
+	return models.RoleQuota{
+		Role:          quota.Role,
+		MaxCrosshairs: quota.MaxCrosshairs,
+		UpdatedAt:     quota.UpdatedAt,
+	}
+}
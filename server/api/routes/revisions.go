@@ -0,0 +1,341 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/devusSs/crosshairs/api/models"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/logging"
+	"github.com/devusSs/crosshairs/sharecode"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Edits note, code and / or tags of a crosshair, the previous version is kept as a revision.
+func UpdateCrosshairRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var updateCrosshair models.UpdateCrosshair
+
+	if err := c.BindJSON(&updateCrosshair); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if updateCrosshair.Code == nil && updateCrosshair.Note == nil && updateCrosshair.Tags == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Nothing to update provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshair, ok := ownCrosshairFromParam(c, userUID)
+	if !ok {
+		return
+	}
+
+	code := crosshair.Code
+	if updateCrosshair.Code != nil {
+		code = *updateCrosshair.Code
+	}
+
+	note := crosshair.Note
+	if updateCrosshair.Note != nil {
+		note = *updateCrosshair.Note
+	}
+
+	tags := tagNames(crosshair.Tags)
+	if updateCrosshair.Tags != nil {
+		tags, err = normalizeTags(*updateCrosshair.Tags)
+		if err != nil {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = fmt.Sprintf("Invalid tags provided: %s.", err.Error())
+			resp.SendErrorResponse(c)
+			return
+		}
+	}
+
+	crosshair, errResp := updateCrosshairVersion(crosshair, code, note, tags)
+	if errResp != nil {
+		errResp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: crosshairModel(crosshair),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func GetCrosshairRevisionsRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshair, ok := ownCrosshairFromParam(c, userUID)
+	if !ok {
+		return
+	}
+
+	revisions, err := Svc.GetCrosshairRevisions(crosshair.ID)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	revisionsReturn := models.CrosshairRevisions{Revisions: []models.CrosshairRevision{}}
+
+	for _, rev := range revisions {
+		revisionsReturn.Revisions = append(revisionsReturn.Revisions, models.CrosshairRevision{
+			Version:  rev.Version,
+			Created:  rev.CreatedAt,
+			Code:     rev.Code,
+			Note:     rev.Note,
+			Settings: rev.Settings,
+			Tags:     rev.Tags,
+		})
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: revisionsReturn,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Sets the crosshair back to a previous version, the current version is kept as a new revision.
+func RestoreCrosshairRevisionRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	userUID, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse user id."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid version provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshair, ok := ownCrosshairFromParam(c, userUID)
+	if !ok {
+		return
+	}
+
+	revision, err := Svc.GetCrosshairRevision(crosshair.ID, version)
+	if err != nil {
+		if database.IsNotFoundError(err) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusNotFound
+			resp.Error.ErrorCode = "not_found"
+			resp.Error.ErrorMessage = "No matching revision found."
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	crosshair, errResp := updateCrosshairVersion(crosshair, revision.Code, revision.Note, revision.Tags)
+	if errResp != nil {
+		errResp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: crosshairModel(crosshair),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Gets a crosshair of the user by the id in the route, other users' crosshairs are treated as non existent.
+func ownCrosshairFromParam(c *gin.Context, userUID uuid.UUID) (*database.Crosshair, bool) {
+	crosshairID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid crosshair id provided."
+		resp.SendErrorResponse(c)
+		return nil, false
+	}
+
+	crosshair, err := Svc.GetCrosshairByID(crosshairID)
+	if err != nil && !database.IsNotFoundError(err) {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return nil, false
+	}
+
+	if database.IsNotFoundError(err) || crosshair.RegistrantID != userUID {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusNotFound
+		resp.Error.ErrorCode = "not_found"
+		resp.Error.ErrorMessage = "No matching crosshair found."
+		resp.SendErrorResponse(c)
+		return nil, false
+	}
+
+	return crosshair, true
+}
+
+// Validates and stores a new version of the crosshair.
+//
+// Nothing is stored if the version does not differ from the current one.
+func updateCrosshairVersion(crosshair *database.Crosshair, code, note string, tags []string) (*database.Crosshair, *responses.ErrorResponse) {
+	if code == crosshair.Code && note == crosshair.Note && equalTags(tags, tagNames(crosshair.Tags)) {
+		return crosshair, nil
+	}
+
+	if len(note) < lenNoteMin {
+		resp := &responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("Crosshair note needs to be at least %d characters long.", lenNoteMin)
+		return nil, resp
+	}
+
+	codeChanged := code != crosshair.Code
+
+	if codeChanged {
+		settings, err := sharecode.Decode(code)
+		if err != nil {
+			resp := &responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = fmt.Sprintf("Invalid crosshair code provided: %s.", err.Error())
+			return nil, resp
+		}
+
+		crosshair.Code = code
+		crosshair.Settings = *settings
+		// Rendered again below, the old preview shows a different crosshair.
+		crosshair.PreviewURL = ""
+	}
+
+	crosshair.Note = note
+
+	crosshair, err := Svc.UpdateCrosshair(crosshair, tags)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := &responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		return nil, resp
+	}
+
+	if codeChanged {
+		if _, err := Jobs.Submit(context.Background(), JobRenderPreview, crosshair.RegistrantID, renderPreviewPayload{Code: crosshair.Code}); err != nil {
+			log.Printf("%s Error submitting preview job for crosshair %s: %s\n", logging.ErrSign, crosshair.Code, err.Error())
+		}
+	}
+
+	return crosshair, nil
+}
+
+// Reports whether both lists contain the same tags, ignoring their order.
+func equalTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	seen := make(map[string]bool)
+	for _, tag := range a {
+		seen[tag] = true
+	}
+
+	for _, tag := range b {
+		if !seen[tag] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,443 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/devusSs/crosshairs/api/middleware"
+	"github.com/devusSs/crosshairs/api/models"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const lenRoleDescriptionMax = 256
+
+var roleRegex = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// Lists all roles with their permissions and every permission which can be granted.
+func GetRolesRoute(c *gin.Context) {
+	roles, err := Svc.GetRoles()
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	rolesReturn := models.Roles{Roles: []models.Role{}, Permissions: []models.Permission{}}
+
+	for _, role := range roles {
+		rolesReturn.Roles = append(rolesReturn.Roles, roleModel(role))
+	}
+
+	for _, perm := range database.Permissions {
+		rolesReturn.Permissions = append(rolesReturn.Permissions, models.Permission{
+			Name:        perm.Name,
+			Description: perm.Description,
+		})
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: rolesReturn,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Creates a role or replaces description and permissions of an existing one.
+func SaveRoleRoute(c *gin.Context) {
+	var saveRole models.SaveRole
+
+	if err := c.BindJSON(&saveRole); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	role := &database.Role{
+		Name:        strings.ToLower(strings.TrimSpace(saveRole.Name)),
+		Description: strings.TrimSpace(saveRole.Description),
+		Permissions: []database.Permission{},
+	}
+
+	if !roleRegex.MatchString(role.Name) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Role needs to be 2 to 32 characters long and may only contain letters, numbers, _ and -."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if database.IsBuiltinRole(role.Name) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Built-in roles can not be changed."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if len(role.Description) > lenRoleDescriptionMax {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("Description may be at most %d characters long.", lenRoleDescriptionMax)
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, perm := range saveRole.Permissions {
+		if !database.IsKnownPermission(perm) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = fmt.Sprintf("Unknown permission %s.", perm)
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		if seen[perm] {
+			continue
+		}
+		seen[perm] = true
+
+		role.Permissions = append(role.Permissions, database.Permission{Name: perm})
+	}
+
+	var before interface{}
+
+	existing, err := Svc.GetRole(role.Name)
+	if err != nil && !database.IsNotFoundError(err) {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+	if err == nil {
+		before = roleModel(existing)
+	}
+
+	role, err = Svc.SaveRole(role)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	middleware.SetAudit(c, &middleware.AuditDetails{
+		Action:     "role.save",
+		TargetType: "role",
+		TargetID:   role.Name,
+		Before:     before,
+		After:      roleModel(role),
+	})
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: roleModel(role),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Deletes a role, only possible if no user has it anymore.
+func DeleteRoleRoute(c *gin.Context) {
+	name := strings.ToLower(strings.TrimSpace(c.Query("name")))
+
+	if name == "" {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Missing role name."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if database.IsBuiltinRole(name) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Built-in roles can not be deleted."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	role, err := Svc.GetRole(name)
+	if err != nil {
+		if database.IsNotFoundError(err) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusNotFound
+			resp.Error.ErrorCode = "not_found"
+			resp.Error.ErrorMessage = "No matching role found."
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	users, err := Svc.CountUsersWithRole(name)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if users > 0 {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = fmt.Sprintf("Role is still assigned to %d user(s).", users)
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if err := Svc.DeleteRole(name); err != nil {
+		if database.IsNotFoundError(err) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusNotFound
+			resp.Error.ErrorCode = "not_found"
+			resp.Error.ErrorMessage = "No matching role found."
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	middleware.SetAudit(c, &middleware.AuditDetails{
+		Action:     "role.delete",
+		TargetType: "role",
+		TargetID:   role.Name,
+		Before:     roleModel(role),
+	})
+
+	resp := responses.SuccessResponse{}
+	resp.Code = http.StatusNoContent
+	resp.SendSuccessReponse(c)
+}
+
+// Assigns a role to a user. Users can not change their own role to not lock themselves out.
+func SetUserRoleRoute(c *gin.Context) {
+	var setRole models.SetUserRole
+
+	if err := c.BindJSON(&setRole); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !utils.IsEmailValid(setRole.EMail) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid e-mail address provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	setRole.Role = strings.ToLower(strings.TrimSpace(setRole.Role))
+
+	if _, err := Svc.GetRole(setRole.Role); err != nil {
+		if database.IsNotFoundError(err) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusNotFound
+			resp.Error.ErrorCode = "not_found"
+			resp.Error.ErrorMessage = "No matching role found."
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	user, err := Svc.GetUserByEmail(&database.UserAccount{EMail: setRole.EMail})
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusNotFound
+		resp.Error.ErrorCode = "not_found"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if current, ok := middleware.CurrentUser(c); ok && current.ID == user.ID {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "You can not change your own role."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if err := Svc.UpdateUserRole(user.ID, setRole.Role); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !addAdminEvent(c, database.AdminChangedUserRole, user, database.AdminActionPayload{Role: setRole.Role}) {
+		return
+	}
+
+	after := *user
+	after.Role = setRole.Role
+	auditUserChange(c, "user.role.set", user, &after)
+
+	resp := responses.SuccessResponse{}
+	resp.Code = http.StatusNoContent
+	resp.SendSuccessReponse(c)
+}
+
+// Sets whether users of a role need two-factor authentication for permission protected routes, built-in roles included.
+//
+// Admins can only require it for their own role after enabling it for themselves to not lock themselves out.
+func SetRoleTwoFactorRoute(c *gin.Context) {
+	var setTwoFactor models.SetRoleTwoFactor
+
+	if err := c.BindJSON(&setTwoFactor); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	setTwoFactor.Role = strings.ToLower(strings.TrimSpace(setTwoFactor.Role))
+
+	role, err := Svc.GetRole(setTwoFactor.Role)
+	if err != nil {
+		if database.IsNotFoundError(err) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusNotFound
+			resp.Error.ErrorCode = "not_found"
+			resp.Error.ErrorMessage = "No matching role found."
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if current, ok := middleware.CurrentUser(c); ok && setTwoFactor.Required && current.Role == role.Name && !current.TwoFactorEnabled {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Please enable two-factor authentication for your own account first."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	before := roleModel(role)
+
+	if err := Svc.SetRoleTwoFactorRequired(role.Name, setTwoFactor.Required); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	role, err = Svc.GetRole(role.Name)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	middleware.SetAudit(c, &middleware.AuditDetails{
+		Action:     "role.two_factor.set",
+		TargetType: "role",
+		TargetID:   role.Name,
+		Before:     before,
+		After:      roleModel(role),
+	})
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: roleModel(role),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func roleModel(role *database.Role) models.Role {
+	model := models.Role{
+		Name:             role.Name,
+		Description:      role.Description,
+		Permissions:      []string{},
+		Builtin:          database.IsBuiltinRole(role.Name),
+		RequireTwoFactor: role.RequireTwoFactor,
+		CreatedAt:        role.CreatedAt,
+		UpdatedAt:        role.UpdatedAt,
+	}
+
+	for _, perm := range role.Permissions {
+		model.Permissions = append(model.Permissions, perm.Name)
+	}
+
+	sort.Strings(model.Permissions)
+
+	return model
+}
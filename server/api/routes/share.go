@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/devusSs/crosshairs/api/models"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/gin-gonic/gin"
+)
+
+const anonymousDisplayName = "Anonymous"
+
+// Returns a shared crosshair, does not need a session.
+//
+// Private crosshairs are treated as non existent even if they have a slug from an earlier share.
+func GetSharedCrosshairRoute(c *gin.Context) {
+	crosshair, err := Svc.GetCrosshairBySlug(c.Param("slug"))
+	if err != nil && !database.IsNotFoundError(err) {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if database.IsNotFoundError(err) || crosshair.Visibility == database.VisibilityPrivate {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusNotFound
+		resp.Error.ErrorCode = "not_found"
+		resp.Error.ErrorMessage = "No matching crosshair found."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	owner, err := Svc.GetUserByUID(&database.UserAccount{ID: crosshair.RegistrantID})
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: models.SharedCrosshair{
+			Code:       crosshair.Code,
+			Note:       crosshair.Note,
+			Settings:   crosshair.Settings,
+			PreviewURL: publicObjectURL(crosshair.PreviewURL),
+			Tags:       tagNames(crosshair.Tags),
+			SaveCount:  crosshair.SaveCount,
+			Owner:      displayName(owner),
+		},
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Name shown publicly for a user, never the e-mail.
+func displayName(user *database.UserAccount) string {
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+
+	if user.TwitchLogin != "" {
+		return user.TwitchLogin
+	}
+
+	return anonymousDisplayName
+}
@@ -0,0 +1,678 @@
+package routes
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/devusSs/crosshairs/api/middleware"
+	"github.com/devusSs/crosshairs/api/models"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/totp"
+	"github.com/devusSs/crosshairs/utils"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// Shown as account issuer in authenticator apps.
+	totpIssuer = "csgo-crosshairs"
+
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+	// Without characters which are easily confused (0 / o, 1 / l / i).
+	recoveryCodeCharset = "abcdefghjkmnpqrstuvwxyz23456789"
+
+	// Time to enter the code after the password has been verified.
+	twoFactorLoginTimeout = 5 * time.Minute
+	// Wrong codes allowed per login, the password has to be entered again afterwards.
+	maxTwoFactorAttempts = 5
+	// Every maxTwoFactorAttempts wrong codes of a user, in whichever session, lock two-factor logins
+	// of the user. The lock starts at twoFactorLockout and doubles each time up to maxTwoFactorLockout.
+	twoFactorLockout    = 5 * time.Minute
+	maxTwoFactorLockout = 24 * time.Hour
+)
+
+// Session keys of a login waiting for its two-factor code.
+const (
+	sessionTwoFactorUser     = "two_factor_user"
+	sessionTwoFactorSince    = "two_factor_since"
+	sessionTwoFactorAttempts = "two_factor_attempts"
+	sessionTwoFactorMethod   = "two_factor_method"
+)
+
+// Tells the logged in user whether two-factor authentication is enabled or required and how many recovery codes are left.
+func GetTwoFactorRoute(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	status := models.TwoFactorStatus{Enabled: user.TwoFactorEnabled}
+
+	role, err := Svc.GetRole(user.Role)
+	if err != nil && !database.IsNotFoundError(err) {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+	status.Required = err == nil && role.RequireTwoFactor
+
+	if user.TwoFactorEnabled {
+		status.RecoveryCodesLeft, err = Svc.CountUnusedRecoveryCodes(user.ID)
+		if err != nil {
+			errString := database.CheckDatabaseError(err)
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusInternalServerError
+			resp.Error.ErrorCode = "internal_error"
+			resp.Error.ErrorMessage = errString
+			resp.SendErrorResponse(c)
+			return
+		}
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: status,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Creates a new TOTP secret for the logged in user, it is only used once confirmed by ActivateTwoFactorRoute.
+func EnrollTwoFactorRoute(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Two-factor authentication is enabled already."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Could not generate secret."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if err := Svc.SetTOTPSecret(user.ID, secret); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: models.TwoFactorEnrollment{
+			Secret:          secret,
+			ProvisioningURI: totp.ProvisioningURI(secret, totpIssuer, user.EMail),
+		},
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Enables two-factor authentication once the user entered a code of the enrolled secret and returns the recovery codes.
+func ActivateTwoFactorRoute(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var code models.TwoFactorCode
+
+	if err := c.BindJSON(&code); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Two-factor authentication is enabled already."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if user.TOTPSecret == "" {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Please enroll first."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	step, valid := totp.Validate(user.TOTPSecret, code.Code, time.Now())
+	if !valid {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "Invalid two-factor code."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Could not generate recovery codes."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if err := Svc.EnableTwoFactor(user.ID, step, hashes); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !addEvent(c, database.NewEvent(database.UserEnabledTwoFactor, &user.ID, nil)) {
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: models.RecoveryCodes{RecoveryCodes: codes},
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Disables two-factor authentication, the password and a code are needed. Not possible if the role requires it.
+func DisableTwoFactorRoute(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var disable models.DisableTwoFactor
+
+	if err := c.BindJSON(&disable); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !user.TwoFactorEnabled {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Two-factor authentication is not enabled."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	role, err := Svc.GetRole(user.Role)
+	if err != nil && !database.IsNotFoundError(err) {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if err == nil && role.RequireTwoFactor {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusForbidden
+		resp.Error.ErrorCode = "forbidden"
+		resp.Error.ErrorMessage = "Your role requires two-factor authentication."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if err := utils.VerifyPassword(user.Password, disable.Password); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "Passwords do not match."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !verifyTwoFactorCode(c, user, disable.Code) {
+		return
+	}
+
+	if err := Svc.DisableTwoFactor(user.ID); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !addEvent(c, database.NewEvent(database.UserDisabledTwoFactor, &user.ID, nil)) {
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: responses.GeneralUserResponse{
+			Message: "Successfully disabled two-factor authentication.",
+		},
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Replaces the recovery codes of the logged in user with new ones, a code is needed.
+func RegenerateRecoveryCodesRoute(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var code models.TwoFactorCode
+
+	if err := c.BindJSON(&code); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !user.TwoFactorEnabled {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Two-factor authentication is not enabled."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !verifyTwoFactorCode(c, user, code.Code) {
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Could not generate recovery codes."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if err := Svc.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: models.RecoveryCodes{RecoveryCodes: codes},
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Completes a login started by LoginVerifiedUser with a code of the authenticator app or a recovery code.
+func VerifyLoginTwoFactorRoute(c *gin.Context) {
+	var code models.TwoFactorCode
+
+	if err := c.BindJSON(&code); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	session := sessions.Default(c)
+
+	userID, ok := pendingTwoFactorLogin(session)
+	if !ok {
+		clearTwoFactorLogin(session)
+		_ = session.Save()
+
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "No login is waiting for a two-factor code, please log in again."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	user, err := Svc.GetUserByUID(&database.UserAccount{ID: userID})
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	// The user may have been suspended since entering the password.
+	if user.IsSuspended() {
+		clearTwoFactorLogin(session)
+		_ = session.Save()
+
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusForbidden
+		resp.Error.ErrorCode = "forbidden"
+		resp.Error.ErrorMessage = middleware.SuspensionMessage(user)
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	// Checked before the code, a locked user can not keep guessing from new sessions.
+	if user.TwoFactorLockedUntil != nil && time.Now().Before(*user.TwoFactorLockedUntil) {
+		clearTwoFactorLogin(session)
+		_ = session.Save()
+
+		sendTwoFactorLockedResponse(c, *user.TwoFactorLockedUntil)
+		return
+	}
+
+	valid, recovery, err := checkTwoFactorCode(user, code.Code)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if !valid {
+		failures, err := Svc.AddTwoFactorFailure(user.ID)
+		if err != nil {
+			errString := database.CheckDatabaseError(err)
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusInternalServerError
+			resp.Error.ErrorCode = "internal_error"
+			resp.Error.ErrorMessage = errString
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		var lockedUntil *time.Time
+		if failures%maxTwoFactorAttempts == 0 {
+			until := time.Now().Add(twoFactorLockoutDuration(failures))
+			if err := Svc.LockTwoFactor(user.ID, until); err != nil {
+				errString := database.CheckDatabaseError(err)
+				resp := responses.ErrorResponse{}
+				resp.Code = http.StatusInternalServerError
+				resp.Error.ErrorCode = "internal_error"
+				resp.Error.ErrorMessage = errString
+				resp.SendErrorResponse(c)
+				return
+			}
+			lockedUntil = &until
+		}
+
+		attempts, _ := session.Get(sessionTwoFactorAttempts).(int)
+		attempts++
+
+		if attempts >= maxTwoFactorAttempts || lockedUntil != nil {
+			clearTwoFactorLogin(session)
+		} else {
+			session.Set(sessionTwoFactorAttempts, attempts)
+		}
+		_ = session.Save()
+
+		if !addLoginFailedEvent(c, user.EMail, &user.ID, "wrong_two_factor_code") {
+			return
+		}
+
+		if lockedUntil != nil {
+			sendTwoFactorLockedResponse(c, *lockedUntil)
+			return
+		}
+
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "Invalid two-factor code."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if user.TwoFactorFailures > 0 || user.TwoFactorLockedUntil != nil {
+		if err := Svc.ResetTwoFactorFailures(user.ID); err != nil {
+			errString := database.CheckDatabaseError(err)
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusInternalServerError
+			resp.Error.ErrorCode = "internal_error"
+			resp.Error.ErrorMessage = errString
+			resp.SendErrorResponse(c)
+			return
+		}
+	}
+
+	method, ok := session.Get(sessionTwoFactorMethod).(string)
+	if !ok {
+		method = database.LoginMethodPassword
+	}
+
+	// Saved together with the user by completeLogin.
+	clearTwoFactorLogin(session)
+
+	if recovery && !addEvent(c, database.NewEvent(database.UserUsedRecoveryCode, &user.ID, nil)) {
+		return
+	}
+
+	completeLogin(c, user, method)
+}
+
+// Returns how long the given amount of wrong codes locks two-factor logins, 5m, 10m, 20m, ... up to 24h.
+func twoFactorLockoutDuration(failures int) time.Duration {
+	lockout := twoFactorLockout
+	for i := maxTwoFactorAttempts; i < failures && lockout < maxTwoFactorLockout; i += maxTwoFactorAttempts {
+		lockout *= 2
+	}
+
+	if lockout > maxTwoFactorLockout {
+		return maxTwoFactorLockout
+	}
+	return lockout
+}
+
+func sendTwoFactorLockedResponse(c *gin.Context, until time.Time) {
+	resp := responses.ErrorResponse{}
+	resp.Code = http.StatusTooManyRequests
+	resp.Error.ErrorCode = "two_factor_locked"
+	resp.Error.ErrorMessage = fmt.Sprintf("Too many invalid two-factor codes, try again after %s.", until.UTC().Format(time.RFC3339))
+	resp.SendErrorResponse(c)
+}
+
+// Remembers the user whose password has been verified, the login is completed by VerifyLoginTwoFactorRoute.
+func startTwoFactorLogin(c *gin.Context, user *database.UserAccount, method string) bool {
+	session := sessions.Default(c)
+	session.Set(sessionTwoFactorUser, user.ID.String())
+	session.Set(sessionTwoFactorMethod, method)
+	session.Set(sessionTwoFactorSince, time.Now().Unix())
+	session.Set(sessionTwoFactorAttempts, 0)
+	if err := session.Save(); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Could not set session cookie."
+		resp.SendErrorResponse(c)
+		return false
+	}
+	return true
+}
+
+// Returns the user of the login waiting for its code, false if there is none or it timed out.
+func pendingTwoFactorLogin(session sessions.Session) (uuid.UUID, bool) {
+	since, ok := session.Get(sessionTwoFactorSince).(int64)
+	if !ok || time.Since(time.Unix(since, 0)) > twoFactorLoginTimeout {
+		return uuid.Nil, false
+	}
+
+	userID, err := uuid.Parse(fmt.Sprintf("%s", session.Get(sessionTwoFactorUser)))
+	if err != nil {
+		return uuid.Nil, false
+	}
+
+	return userID, true
+}
+
+func clearTwoFactorLogin(session sessions.Session) {
+	session.Delete(sessionTwoFactorUser)
+	session.Delete(sessionTwoFactorSince)
+	session.Delete(sessionTwoFactorAttempts)
+	session.Delete(sessionTwoFactorMethod)
+}
+
+// Checks the code of the logged in user and sends an error response if it is invalid.
+func verifyTwoFactorCode(c *gin.Context, user *database.UserAccount, code string) bool {
+	valid, recovery, err := checkTwoFactorCode(user, code)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return false
+	}
+
+	if !valid {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "Invalid two-factor code."
+		resp.SendErrorResponse(c)
+		return false
+	}
+
+	if recovery {
+		return addEvent(c, database.NewEvent(database.UserUsedRecoveryCode, &user.ID, nil))
+	}
+
+	return true
+}
+
+// Reports whether the code is a valid TOTP or unused recovery code of the user and whether it was a recovery code.
+//
+// Both can only be used once.
+func checkTwoFactorCode(user *database.UserAccount, code string) (bool, bool, error) {
+	code = strings.TrimSpace(code)
+
+	if step, valid := totp.Validate(user.TOTPSecret, code, time.Now()); valid {
+		unused, err := Svc.UseTOTPStep(user.ID, step)
+		return unused, false, err
+	}
+
+	normalised := normaliseRecoveryCode(code)
+	if len(normalised) != recoveryCodeLength {
+		return false, false, nil
+	}
+
+	used, err := Svc.UseRecoveryCode(user.ID, hashRecoveryCode(normalised))
+	return used, used, err
+}
+
+// Returns the recovery codes formatted as xxxxx-xxxxx and their hashes.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	max := big.NewInt(int64(len(recoveryCodeCharset)))
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, recoveryCodeLength)
+		for j := range raw {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, nil, err
+			}
+			raw[j] = recoveryCodeCharset[n.Int64()]
+		}
+
+		code := string(raw)
+		codes = append(codes, code[:recoveryCodeLength/2]+"-"+code[recoveryCodeLength/2:])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// Codes may be entered with or without the dash and in any case.
+func normaliseRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// Codes are random enough to not need a slow hash like passwords.
+func hashRecoveryCode(normalised string) string {
+	sum := sha256.Sum256([]byte(normalised))
+	return hex.EncodeToString(sum[:])
+}
@@ -5,9 +5,11 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
+	"github.com/devusSs/crosshairs/api/middleware"
 	"github.com/devusSs/crosshairs/api/models"
 	"github.com/devusSs/crosshairs/api/responses"
 	"github.com/devusSs/crosshairs/database"
@@ -28,6 +30,8 @@ const (
 var (
 	SRVAddr           string
 	UsingReverseProxy bool = false
+
+	displayNameRegex = regexp.MustCompile(`^[A-Za-z0-9_\-. ]{3,32}$`)
 )
 
 func RegisterUserRoute(c *gin.Context) {
@@ -208,22 +212,7 @@ func RegisterUserRoute(c *gin.Context) {
 		return
 	}
 
-	var event database.Event
-
-	event.Type = database.UserRegistered
-	event.Data.URL = c.Request.RequestURI
-	event.Data.Method = c.Request.Method
-	event.Data.IssuerIP = c.Request.Header.Get("X-Forwarded-For")
-	event.Timestamp = time.Now()
-
-	_, err = Svc.AddEvent(&event)
-	if err != nil {
-		errString := database.CheckDatabaseError(err)
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusInternalServerError
-		resp.Error.ErrorCode = "internal_error"
-		resp.Error.ErrorMessage = errString
-		resp.SendErrorResponse(c)
+	if !addEvent(c, database.NewEvent(database.UserRegistered, &newUser.ID, nil)) {
 		return
 	}
 
@@ -340,6 +329,10 @@ func LoginUserRoute(c *gin.Context) {
 
 	user, err := Svc.GetUserByEmail(&database.UserAccount{EMail: loginUser.EMail})
 	if err != nil {
+		if database.IsNotFoundError(err) && !addLoginFailedEvent(c, loginUser.EMail, nil, "unknown_e_mail") {
+			return
+		}
+
 		errString := database.CheckDatabaseError(err)
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusBadRequest
@@ -350,6 +343,10 @@ func LoginUserRoute(c *gin.Context) {
 	}
 
 	if !user.VerifiedMail {
+		if !addLoginFailedEvent(c, loginUser.EMail, &user.ID, "unverified_e_mail") {
+			return
+		}
+
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusUnauthorized
 		resp.Error.ErrorCode = "unauthorized"
@@ -359,6 +356,10 @@ func LoginUserRoute(c *gin.Context) {
 	}
 
 	if err := utils.VerifyPassword(user.Password, loginUser.Password); err != nil {
+		if !addLoginFailedEvent(c, loginUser.EMail, &user.ID, "wrong_password") {
+			return
+		}
+
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusUnauthorized
 		resp.Error.ErrorCode = "unauthorized"
@@ -367,6 +368,107 @@ func LoginUserRoute(c *gin.Context) {
 		return
 	}
 
+	if !CheckLoginAllowed(c, user) {
+		return
+	}
+
+	LoginVerifiedUser(c, user, database.LoginMethodPassword)
+}
+
+// CheckLoginAllowed sends an error response and records the failed login if the user may not log in right now.
+func CheckLoginAllowed(c *gin.Context, user *database.UserAccount) bool {
+	if user.IsSuspended() {
+		if !addLoginFailedEvent(c, user.EMail, &user.ID, "suspended") {
+			return false
+		}
+
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusForbidden
+		resp.Error.ErrorCode = "forbidden"
+		resp.Error.ErrorMessage = middleware.SuspensionMessage(user)
+		resp.SendErrorResponse(c)
+		return false
+	}
+
+	// Password resets forced by admins are not skipped by logging in another way.
+	if user.PasswordResetRequired {
+		if !addLoginFailedEvent(c, user.EMail, &user.ID, "password_reset_required") {
+			return false
+		}
+
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "Your password has to be reset, please check your e-mails."
+		resp.SendErrorResponse(c)
+		return false
+	}
+
+	return true
+}
+
+// LoginVerifiedUser logs in the user after their password or an integration (e.g. Twitch) verified who they are.
+//
+// Users with two-factor authentication enabled have to complete the login with a code first.
+func LoginVerifiedUser(c *gin.Context, user *database.UserAccount, method string) {
+	// The login is completed by VerifyLoginTwoFactorRoute.
+	if user.TwoFactorEnabled {
+		if !startTwoFactorLogin(c, user, method) {
+			return
+		}
+
+		resp := responses.SuccessResponse{}
+		resp.Code = http.StatusOK
+		resp.Data = responses.LoginUserResponse{
+			Message:           "Please enter the code of your authenticator app or a recovery code.",
+			TwoFactorRequired: true,
+		}
+		resp.SendSuccessReponse(c)
+		return
+	}
+
+	completeLogin(c, user, method)
+}
+
+// Logs the user in after their credentials have been verified.
+func completeLogin(c *gin.Context, user *database.UserAccount, method string) {
+	// Users of roles requiring two-factor authentication are told to enable it.
+	setupRequired := false
+	if !user.TwoFactorEnabled {
+		role, err := Svc.GetRole(user.Role)
+		if err != nil && !database.IsNotFoundError(err) {
+			errString := database.CheckDatabaseError(err)
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusInternalServerError
+			resp.Error.ErrorCode = "internal_error"
+			resp.Error.ErrorMessage = errString
+			resp.SendErrorResponse(c)
+			return
+		}
+		setupRequired = err == nil && role.RequireTwoFactor
+	}
+
+	message := "Successfully logged in."
+
+	// Logging in during the grace period keeps the account.
+	if user.DeletionScheduledAt != nil {
+		if err := Svc.ScheduleUserDeletion(user.ID, nil); err != nil {
+			errString := database.CheckDatabaseError(err)
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusInternalServerError
+			resp.Error.ErrorCode = "internal_error"
+			resp.Error.ErrorMessage = errString
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		if !addEvent(c, database.NewEvent(database.UserDeletionCancelled, &user.ID, nil)) {
+			return
+		}
+
+		message = "Successfully logged in, the deletion of your account has been cancelled."
+	}
+
 	user.LastLogin = time.Now()
 
 	if UsingReverseProxy {
@@ -388,6 +490,8 @@ func LoginUserRoute(c *gin.Context) {
 
 	session := sessions.Default(c)
 	session.Set("user", user.ID.String())
+	session.Set(sessionLoginMethod, method)
+	session.Set(sessionLoginAt, time.Now().Unix())
 	if err := session.Save(); err != nil {
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusInternalServerError
@@ -397,13 +501,18 @@ func LoginUserRoute(c *gin.Context) {
 		return
 	}
 
+	if !addEvent(c, database.NewEvent(database.UserLoggedIn, &user.ID, database.LoginPayload{Method: method})) {
+		return
+	}
+
 	stats.UsersLoggedInLast24Hours++
 
 	resp := responses.SuccessResponse{}
 	resp.Code = http.StatusOK
 	resp.Data = responses.LoginUserResponse{
-		Message: "Successfully logged in.",
-		Role:    userDB.Role,
+		Message:                message,
+		Role:                   userDB.Role,
+		TwoFactorSetupRequired: setupRequired,
 	}
 	resp.SendSuccessReponse(c)
 }
@@ -468,7 +577,32 @@ func GetUserRoute(c *gin.Context) {
 
 	userReturn.CreatedAt = user.CreatedAt
 	userReturn.EMail = user.EMail
+	userReturn.DisplayName = user.DisplayName
 	userReturn.Role = user.Role
+	userReturn.CrosshairsRegistered = user.CrosshairsRegistered
+	userReturn.TwoFactorEnabled = user.TwoFactorEnabled
+	userReturn.HasPassword = !user.PasswordUnknown
+
+	quota, err := Svc.GetCrosshairQuota(user)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if quota != database.QuotaUnlimited {
+		remaining := quota - user.CrosshairsRegistered
+		// Quotas may be lowered below the amount of crosshairs a user already has.
+		if remaining < 0 {
+			remaining = 0
+		}
+		userReturn.CrosshairsQuota = &quota
+		userReturn.CrosshairsRemaining = &remaining
+	}
 
 	resp := responses.SuccessResponse{
 		Code: http.StatusOK,
@@ -489,6 +623,11 @@ func LogoutUserRoute(c *gin.Context) {
 		return
 	}
 
+	var userID *uuid.UUID
+	if uuidUser, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user"))); err == nil {
+		userID = &uuidUser
+	}
+
 	session.Set("user", "")
 	session.Clear()
 	session.Options(sessions.Options{Path: "/", MaxAge: -1})
@@ -501,6 +640,10 @@ func LogoutUserRoute(c *gin.Context) {
 		return
 	}
 
+	if !addEvent(c, database.NewEvent(database.UserLoggedOut, userID, nil)) {
+		return
+	}
+
 	resp := responses.SuccessResponse{}
 	resp.Code = http.StatusNoContent
 	resp.SendSuccessReponse(c)
@@ -561,21 +704,7 @@ func ResetPasswordRoute(c *gin.Context) {
 		return
 	}
 
-	var emailData *utils.EmailData
-
-	if updater.BuildMode == "dev" {
-		emailData = &utils.EmailData{
-			URL:     fmt.Sprintf("http://%s/api/users/resetPass?email=%s&code=%s", SRVAddr, resetPass.EMail, utils.Encode(verificationCode)),
-			Subject: "dropawp.com - Reset your password",
-		}
-	} else {
-		emailData = &utils.EmailData{
-			URL:     fmt.Sprintf("http://%s/users/reset-password?email=%s&code=%s", CFG.Domain, resetPass.EMail, utils.Encode(verificationCode)),
-			Subject: "dropawp.com - Reset your password",
-		}
-	}
-
-	if err := utils.SendVerificationMail(user, emailData); err != nil {
+	if err := utils.SendVerificationMail(user, resetPasswordMailData(resetPass.EMail, verificationCode)); err != nil {
 		resp := responses.ErrorResponse{}
 		resp.Code = http.StatusInternalServerError
 		resp.Error.ErrorCode = "internal_error"
@@ -593,6 +722,21 @@ func ResetPasswordRoute(c *gin.Context) {
 	resp.SendSuccessReponse(c)
 }
 
+// Also used when admins force a password reset.
+func resetPasswordMailData(email, code string) *utils.EmailData {
+	if updater.BuildMode == "dev" {
+		return &utils.EmailData{
+			URL:     fmt.Sprintf("http://%s/api/users/resetPass?email=%s&code=%s", SRVAddr, email, utils.Encode(code)),
+			Subject: "dropawp.com - Reset your password",
+		}
+	}
+
+	return &utils.EmailData{
+		URL:     fmt.Sprintf("http://%s/users/reset-password?email=%s&code=%s", CFG.Domain, email, utils.Encode(code)),
+		Subject: "dropawp.com - Reset your password",
+	}
+}
+
 func VerifyUserPasswordCodeRoute(c *gin.Context) {
 	email := c.Query("email")
 	code := c.Query("code")
@@ -733,22 +877,7 @@ func ResetPasswordRouteFinal(c *gin.Context) {
 		return
 	}
 
-	var event database.Event
-
-	event.Type = database.UserChangedPassword
-	event.Data.URL = c.Request.RequestURI
-	event.Data.Method = c.Request.Method
-	event.Data.IssuerIP = c.Request.Header.Get("X-Forwarded-For")
-	event.Timestamp = time.Now()
-
-	_, err = Svc.AddEvent(&event)
-	if err != nil {
-		errString := database.CheckDatabaseError(err)
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusInternalServerError
-		resp.Error.ErrorCode = "internal_error"
-		resp.Error.ErrorMessage = errString
-		resp.SendErrorResponse(c)
+	if !addEvent(c, database.NewEvent(database.UserChangedPassword, &user.ID, nil)) {
 		return
 	}
 
@@ -844,22 +973,7 @@ func ResetPasswordWhenLoggedInRoute(c *gin.Context) {
 		return
 	}
 
-	var event database.Event
-
-	event.Type = database.UserChangedPassword
-	event.Data.URL = c.Request.RequestURI
-	event.Data.Method = c.Request.Method
-	event.Data.IssuerIP = c.Request.Header.Get("X-Forwarded-For")
-	event.Timestamp = time.Now()
-
-	_, err = Svc.AddEvent(&event)
-	if err != nil {
-		errString := database.CheckDatabaseError(err)
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusInternalServerError
-		resp.Error.ErrorCode = "internal_error"
-		resp.Error.ErrorMessage = errString
-		resp.SendErrorResponse(c)
+	if !addEvent(c, database.NewEvent(database.UserChangedPassword, &user.ID, nil)) {
 		return
 	}
 
@@ -963,21 +1077,7 @@ func UploadUserAvatarRoute(c *gin.Context) {
 		return
 	}
 
-	var event database.Event
-
-	event.Type = database.UserUploadedAvatar
-	event.Data.URL = c.Request.RequestURI
-	event.Data.Method = c.Request.Method
-	event.Data.IssuerIP = c.Request.Header.Get("X-Forwarded-For")
-	event.Timestamp = time.Now()
-
-	_, err = Svc.AddEvent(&event)
-	if err != nil {
-		resp := responses.ErrorResponse{}
-		resp.Code = http.StatusInternalServerError
-		resp.Error.ErrorCode = "internal_error"
-		resp.Error.ErrorMessage = "Something went wrong, sorry."
-		resp.SendErrorResponse(c)
+	if !addEvent(c, database.NewEvent(database.UserUploadedAvatar, &uuidUser, nil)) {
 		return
 	}
 
@@ -1039,3 +1139,65 @@ func DeleteUserAvatarRoute(c *gin.Context) {
 	resp.Code = http.StatusNoContent
 	resp.SendSuccessReponse(c)
 }
+
+func UpdateDisplayNameRoute(c *gin.Context) {
+	session := sessions.Default(c)
+
+	if session.Get("user") == nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusUnauthorized
+		resp.Error.ErrorCode = "unauthorized"
+		resp.Error.ErrorMessage = "You are currently not logged in."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	uuidUser, err := uuid.Parse(fmt.Sprintf("%s", session.Get("user")))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Could not parse uuid."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	var updateDisplayName models.UpdateDisplayName
+
+	if err := c.BindJSON(&updateDisplayName); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	// An empty display name resets it.
+	if updateDisplayName.DisplayName != "" && !displayNameRegex.MatchString(updateDisplayName.DisplayName) {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Display name needs to be 3 to 32 characters long and may only contain letters, numbers, spaces and _ - ."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	_, err = Svc.UpdateUserDisplayName(&database.UserAccount{ID: uuidUser, DisplayName: updateDisplayName.DisplayName})
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Something went wrong, sorry."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: responses.GeneralUserResponse{
+			Message: "Successfully updated display name.",
+		},
+	}
+	resp.SendSuccessReponse(c)
+}
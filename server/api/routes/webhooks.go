@@ -0,0 +1,479 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/devusSs/crosshairs/api/middleware"
+	"github.com/devusSs/crosshairs/api/models"
+	"github.com/devusSs/crosshairs/api/responses"
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/webhooks"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	lenWebhookURLMax         = 512
+	lenWebhookDescriptionMax = 256
+
+	deliveriesLimitDefault = 50
+	deliveriesLimitMax     = 200
+)
+
+// Lists all webhooks and the event types they can subscribe to, secrets are not included.
+func GetWebhooksRoute(c *gin.Context) {
+	webhooks, err := Svc.GetWebhooks()
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	webhooksReturn := models.MultipleWebhooks{
+		Webhooks:   []models.Webhook{},
+		EventTypes: []string{},
+	}
+
+	for _, webhook := range webhooks {
+		webhooksReturn.Webhooks = append(webhooksReturn.Webhooks, webhookModel(webhook, false))
+	}
+
+	for _, eventType := range database.EventTypes {
+		webhooksReturn.EventTypes = append(webhooksReturn.EventTypes, string(eventType))
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: webhooksReturn,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Creates a webhook, the response contains its secret which is not shown again.
+func AddWebhookRoute(c *gin.Context) {
+	var addWebhook models.AddWebhook
+
+	if err := c.BindJSON(&addWebhook); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	secret, err := webhooks.GenerateSecret()
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = "Could not generate secret."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	webhook := &database.Webhook{
+		Secret:  secret,
+		Enabled: addWebhook.Enabled == nil || *addWebhook.Enabled,
+	}
+
+	if current, ok := middleware.CurrentUser(c); ok {
+		webhook.CreatedBy = current.ID
+	}
+
+	// Event types are required on creation, an empty list is rejected.
+	eventTypes := addWebhook.EventTypes
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+
+	if errResp := setWebhookFields(webhook, &addWebhook.URL, &addWebhook.Description, eventTypes); errResp != nil {
+		errResp.SendErrorResponse(c)
+		return
+	}
+
+	webhook, err = Svc.AddWebhook(webhook)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	middleware.SetAudit(c, &middleware.AuditDetails{
+		Action:     "webhook.create",
+		TargetType: "webhook",
+		TargetID:   webhook.ID.String(),
+		After:      webhookModel(webhook, false),
+	})
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusCreated,
+		Data: webhookModel(webhook, true),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Updates the fields which are set, a rotated secret is part of the response.
+func UpdateWebhookRoute(c *gin.Context) {
+	webhook, ok := webhookFromParam(c)
+	if !ok {
+		return
+	}
+
+	var updateWebhook models.UpdateWebhook
+
+	if err := c.BindJSON(&updateWebhook); err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid JSON body provided."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	before := webhookModel(webhook, false)
+
+	if errResp := setWebhookFields(webhook, updateWebhook.URL, updateWebhook.Description, updateWebhook.EventTypes); errResp != nil {
+		errResp.SendErrorResponse(c)
+		return
+	}
+
+	if updateWebhook.Enabled != nil {
+		webhook.Enabled = *updateWebhook.Enabled
+	}
+
+	if updateWebhook.RotateSecret {
+		secret, err := webhooks.GenerateSecret()
+		if err != nil {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusInternalServerError
+			resp.Error.ErrorCode = "internal_error"
+			resp.Error.ErrorMessage = "Could not generate secret."
+			resp.SendErrorResponse(c)
+			return
+		}
+		webhook.Secret = secret
+	}
+
+	webhook, err := Svc.UpdateWebhook(webhook)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	// The secret itself never goes to the audit log, only that it changed.
+	after := gin.H{"webhook": webhookModel(webhook, false), "secret_rotated": updateWebhook.RotateSecret}
+
+	middleware.SetAudit(c, &middleware.AuditDetails{
+		Action:     "webhook.update",
+		TargetType: "webhook",
+		TargetID:   webhook.ID.String(),
+		Before:     gin.H{"webhook": before},
+		After:      after,
+	})
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: webhookModel(webhook, updateWebhook.RotateSecret),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Deletes the webhook with its delivery log, pending deliveries are dropped.
+func DeleteWebhookRoute(c *gin.Context) {
+	webhook, ok := webhookFromParam(c)
+	if !ok {
+		return
+	}
+
+	if err := Svc.DeleteWebhook(webhook.ID); err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	middleware.SetAudit(c, &middleware.AuditDetails{
+		Action:     "webhook.delete",
+		TargetType: "webhook",
+		TargetID:   webhook.ID.String(),
+		Before:     webhookModel(webhook, false),
+	})
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusNoContent,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Sends a ping to the webhook right away and returns the delivery, also works for disabled webhooks.
+//
+// A failed ping is still a successful request, the delivery holds the error.
+func TestWebhookRoute(c *gin.Context) {
+	webhook, ok := webhookFromParam(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := Webhooks.Test(c.Request.Context(), webhook)
+	if err != nil {
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: webhookDeliveryModel(delivery),
+	}
+	resp.SendSuccessReponse(c)
+}
+
+// Lists the deliveries of a webhook, newest first.
+//
+// Query parameters (all optional): status, cursor and limit.
+func GetWebhookDeliveriesRoute(c *gin.Context) {
+	webhook, ok := webhookFromParam(c)
+	if !ok {
+		return
+	}
+
+	query := &database.WebhookDeliveryQuery{
+		WebhookID: webhook.ID,
+		Status:    database.WebhookDeliveryStatus(c.Query("status")),
+		Cursor:    c.Query("cursor"),
+		Limit:     deliveriesLimitDefault,
+	}
+
+	if query.Status != "" && !query.Status.IsValid() {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Status needs to be pending, succeeded or failed."
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > deliveriesLimitMax {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = fmt.Sprintf("Limit needs to be between 1 and %d.", deliveriesLimitMax)
+			resp.SendErrorResponse(c)
+			return
+		}
+		query.Limit = parsed
+	}
+
+	deliveries, nextCursor, err := Svc.GetWebhookDeliveries(query)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = "Invalid cursor provided."
+			resp.SendErrorResponse(c)
+			return
+		}
+
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return
+	}
+
+	page := models.WebhookDeliveryPage{
+		Deliveries: []models.WebhookDelivery{},
+		NextCursor: nextCursor,
+	}
+
+	for _, delivery := range deliveries {
+		page.Deliveries = append(page.Deliveries, webhookDeliveryModel(delivery))
+	}
+
+	resp := responses.SuccessResponse{
+		Code: http.StatusOK,
+		Data: page,
+	}
+	resp.SendSuccessReponse(c)
+}
+
+func webhookFromParam(c *gin.Context) (*database.Webhook, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusBadRequest
+		resp.Error.ErrorCode = "invalid_request"
+		resp.Error.ErrorMessage = "Invalid webhook id provided."
+		resp.SendErrorResponse(c)
+		return nil, false
+	}
+
+	webhook, err := Svc.GetWebhookByID(id)
+	if err != nil {
+		if database.IsNotFoundError(err) {
+			resp := responses.ErrorResponse{}
+			resp.Code = http.StatusNotFound
+			resp.Error.ErrorCode = "not_found"
+			resp.Error.ErrorMessage = "No matching webhook found."
+			resp.SendErrorResponse(c)
+			return nil, false
+		}
+
+		errString := database.CheckDatabaseError(err)
+		resp := responses.ErrorResponse{}
+		resp.Code = http.StatusInternalServerError
+		resp.Error.ErrorCode = "internal_error"
+		resp.Error.ErrorMessage = errString
+		resp.SendErrorResponse(c)
+		return nil, false
+	}
+
+	return webhook, true
+}
+
+// Validates and sets the fields which are not nil.
+func setWebhookFields(webhook *database.Webhook, rawURL, description *string, eventTypes []string) *responses.ErrorResponse {
+	if rawURL != nil {
+		parsed, err := url.Parse(strings.TrimSpace(*rawURL))
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || len(parsed.String()) > lenWebhookURLMax {
+			resp := &responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = fmt.Sprintf("URL needs to be an absolute http(s) URL of at most %d characters.", lenWebhookURLMax)
+			return resp
+		}
+		webhook.URL = parsed.String()
+	}
+
+	if description != nil {
+		trimmed := strings.TrimSpace(*description)
+		if len(trimmed) > lenWebhookDescriptionMax {
+			resp := &responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = fmt.Sprintf("Description must not be longer than %d characters.", lenWebhookDescriptionMax)
+			return resp
+		}
+		webhook.Description = trimmed
+	}
+
+	if eventTypes != nil {
+		subscribed := []database.EventType{}
+
+		for _, eventType := range eventTypes {
+			if !database.IsKnownEventType(eventType) {
+				resp := &responses.ErrorResponse{}
+				resp.Code = http.StatusBadRequest
+				resp.Error.ErrorCode = "invalid_request"
+				resp.Error.ErrorMessage = fmt.Sprintf("Unknown event type %q provided.", eventType)
+				return resp
+			}
+
+			if !containsEventType(subscribed, database.EventType(eventType)) {
+				subscribed = append(subscribed, database.EventType(eventType))
+			}
+		}
+
+		if len(subscribed) == 0 {
+			resp := &responses.ErrorResponse{}
+			resp.Code = http.StatusBadRequest
+			resp.Error.ErrorCode = "invalid_request"
+			resp.Error.ErrorMessage = "Webhooks need to subscribe to at least one event type."
+			return resp
+		}
+
+		webhook.EventTypes = subscribed
+	}
+
+	return nil
+}
+
+func containsEventType(eventTypes []database.EventType, eventType database.EventType) bool {
+	for _, t := range eventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func webhookModel(webhook *database.Webhook, withSecret bool) models.Webhook {
+	model := models.Webhook{
+		ID:          webhook.ID,
+		URL:         webhook.URL,
+		Description: webhook.Description,
+		EventTypes:  []string{},
+		Enabled:     webhook.Enabled,
+		CreatedBy:   webhook.CreatedBy,
+		CreatedAt:   webhook.CreatedAt,
+		UpdatedAt:   webhook.UpdatedAt,
+	}
+
+	for _, eventType := range webhook.EventTypes {
+		model.EventTypes = append(model.EventTypes, string(eventType))
+	}
+
+	if withSecret {
+		model.Secret = webhook.Secret
+	}
+
+	return model
+}
+
+func webhookDeliveryModel(delivery *database.WebhookDelivery) models.WebhookDelivery {
+	model := models.WebhookDelivery{
+		ID:             delivery.ID,
+		WebhookID:      delivery.WebhookID,
+		EventID:        delivery.EventID,
+		EventType:      string(delivery.EventType),
+		Payload:        delivery.Payload,
+		Status:         string(delivery.Status),
+		Attempts:       delivery.Attempts,
+		LastAttemptAt:  delivery.LastAttemptAt,
+		DeliveredAt:    delivery.DeliveredAt,
+		ResponseStatus: delivery.ResponseStatus,
+		ResponseBody:   delivery.ResponseBody,
+		Error:          delivery.Error,
+		DurationMS:     delivery.DurationMS,
+		CreatedAt:      delivery.CreatedAt,
+	}
+
+	// Only pending deliveries are attempted again.
+	if delivery.Status == database.DeliveryPending {
+		nextAttemptAt := delivery.NextAttemptAt
+		model.NextAttemptAt = &nextAttemptAt
+	}
+
+	return model
+}
@@ -46,6 +46,12 @@ type Config struct {
 	TwitchClientSecret string `json:"twitch_client_secret"`
 	TwitchRedirectURL  string `json:"twitch_redirect_url"`
 	TwitchBotUsername  string `json:"twitch_bot_username"`
+
+	// Days after which data is anonymised or deleted, 0 keeps it forever.
+	RetentionIPDays         int    `json:"retention_ip_days"`
+	RetentionIPMode         string `json:"retention_ip_mode"`
+	RetentionTwitchLogsDays int    `json:"retention_twitch_logs_days"`
+	RetentionEventsDays     int    `json:"retention_events_days"`
 }
 
 func LoadConfig(configPath string) (*Config, error) {
@@ -162,5 +168,15 @@ func (c *Config) CheckConfig() error {
 		log.Printf("%s Using * for allowed_domain, NOT RECOMMENDED\n", logging.WarnSign)
 	}
 
+	if c.RetentionIPDays < 0 || c.RetentionTwitchLogsDays < 0 || c.RetentionEventsDays < 0 {
+		return errors.New("invalid retention days: must not be negative")
+	}
+
+	switch c.RetentionIPMode {
+	case "", "truncate", "hash":
+	default:
+		return errors.New("invalid key: retention_ip_mode, must be truncate or hash")
+	}
+
 	return nil
 }
@@ -37,6 +37,22 @@ func LoadEnvConfig() (*Config, error) {
 		return nil, err
 	}
 
+	// Retention is optional, unset values keep data forever.
+	retentionIPDays, err := getEnvIntOptional("retention_ip_days")
+	if err != nil {
+		return nil, err
+	}
+
+	retentionTwitchLogsDays, err := getEnvIntOptional("retention_twitch_logs_days")
+	if err != nil {
+		return nil, err
+	}
+
+	retentionEventsDays, err := getEnvIntOptional("retention_events_days")
+	if err != nil {
+		return nil, err
+	}
+
 	cfg := &Config{
 		PostgresHost:     getEnvString("postgres_host"),
 		PostgresPort:     postgresPort,
@@ -72,6 +88,11 @@ func LoadEnvConfig() (*Config, error) {
 		TwitchClientSecret: getEnvString("twitch_client_secret"),
 		TwitchRedirectURL:  getEnvString("twitch_redirect_url"),
 		TwitchBotUsername:  getEnvString("twitch_bot_username"),
+
+		RetentionIPDays:         retentionIPDays,
+		RetentionIPMode:         getEnvString("retention_ip_mode"),
+		RetentionTwitchLogsDays: retentionTwitchLogsDays,
+		RetentionEventsDays:     retentionEventsDays,
 	}
 
 	return cfg, nil
@@ -86,6 +107,15 @@ func getEnvInt(name string) (int, error) {
 	return strconv.Atoi(valueStr)
 }
 
+// Returns 0 if the variable is not set.
+func getEnvIntOptional(name string) (int, error) {
+	valueStr := os.Getenv(strings.ToUpper(name))
+	if valueStr == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(valueStr)
+}
+
 func getEnvBool(name string) (bool, error) {
 	valueStr := os.Getenv(strings.ToUpper(name))
 	return strconv.ParseBool(valueStr)
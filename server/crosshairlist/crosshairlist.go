@@ -0,0 +1,261 @@
+// Package crosshairlist reads and writes lists of crosshairs for bulk imports and exports of user accounts.
+//
+// Three formats are supported, each export can be imported again:
+//
+//	json: [{"code": "CSGO-...", "note": "main", "tags": ["awp"], "visibility": "public"}]
+//	csv:  a header row with at least the code column, then one crosshair per row: code,note,tags,visibility
+//	text: one share code per line, empty lines and lines starting with # or // are skipped
+//
+// Tags in CSV files are separated by |. Exports additionally contain the time the crosshair
+// was added, it is ignored when importing.
+package crosshairlist
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatCSV  Format = "csv"
+	FormatText Format = "text"
+)
+
+const csvTagSeparator = "|"
+
+var ErrUnknownFormat = errors.New("unknown format, want json, csv or text")
+
+// Entry is one crosshair of a list.
+type Entry struct {
+	// Line in the file (csv, text) or position in the array (json), starting at 1.
+	Line       int        `json:"-"`
+	Code       string     `json:"code"`
+	Note       string     `json:"note"`
+	Tags       []string   `json:"tags"`
+	Visibility string     `json:"visibility,omitempty"`
+	Added      *time.Time `json:"added,omitempty"`
+}
+
+// ParseFormat returns the format by its name, txt is accepted for text as well.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "json":
+		return FormatJSON, nil
+	case "csv":
+		return FormatCSV, nil
+	case "text", "txt":
+		return FormatText, nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+// FormatFromContentType guesses the format from the Content-Type header of a request.
+func FormatFromContentType(contentType string) (Format, error) {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+
+	switch mediaType {
+	case "application/json":
+		return FormatJSON, nil
+	case "text/csv":
+		return FormatCSV, nil
+	case "text/plain":
+		return FormatText, nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatJSON:
+		return "application/json; charset=utf-8"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// Extension returns the file extension for exports, including the dot.
+func (f Format) Extension() string {
+	if f == FormatText {
+		return ".txt"
+	}
+	return "." + string(f)
+}
+
+// Read reads all entries of a list. Codes are not validated, that is up to the caller.
+func Read(format Format, r io.Reader) ([]Entry, error) {
+	switch format {
+	case FormatJSON:
+		return readJSON(r)
+	case FormatCSV:
+		return readCSV(r)
+	case FormatText:
+		return readText(r)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// Write writes the entries as a list which can be read by Read again.
+func Write(format Format, w io.Writer, entries []Entry) error {
+	switch format {
+	case FormatJSON:
+		return writeJSON(w, entries)
+	case FormatCSV:
+		return writeCSV(w, entries)
+	case FormatText:
+		return writeText(w, entries)
+	default:
+		return ErrUnknownFormat
+	}
+}
+
+func readJSON(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		entries[i].Line = i + 1
+		entries[i].Code = strings.TrimSpace(entries[i].Code)
+		entries[i].Note = strings.TrimSpace(entries[i].Note)
+	}
+
+	return entries, nil
+}
+
+func readCSV(r io.Reader) ([]Entry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := columns["code"]; !ok {
+		return nil, errors.New("missing code column in header")
+	}
+
+	var entries []Entry
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		entry := Entry{
+			Line:       line,
+			Code:       field("code"),
+			Note:       field("note"),
+			Visibility: field("visibility"),
+		}
+
+		for _, tag := range strings.Split(field("tags"), csvTagSeparator) {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				entry.Tags = append(entry.Tags, tag)
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func readText(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		code := strings.TrimSpace(scanner.Text())
+		if code == "" || strings.HasPrefix(code, "#") || strings.HasPrefix(code, "//") {
+			continue
+		}
+
+		entries = append(entries, Entry{Line: line, Code: code})
+	}
+
+	return entries, scanner.Err()
+}
+
+func writeJSON(w io.Writer, entries []Entry) error {
+	if entries == nil {
+		entries = []Entry{}
+	}
+
+	for i := range entries {
+		if entries[i].Tags == nil {
+			entries[i].Tags = []string{}
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
+
+func writeCSV(w io.Writer, entries []Entry) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write([]string{"code", "note", "tags", "visibility", "added"}); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		added := ""
+		if entry.Added != nil {
+			added = entry.Added.UTC().Format(time.RFC3339)
+		}
+
+		if err := writer.Write([]string{entry.Code, entry.Note, strings.Join(entry.Tags, csvTagSeparator), entry.Visibility, added}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeText(w io.Writer, entries []Entry) error {
+	for _, entry := range entries {
+		if _, err := fmt.Fprintln(w, entry.Code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package crosshairlist
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	codeMain = "CSGO-O4Jsi-V36wY-rTMGK-9w7qF-jQ8WB"
+	codeAWP  = "CSGO-6G2cS-WzcxT-fH3dp-Rf7oq-X9oJN"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+		want   []Entry
+	}{
+		{
+			name:   "json",
+			format: FormatJSON,
+			input:  `[{"code": " ` + codeMain + ` ", "note": " main ", "tags": ["awp"], "visibility": "public"}, {"code": "` + codeAWP + `"}]`,
+			want: []Entry{
+				{Line: 1, Code: codeMain, Note: "main", Tags: []string{"awp"}, Visibility: "public"},
+				{Line: 2, Code: codeAWP},
+			},
+		},
+		{
+			name:   "csv",
+			format: FormatCSV,
+			input:  "Note,CODE,tags\nmain," + codeMain + ", awp | small |\n," + codeAWP + "\n",
+			want: []Entry{
+				{Line: 2, Code: codeMain, Note: "main", Tags: []string{"awp", "small"}},
+				{Line: 3, Code: codeAWP},
+			},
+		},
+		{
+			name:   "csv with visibility",
+			format: FormatCSV,
+			input:  "code,visibility\n" + codeMain + ",unlisted\n",
+			want: []Entry{
+				{Line: 2, Code: codeMain, Visibility: "unlisted"},
+			},
+		},
+		{
+			name:   "text",
+			format: FormatText,
+			input:  "# my crosshairs\n\n  " + codeMain + "  \n// old one\n" + codeAWP + "\n",
+			want: []Entry{
+				{Line: 3, Code: codeMain},
+				{Line: 5, Code: codeAWP},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(tt.format, strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+	}{
+		{"json object", FormatJSON, `{"code": "` + codeMain + `"}`},
+		{"json syntax", FormatJSON, `[{"code": }]`},
+		{"csv without code column", FormatCSV, "note,tags\nmain,awp\n"},
+		{"csv empty", FormatCSV, ""},
+		{"unknown format", Format("xml"), "<crosshairs/>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(tt.format, strings.NewReader(tt.input)); err == nil {
+				t.Error("Read accepted an invalid list")
+			}
+		})
+	}
+}
+
+// Every export has to be importable again without losing what the import reads.
+func TestWriteReadRoundTrip(t *testing.T) {
+	added := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	exported := []Entry{
+		{Code: codeMain, Note: "main, with comma", Tags: []string{"awp", "small"}, Visibility: "public", Added: &added},
+		{Code: codeAWP, Note: `quoted "note"`, Visibility: "private", Added: &added},
+	}
+
+	tests := []struct {
+		format Format
+		want   []Entry
+	}{
+		{
+			format: FormatJSON,
+			want: []Entry{
+				{Line: 1, Code: codeMain, Note: "main, with comma", Tags: []string{"awp", "small"}, Visibility: "public", Added: &added},
+				{Line: 2, Code: codeAWP, Note: `quoted "note"`, Tags: []string{}, Visibility: "private", Added: &added},
+			},
+		},
+		{
+			format: FormatCSV,
+			want: []Entry{
+				{Line: 2, Code: codeMain, Note: "main, with comma", Tags: []string{"awp", "small"}, Visibility: "public"},
+				{Line: 3, Code: codeAWP, Note: `quoted "note"`, Visibility: "private"},
+			},
+		},
+		{
+			format: FormatText,
+			want: []Entry{
+				{Line: 1, Code: codeMain},
+				{Line: 2, Code: codeAWP},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(tt.format, &buf, append([]Entry(nil), exported...)); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Read(tt.format, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("round trip = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormats(t *testing.T) {
+	names := map[string]Format{
+		"json":  FormatJSON,
+		" CSV ": FormatCSV,
+		"txt":   FormatText,
+		"text":  FormatText,
+	}
+	for name, want := range names {
+		if got, err := ParseFormat(name); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("xml"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("ParseFormat(xml) returned %v", err)
+	}
+
+	contentTypes := map[string]Format{
+		"application/json":         FormatJSON,
+		"text/csv; charset=utf-8":  FormatCSV,
+		"Text/Plain;charset=utf-8": FormatText,
+	}
+	for contentType, want := range contentTypes {
+		if got, err := FormatFromContentType(contentType); err != nil || got != want {
+			t.Errorf("FormatFromContentType(%q) = %q, %v, want %q", contentType, got, err, want)
+		}
+	}
+	if _, err := FormatFromContentType("multipart/form-data"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("FormatFromContentType(multipart/form-data) returned %v", err)
+	}
+
+	if FormatText.Extension() != ".txt" || FormatCSV.Extension() != ".csv" {
+		t.Errorf("unexpected extensions %q and %q", FormatText.Extension(), FormatCSV.Extension())
+	}
+}
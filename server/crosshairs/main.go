@@ -18,10 +18,23 @@ import (
 	"github.com/devusSs/crosshairs/config"
 	"github.com/devusSs/crosshairs/database"
 	"github.com/devusSs/crosshairs/database/postgres"
+	"github.com/devusSs/crosshairs/jobs"
 	"github.com/devusSs/crosshairs/logging"
+	"github.com/devusSs/crosshairs/proimport"
+	"github.com/devusSs/crosshairs/retention"
 	"github.com/devusSs/crosshairs/storage"
 	"github.com/devusSs/crosshairs/updater"
 	"github.com/devusSs/crosshairs/utils"
+	"github.com/devusSs/crosshairs/webhooks"
+)
+
+const (
+	// Amount of background workers running jobs like demo parsing.
+	jobWorkers = 2
+	// Amount of workers sending webhook deliveries.
+	webhookWorkers = 2
+	// How often the data retention policy is applied.
+	retentionInterval = 24 * time.Hour
 )
 
 func main() {
@@ -34,6 +47,8 @@ func main() {
 	debugFlag := flag.Bool("d", false, "enabled debug mode")
 	dockerFlag := flag.Bool("docker", false, "enables Docker mode - uses docker.env instead of config.json file")
 	disableIntegrationsFlag := flag.Bool("disable-integrations", false, "disables integrations like Twitch")
+	importProsFlag := flag.String("import-pros", "", "imports pro players from a .json or .csv file and exits")
+	retentionFlag := flag.Bool("retention", false, "applies the data retention policy once and exits")
 	flag.Parse()
 
 	if !checkNetworkConnection() {
@@ -134,6 +149,34 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *importProsFlag != "" {
+		if err := importProPlayers(svc, *importProsFlag); err != nil {
+			logging.WriteError(err.Error())
+			os.Exit(1)
+		}
+
+		if err := svc.CloseConnection(); err != nil {
+			log.Fatalf("[%s] Error closing database connection: %s\n", logging.ErrSign, err.Error())
+		}
+		return
+	}
+
+	retentionPolicy := retention.PolicyFromConfig(cfg)
+
+	if *retentionFlag {
+		if !retentionPolicy.Enabled() {
+			log.Printf("%s No data retention configured, nothing to do\n", logging.WarnSign)
+		} else if err := applyRetention(svc, retentionPolicy); err != nil {
+			logging.WriteError(err.Error())
+			os.Exit(1)
+		}
+
+		if err := svc.CloseConnection(); err != nil {
+			log.Fatalf("[%s] Error closing database connection: %s\n", logging.ErrSign, err.Error())
+		}
+		return
+	}
+
 	utils.InitMail(cfg)
 
 	storageSvc, err := storage.NewMinioConnection(cfg)
@@ -147,6 +190,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err := storageSvc.CreateCrosshairPreviewsBucket(); err != nil {
+		logging.WriteError(err)
+		os.Exit(1)
+	}
+
 	if err := storageSvc.UpdateUserProfilePicture("sample.png", "./files/sample.png"); err != nil {
 		logging.WriteError(err)
 		os.Exit(1)
@@ -158,6 +206,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	jobsStore, err := jobs.NewRedisStore(cfg.RedisHost, cfg.RedisPort, cfg.RedisPassword)
+	if err != nil {
+		logging.WriteError(err)
+		os.Exit(1)
+	}
+
+	jobsSvc := jobs.NewService(jobsStore)
+
+	webhooksSvc := webhooks.NewService(svc, nil)
+
 	// Add database.Service to middleware.
 	middleware.Svc = svc
 
@@ -207,11 +265,43 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := apiServer.SetupRoutes(svc, storageSvc, cfg, *logsDir, *debugFlag); err != nil {
+	if err := apiServer.SetupRoutes(svc, storageSvc, jobsSvc, webhooksSvc, cfg, *logsDir, *debugFlag); err != nil {
 		logging.WriteError(err)
 		os.Exit(1)
 	}
 
+	// Handlers are registered by SetupRoutes, workers may only start afterwards.
+	jobsSvc.Start(jobWorkers)
+
+	logging.WriteSuccess("Started background job workers")
+
+	webhooksSvc.Start(webhookWorkers)
+
+	logging.WriteSuccess("Started webhook delivery workers")
+
+	// Setup goroutine to purge accounts whose deletion grace period is over every hour.
+	purgeAccountsTicker := time.NewTicker(time.Hour)
+	go func() {
+		for range purgeAccountsTicker.C {
+			purgeDeletedAccounts()
+		}
+	}()
+
+	logging.WriteSuccess("Setup goroutine to purge deleted accounts")
+
+	// Setup goroutine to apply the data retention policy on startup and once a day.
+	retentionTicker := time.NewTicker(retentionInterval)
+	if retentionPolicy.Enabled() {
+		go func() {
+			applyScheduledRetention(svc, retentionPolicy)
+			for range retentionTicker.C {
+				applyScheduledRetention(svc, retentionPolicy)
+			}
+		}()
+
+		logging.WriteSuccess("Setup goroutine to apply data retention")
+	}
+
 	// Integration initialisation
 	if !*disableIntegrationsFlag {
 		if err := integration.InitTwitchAuth(cfg, apiServer, fmt.Sprintf("http://%s:%d", apiServer.Host, apiServer.Port), svc); err != nil {
@@ -229,6 +319,14 @@ func main() {
 
 	// ! App exit.
 	generateNewEngineerTokenTicker.Stop()
+	purgeAccountsTicker.Stop()
+	retentionTicker.Stop()
+
+	if err := jobsSvc.Stop(); err != nil {
+		log.Fatalf("[%s] Error stopping job workers: %s\n", logging.ErrSign, err.Error())
+	}
+
+	webhooksSvc.Stop()
 
 	if err := svc.CloseConnection(); err != nil {
 		log.Fatalf("[%s] Error closing database connection: %s\n", logging.ErrSign, err.Error())
@@ -293,6 +391,62 @@ func checkNetworkConnection() bool {
 	return err == nil
 }
 
+// Imports pro players from a file and prints every row which could not be imported.
+func importProPlayers(svc database.Service, path string) error {
+	rows, err := proimport.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	report, err := proimport.Import(svc, rows)
+	if err != nil {
+		return err
+	}
+
+	for _, rowErr := range report.Errors {
+		log.Printf("%s Skipped %s\n", logging.WarnSign, rowErr.Error())
+	}
+
+	log.Printf("%s Imported %d crosshair(s): %d player(s) created, %d updated, %d row(s) skipped\n",
+		logging.SucSign, report.CrosshairsImported, report.PlayersCreated, report.PlayersUpdated, len(report.Errors))
+
+	return nil
+}
+
+// Purges the accounts whose deletion grace period is over, errors are only logged.
+func purgeDeletedAccounts() {
+	purged, err := routes.PurgeDeletedAccounts()
+	if err != nil {
+		logging.WriteError(fmt.Sprintf("could not purge deleted accounts: %s", err.Error()))
+		return
+	}
+
+	if purged > 0 {
+		logging.WriteInfo(fmt.Sprintf("Purged %d deleted account(s)", purged))
+	}
+}
+
+// Applies the data retention policy and logs what was purged.
+func applyRetention(svc database.Service, policy retention.Policy) error {
+	report, err := retention.Run(svc, policy)
+	if err != nil {
+		return err
+	}
+
+	logging.WriteInfo(fmt.Sprintf("Data retention: anonymised %d user, %d crosshair and %d event IP(s), deleted %d Twitch bot log(s) and %d event(s)",
+		report.AnonymisedIPs.Users, report.AnonymisedIPs.Crosshairs, report.AnonymisedIPs.Events,
+		report.TwitchBotLogsDeleted, report.EventsDeleted))
+
+	return nil
+}
+
+// Applies the data retention policy, errors are only logged.
+func applyScheduledRetention(svc database.Service, policy retention.Policy) {
+	if err := applyRetention(svc, policy); err != nil {
+		logging.WriteError(fmt.Sprintf("could not apply data retention: %s", err.Error()))
+	}
+}
+
 // Checks the Postgres version. If we run below Postgres 14 we will error out.
 //
 // UUID functions only work with Postgres 14+ (as far as I know).
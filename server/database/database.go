@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/devusSs/crosshairs/sharecode"
 	"github.com/google/uuid"
 )
 
@@ -23,16 +24,68 @@ type Service interface {
 	GetUserByEmail(*UserAccount) (*UserAccount, error)
 	UpdateUserLogin(*UserAccount) (*UserAccount, error)
 	GetUserByUID(*UserAccount) (*UserAccount, error)
-	UpdateUserCrosshairCount(*UserAccount) (*UserAccount, error)
+	SetUserCrosshairQuota(uuid.UUID, *int) error
+	GetCrosshairQuota(*UserAccount) (int, error)
+	UpdateUserRole(uuid.UUID, string) error
+	SuspendUser(uuid.UUID, *time.Time, string) error
+	UnsuspendUser(uuid.UUID) error
+	RequirePasswordReset(*UserAccount) error
+	DeleteUser(uuid.UUID) error
+	// A nil time cancels the deletion.
+	ScheduleUserDeletion(uuid.UUID, *time.Time) error
+	GetUsersDueForDeletion(time.Time) ([]*UserAccount, error)
+	CountUsersWithRole(string) (int64, error)
+	GetRoleQuotas() ([]*RoleQuota, error)
+	SetRoleQuota(*RoleQuota) (*RoleQuota, error)
 	AddResetPasswordCodeAndTime(*UserAccount) (*UserAccount, error)
 	GetUserByResetpasswordCode(*UserAccount) (*UserAccount, error)
 	UpdateUserPassword(*UserAccount) (*UserAccount, error)
 	UpdateUserPasswordRaw(*UserAccount) (*UserAccount, error)
 	UpdateVerifyMailResendTime(*UserAccount) (*UserAccount, error)
 	UpdateUserAvatarURL(*UserAccount) (*UserAccount, error)
+	UpdateUserDisplayName(*UserAccount) (*UserAccount, error)
+	GetUsersByUIDs([]uuid.UUID) ([]*UserAccount, error)
 
 	AddUserTwitchDetails(*UserAccount) (*UserAccount, error)
 	GetUserByTwitchLogin(*UserAccount) (*UserAccount, error)
+	GetUserByTwitchID(*UserAccount) (*UserAccount, error)
+	// Verifies the e-mail of a user who never verified it and replaces the password, whoever set it may not own the e-mail.
+	ClaimUnverifiedUser(uuid.UUID, string) error
+
+	GetRoles() ([]*Role, error)
+	GetRole(string) (*Role, error)
+	SaveRole(*Role) (*Role, error)
+	DeleteRole(string) error
+	SetRoleTwoFactorRequired(string, bool) error
+
+	// Two-factor authentication, the TOTP secret is set on enrollment and only used once enabled.
+	SetTOTPSecret(uuid.UUID, string) error
+	// Enables two-factor authentication with the time step of the confirming code and the recovery code hashes.
+	EnableTwoFactor(uuid.UUID, int64, []string) error
+	DisableTwoFactor(uuid.UUID) error
+	// Reports whether the time step is newer than the last used one and stores it, codes can only be used once.
+	UseTOTPStep(uuid.UUID, int64) (bool, error)
+	// Reports whether an unused recovery code with the hash exists and marks it as used.
+	UseRecoveryCode(uuid.UUID, string) (bool, error)
+	ReplaceRecoveryCodes(uuid.UUID, []string) error
+	CountUnusedRecoveryCodes(uuid.UUID) (int64, error)
+	// Counts a wrong code at login and returns the amount of wrong codes since the last correct one.
+	AddTwoFactorFailure(uuid.UUID) (int, error)
+	// Rejects codes at login until the time, whichever session they come from.
+	LockTwoFactor(uuid.UUID, time.Time) error
+	// Removes the wrong codes and the lock after a correct code.
+	ResetTwoFactorFailures(uuid.UUID) error
+
+	// Passkeys (WebAuthn credentials), users log in with them instead of their password.
+	AddPasskey(*Passkey) (*Passkey, error)
+	GetPasskeysFromUser(uuid.UUID) ([]*Passkey, error)
+	GetPasskeyFromUser(uuid.UUID, uuid.UUID) (*Passkey, error)
+	// Returns the passkey with the credential ID the authenticator sent.
+	GetPasskeyByCredentialID([]byte) (*Passkey, error)
+	RenamePasskey(*Passkey) (*Passkey, error)
+	// Stores the sign count, flags and last use after a login.
+	UpdatePasskeyUsage(*Passkey) error
+	DeletePasskeyFromUser(uuid.UUID, uuid.UUID) error
 
 	AddCrosshair(*Crosshair) (*Crosshair, error)
 	GetAllCrosshairsFromUser(uuid.UUID) ([]*Crosshair, error)
@@ -40,21 +93,72 @@ type Service interface {
 	DeleteAllCrosshairsFromUser(uuid.UUID) error
 	DeleteCrosshairFromUserByCode(uuid.UUID, string) error
 	EditCrosshairNote(*Crosshair) (*Crosshair, error)
+	GetCrosshairFromUserByCode(uuid.UUID, string) (*Crosshair, error)
+	GetCrosshairBySlug(string) (*Crosshair, error)
+	UpdateCrosshairVisibility(*Crosshair) (*Crosshair, error)
+	UpdateCrosshairSlug(*Crosshair) (*Crosshair, error)
+	SetCrosshairTags(*Crosshair, []string) (*Crosshair, error)
+	GetPublicCrosshairs(*GalleryQuery) ([]*Crosshair, string, error)
+	GetSimilarPublicCrosshairs(*sharecode.Settings, int) ([]*Crosshair, error)
+	UpdateCrosshairPreviewURL(string, string) error
+	GetCrosshairByID(uuid.UUID) (*Crosshair, error)
+	UpdateCrosshair(*Crosshair, []string) (*Crosshair, error)
+	GetCrosshairRevisions(uuid.UUID) ([]*CrosshairRevision, error)
+	GetCrosshairRevision(uuid.UUID, int) (*CrosshairRevision, error)
+	AddCrosshairCopy(*CrosshairCopy) (bool, error)
+
+	AddFavourite(*Favourite) (bool, error)
+	DeleteFavourite(*Favourite) (bool, error)
+	GetFavouriteCrosshairs(uuid.UUID) ([]*Crosshair, error)
+
+	AddCollection(*Collection) (*Collection, error)
+	GetCollectionsFromUser(uuid.UUID) ([]*Collection, error)
+	GetCollectionByID(uuid.UUID) (*Collection, error)
+	UpdateCollection(*Collection) (*Collection, error)
+	DeleteCollection(uuid.UUID) error
+
+	AddProPlayer(*ProPlayer) (*ProPlayer, error)
+	GetProPlayers() ([]*ProPlayer, error)
+	GetProPlayerByID(uuid.UUID) (*ProPlayer, error)
+	GetProPlayerByName(string) (*ProPlayer, error)
+	UpdateProPlayer(*ProPlayer) (*ProPlayer, error)
+	DeleteProPlayer(uuid.UUID) error
+	GetProPlayersByIDs([]uuid.UUID) ([]*ProPlayer, error)
+	GetSimilarProCrosshairs(*sharecode.Settings, int) ([]*ProCrosshair, error)
 
 	GetAllUsers() ([]*UserAccount, error)
 	GetAllCrosshairs() ([]*Crosshair, error)
 
+	// Also queues a delivery for every enabled webhook subscribed to the type of the event.
 	AddEvent(*Event) (*Event, error)
-	GetEvents() ([]*Event, error)
-	GetEventsByType(string) ([]*Event, error)
-	GetEventsWithLimit(int) ([]*Event, error)
-	GetEventsByTypeWithLimit(string, int) ([]*Event, error)
+	GetEvents(*EventQuery) ([]*Event, string, error)
+
+	AddWebhook(*Webhook) (*Webhook, error)
+	GetWebhooks() ([]*Webhook, error)
+	GetWebhookByID(uuid.UUID) (*Webhook, error)
+	UpdateWebhook(*Webhook) (*Webhook, error)
+	DeleteWebhook(uuid.UUID) error
+	AddWebhookDelivery(*WebhookDelivery) (*WebhookDelivery, error)
+	// Returns up to limit pending deliveries which are due and hides them from other workers for lease.
+	ClaimWebhookDeliveries(int, time.Duration) ([]*WebhookDelivery, error)
+	UpdateWebhookDelivery(*WebhookDelivery) error
+	GetWebhookDeliveries(*WebhookDeliveryQuery) ([]*WebhookDelivery, string, error)
+
+	AddAuditLog(*AuditLog) error
+	GetAuditLogs(*AuditQuery) ([]*AuditLog, string, error)
 
 	WriteTwitchBotLog(*TwitchBotLog) error
 	GetAllTwitchBotLogEntries() ([]*TwitchBotLog, error)
 	GetLatestTwitchBotLogWithLimit(int) ([]*TwitchBotLog, error)
 	GetLatestTwitchBotLogByType(string) ([]*TwitchBotLog, error)
 	GetLatestTwitchBotLogByTypeWithLimit(string, int) ([]*TwitchBotLog, error)
+	// Entries of commands in the channel or used by the Twitch user.
+	GetTwitchBotLogsByTwitchLogin(string) ([]*TwitchBotLog, error)
+
+	// Data retention, IPs stored before the time are replaced with the result of the function.
+	AnonymiseIPs(time.Time, func(string) string) (*AnonymisedIPs, error)
+	DeleteTwitchBotLogsBefore(time.Time) (int64, error)
+	DeleteEventsBefore(time.Time) (int64, error)
 
 	AddTwitchTokenRefreshStore(*TwitchRefreshTokenStore) (*TwitchRefreshTokenStore, error)
 	GetLatestTwitchTokenRefreshStore(*TwitchRefreshTokenStore) (*TwitchRefreshTokenStore, error)
@@ -86,6 +190,9 @@ type UserAccount struct {
 
 	AvatarURL string 
 
+	// Shown instead of the e-mail on shared crosshairs.
+	DisplayName string
+
 	RegisterIP string `gorm:"not null"`
 	LoginIP    string
 	LastLogin  time.Time
@@ -94,10 +201,108 @@ type UserAccount struct {
 	TwitchLogin     string 
 	TwitchCreatedAt time.Time
 
-	// For now we will only allow 20 crosshairs per user.
+	// Kept in sync with the actual amount of crosshairs by AddCrosshair and the delete methods.
 	CrosshairsRegistered int
+	// Overrides the quota of the user's role if set, see RoleQuota.
+	CrosshairQuota *int
+
+	// Set while the user is suspended, a suspension without SuspendedUntil is a ban.
+	SuspendedAt      *time.Time
+	SuspendedUntil   *time.Time
+	SuspensionReason string
+	// Set by admins, the user can not log in again before resetting their password.
+	PasswordResetRequired bool
+	// Set for accounts created or claimed with Twitch, their random password is unknown until they reset it.
+	PasswordUnknown bool `gorm:"not null;default:false"`
+	// Set when the user deleted their account, it is purged at that time unless they log in again before.
+	DeletionScheduledAt *time.Time `gorm:"index"`
+
+	// Base32 TOTP secret, set on enrollment and used once TwoFactorEnabled is set.
+	TOTPSecret       string
+	TwoFactorEnabled bool `gorm:"not null;default:false"`
+	// Time step of the last accepted code.
+	TOTPLastStep int64
+	// Wrong codes at login since the last correct one, too many lock two-factor logins for a while.
+	TwoFactorFailures    int `gorm:"not null;default:0"`
+	TwoFactorLockedUntil *time.Time
+}
+
+// RecoveryCode lets a user log in once without their authenticator app, only its hash is stored.
+type RecoveryCode struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CreatedAt time.Time
+
+	UserID   uuid.UUID `gorm:"type:uuid;not null;index"`
+	CodeHash string    `gorm:"not null"`
+	UsedAt   *time.Time
+}
+
+// Passkey is a WebAuthn credential of a user, the private key never leaves the authenticator.
+type Passkey struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	UserID uuid.UUID `gorm:"type:uuid;not null;index"`
+	// Chosen by the user to tell their passkeys apart.
+	Name string `gorm:"not null"`
+
+	CredentialID    []byte   `gorm:"not null;uniqueIndex"`
+	PublicKey       []byte   `gorm:"not null"`
+	AttestationType string
+	Transports      []string `gorm:"serializer:json"`
+	AAGUID          []byte
+	// Counters of authenticators which keep one only ever increase, see CloneWarning.
+	SignCount uint32
+	// Set once a login had a sign count lower than the stored one, the credential may have been copied.
+	CloneWarning bool
+	// Synced passkeys (e.g. iCloud Keychain, Google Password Manager) are backup eligible.
+	BackupEligible bool
+	BackupState    bool
+
+	LastUsedAt *time.Time
+}
+
+// Reports whether the user is suspended or banned right now.
+func (u *UserAccount) IsSuspended() bool {
+	if u.SuspendedAt == nil {
+		return false
+	}
+	return u.SuspendedUntil == nil || time.Now().Before(*u.SuspendedUntil)
+}
+
+// Role groups permissions, every user has exactly one role (UserAccount.Role).
+type Role struct {
+	Name        string `gorm:"primaryKey"`
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	// Users of the role can not use permission protected routes before enabling two-factor authentication.
+	RequireTwoFactor bool `gorm:"not null;default:false"`
+
+	Permissions []Permission `gorm:"many2many:role_permissions;constraint:OnDelete:CASCADE"`
+}
+
+// Permission allows access to a group of routes, see Permissions for all known ones.
+type Permission struct {
+	Name        string `gorm:"primaryKey"`
+	Description string
 }
 
+// Amount of crosshairs users of a role may save.
+type RoleQuota struct {
+	Role          string `gorm:"primaryKey"`
+	MaxCrosshairs int    `gorm:"not null"`
+	UpdatedAt     time.Time
+}
+
+const (
+	// Quota without any limit.
+	QuotaUnlimited = -1
+	// Used for roles without a configured quota.
+	DefaultCrosshairQuota = 20
+)
+
 type Crosshair struct {
 	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	CreatedAt time.Time
@@ -106,30 +311,198 @@ type Crosshair struct {
 	Code         string    `gorm:"not null"`
 	Note         string
 
+	// Decoded values of Code, stored to make crosshairs queryable by their actual settings.
+	Settings sharecode.Settings `gorm:"embedded;embeddedPrefix:setting_"`
+
+	PreviewURL string
+
+	Visibility CrosshairVisibility `gorm:"not null;default:private"`
+	// Only set once the owner shared the crosshair, nil instead of empty to keep the index unique.
+	Slug *string `gorm:"uniqueIndex"`
+
+	Tags []Tag `gorm:"many2many:crosshair_tags;constraint:OnDelete:CASCADE"`
+	// Amount of times other users saved this crosshair, used for sorting the gallery.
+	SaveCount int `gorm:"not null;default:0"`
+
+	// Set if the crosshair was copied from another user's crosshair.
+	// The source may be deleted since, the author's name is kept for attribution.
+	SourceCrosshairID  *uuid.UUID `gorm:"type:uuid"`
+	OriginalAuthorID   *uuid.UUID `gorm:"type:uuid"`
+	OriginalAuthorName string
+
 	RegisterIP string `gorm:"not null"`
 }
 
-type Event struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+// CrosshairRevision is a previous version of a crosshair, stored whenever the crosshair is edited.
+//
+// Revisions are never updated, restoring one stores the current version as a new revision.
+type CrosshairRevision struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CreatedAt time.Time
+
+	CrosshairID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_crosshair_revision"`
+	// Counts up per crosshair, starting at 1.
+	Version int `gorm:"not null;uniqueIndex:idx_crosshair_revision"`
+
+	Code     string `gorm:"not null"`
+	Note     string
+	Settings sharecode.Settings `gorm:"embedded;embeddedPrefix:setting_"`
+	Tags     []string           `gorm:"serializer:json"`
+
+	Crosshair Crosshair `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// Favourite is a bookmark of another user's crosshair, removed with the crosshair.
+type Favourite struct {
+	UserID      uuid.UUID `gorm:"type:uuid;primaryKey"`
+	CrosshairID uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	CreatedAt   time.Time
+
+	Crosshair Crosshair `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// CrosshairCopy records that a user copied another user's crosshair, so each user only counts once.
+type CrosshairCopy struct {
+	UserID      uuid.UUID `gorm:"type:uuid;primaryKey"`
+	CrosshairID uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	CreatedAt   time.Time
+
+	Crosshair Crosshair `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// Collection is a named group of crosshairs of one user, e.g. all crosshairs they use for the AWP.
+type Collection struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	CreatedAt time.Time
-	Type      EventType `gorm:"embedded;not null" json:"type"`
-	Data      EventData `gorm:"embedded;not null" json:"data"`
-	Timestamp time.Time `gorm:"not null" json:"timestamp"`
+	UpdatedAt time.Time
+
+	OwnerID     uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_collection_name"`
+	Name        string    `gorm:"not null;uniqueIndex:idx_collection_name"`
+	Description string
+
+	Items []CollectionItem `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// CollectionItem places a crosshair in a collection, removed with either of them.
+type CollectionItem struct {
+	CollectionID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	CrosshairID  uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	// Order of the crosshair in the collection, starting at 0.
+	Position int `gorm:"not null"`
+
+	Crosshair Crosshair `gorm:"constraint:OnDelete:CASCADE"`
 }
 
-// Submodels for Event struct.
-type EventType string
+type Tag struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"uniqueIndex;not null"`
+}
+
+type CrosshairVisibility string
 
 const (
-	UserRegistered      EventType = "user_registered"
-	UserChangedPassword EventType = "user_password_change"
-	UserUploadedAvatar  EventType = "user_uploaded_avatar"
+	// Only visible to the owner.
+	VisibilityPrivate CrosshairVisibility = "private"
+	// Visible to everyone with the share link.
+	VisibilityUnlisted CrosshairVisibility = "unlisted"
+	// Visible to everyone, also listed publicly.
+	VisibilityPublic CrosshairVisibility = "public"
 )
 
-type EventData struct {
-	URL      string `json:"url"`
-	Method   string `json:"method"`
-	IssuerIP string `json:"issuer"`
+// IsValid reports whether the visibility is one of the known values.
+func (v CrosshairVisibility) IsValid() bool {
+	return v == VisibilityPrivate || v == VisibilityUnlisted || v == VisibilityPublic
+}
+
+// ProPlayer is a professional player whose crosshairs are curated by admins.
+type ProPlayer struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Name string `gorm:"uniqueIndex;not null"`
+	Team string
+	// Where the crosshair is from, e.g. a link to a tweet or config database.
+	Source string
+	// When an admin last checked the crosshair is still in use.
+	LastVerified time.Time
+
+	Crosshairs []ProCrosshair `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+type ProCrosshair struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CreatedAt time.Time
+
+	ProPlayerID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Code        string    `gorm:"not null"`
+	Note        string
+
+	Settings sharecode.Settings `gorm:"embedded;embeddedPrefix:setting_"`
+
+	PreviewURL string
+}
+
+type GallerySort string
+
+const (
+	SortNewest    GallerySort = "newest"
+	SortMostSaved GallerySort = "most_saved"
+)
+
+// GalleryQuery filters and pages the public crosshairs, nil / empty fields are not filtered on.
+type GalleryQuery struct {
+	// Full text search over the notes.
+	Search string
+	// Crosshairs need to have all of the tags.
+	Tags    []string
+	Style   *int
+	Color   *int
+	MinSize *float64
+	MaxSize *float64
+
+	Sort GallerySort
+	// Cursor returned with the previous page, empty for the first page.
+	Cursor string
+	Limit  int
+}
+
+// AuditLog records a privileged request (e.g. to an admin route), entries can not be changed or deleted.
+type AuditLog struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CreatedAt time.Time `gorm:"index"`
+
+	RequestID string    `gorm:"not null;index"`
+	ActorID   uuid.UUID `gorm:"type:uuid;not null;index"`
+	ActorIP   string
+
+	Method string `gorm:"not null"`
+	// Route pattern, e.g. /api/admins/pros/:id, URL is the actual request URL.
+	Route  string `gorm:"not null"`
+	URL    string `gorm:"not null"`
+	Status int    `gorm:"not null"`
+
+	// Set by the handler (e.g. user.suspend), defaults to method and route.
+	Action     string `gorm:"not null;index"`
+	TargetType string `gorm:"index:idx_audit_target"`
+	TargetID   string `gorm:"index:idx_audit_target"`
+	// JSON of the target before and after the action, null if there was none.
+	Before json.RawMessage `gorm:"type:jsonb;serializer:json"`
+	After  json.RawMessage `gorm:"type:jsonb;serializer:json"`
+}
+
+// AuditQuery filters and pages the audit log, nil / empty fields are not filtered on.
+type AuditQuery struct {
+	ActorID    *uuid.UUID
+	Action     string
+	TargetType string
+	TargetID   string
+	From       *time.Time
+	To         *time.Time
+
+	// Cursor returned with the previous page, empty for the first page.
+	Cursor string
+	Limit  int
 }
 
 type TwitchBotLog struct {
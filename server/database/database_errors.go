@@ -6,6 +6,11 @@ import (
 	"gorm.io/gorm"
 )
 
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrQuotaExceeded = errors.New("crosshair quota exceeded")
+)
+
 // https://github.com/go-gorm/gorm/blob/master/errors.go
 func CheckDatabaseError(err error) string {
 	if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -18,3 +23,13 @@ func CheckDatabaseError(err error) string {
 
 	return err.Error()
 }
+
+// IsNotFoundError reports whether the error was caused by a missing record.
+func IsNotFoundError(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+// IsDuplicateError reports whether the error was caused by a unique constraint.
+func IsDuplicateError(err error) bool {
+	return errors.Is(err, gorm.ErrDuplicatedKey)
+}
@@ -0,0 +1,227 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Event struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"index"`
+	Type      EventType `gorm:"embedded;not null" json:"type"`
+	Data      EventData `gorm:"embedded;not null" json:"data"`
+	// User the event is about (e.g. the suspended user for admin actions), nil if unknown.
+	UserID   *uuid.UUID    `gorm:"type:uuid;index" json:"user_id"`
+	Severity EventSeverity `gorm:"not null;default:info;index" json:"severity"`
+	// JSON of the payload struct of the type (see below), null for types without payload.
+	Payload   json.RawMessage `gorm:"type:jsonb;serializer:json" json:"payload"`
+	Timestamp time.Time       `gorm:"not null" json:"timestamp"`
+}
+
+// Submodels for Event struct.
+type EventType string
+
+const (
+	UserRegistered      EventType = "user_registered"
+	UserChangedPassword EventType = "user_password_change"
+	UserUploadedAvatar  EventType = "user_uploaded_avatar"
+	UserLoggedIn        EventType = "user_logged_in"
+	UserLoggedOut       EventType = "user_logged_out"
+	UserLoginFailed     EventType = "user_login_failed"
+	UserExportedData    EventType = "user_exported_data"
+
+	// Users deleting their own account, it is purged after a grace period unless they log in again.
+	UserDeletionRequested EventType = "user_deletion_requested"
+	UserDeletionCancelled EventType = "user_deletion_cancelled"
+	UserPurged            EventType = "user_purged"
+
+	UserEnabledTwoFactor  EventType = "user_enabled_two_factor"
+	UserDisabledTwoFactor EventType = "user_disabled_two_factor"
+	UserUsedRecoveryCode  EventType = "user_used_recovery_code"
+
+	UserAddedPasskey   EventType = "user_added_passkey"
+	UserRemovedPasskey EventType = "user_removed_passkey"
+
+	CrosshairAdded   EventType = "crosshair_added"
+	CrosshairDeleted EventType = "crosshair_deleted"
+
+	TwitchConnected    EventType = "twitch_connected"
+	TwitchDisconnected EventType = "twitch_disconnected"
+
+	// Recorded by the data retention whenever it anonymised or deleted something.
+	RetentionPurged EventType = "retention_purged"
+
+	// Actions of admins on other users, the affected user is the UserID of the event.
+	AdminSuspendedUser   EventType = "admin_suspended_user"
+	AdminBannedUser      EventType = "admin_banned_user"
+	AdminUnsuspendedUser EventType = "admin_unsuspended_user"
+	AdminForcedPassReset EventType = "admin_forced_password_reset"
+	AdminChangedUserRole EventType = "admin_changed_user_role"
+	AdminDeletedUser     EventType = "admin_deleted_user"
+	AdminResetTwoFactor  EventType = "admin_reset_two_factor"
+)
+
+// Every event type, used to validate filters.
+var EventTypes = []EventType{
+	UserRegistered, UserChangedPassword, UserUploadedAvatar,
+	UserLoggedIn, UserLoggedOut, UserLoginFailed, UserExportedData,
+	UserDeletionRequested, UserDeletionCancelled, UserPurged,
+	UserEnabledTwoFactor, UserDisabledTwoFactor, UserUsedRecoveryCode,
+	UserAddedPasskey, UserRemovedPasskey,
+	CrosshairAdded, CrosshairDeleted,
+	TwitchConnected, TwitchDisconnected,
+	RetentionPurged,
+	AdminSuspendedUser, AdminBannedUser, AdminUnsuspendedUser,
+	AdminForcedPassReset, AdminChangedUserRole, AdminDeletedUser,
+	AdminResetTwoFactor,
+}
+
+// IsKnownEventType reports whether the type is one of EventTypes.
+func IsKnownEventType(name string) bool {
+	for _, eventType := range EventTypes {
+		if string(eventType) == name {
+			return true
+		}
+	}
+	return false
+}
+
+type EventSeverity string
+
+const (
+	SeverityInfo     EventSeverity = "info"
+	SeverityWarning  EventSeverity = "warning"
+	SeverityCritical EventSeverity = "critical"
+)
+
+// IsValid reports whether the severity is one of the known severities.
+func (s EventSeverity) IsValid() bool {
+	switch s {
+	case SeverityInfo, SeverityWarning, SeverityCritical:
+		return true
+	}
+	return false
+}
+
+// Severity events of the type are stored with.
+func (t EventType) Severity() EventSeverity {
+	switch t {
+	case UserLoginFailed, UserDeletionRequested, UserDisabledTwoFactor, UserUsedRecoveryCode, UserRemovedPasskey,
+		AdminSuspendedUser, AdminBannedUser, AdminForcedPassReset, AdminChangedUserRole, AdminResetTwoFactor:
+		return SeverityWarning
+	case UserPurged, AdminDeletedUser:
+		return SeverityCritical
+	}
+	return SeverityInfo
+}
+
+type EventData struct {
+	URL      string `json:"url"`
+	Method   string `json:"method"`
+	IssuerIP string `json:"issuer"`
+}
+
+// Payload of UserLoggedIn events.
+type LoginPayload struct {
+	Method string `json:"method"`
+}
+
+// Methods of LoginPayload.
+const (
+	LoginMethodPassword = "password"
+	LoginMethodPasskey  = "passkey"
+	LoginMethodTwitch   = "twitch"
+)
+
+// Payload of UserLoginFailed events.
+type LoginFailedPayload struct {
+	EMail string `json:"e_mail"`
+	// e.g. unknown_e_mail or wrong_password.
+	Reason string `json:"reason"`
+}
+
+// Payload of UserDeletionRequested events.
+type DeletionPayload struct {
+	ScheduledAt time.Time `json:"scheduled_at"`
+}
+
+// Payload of UserAddedPasskey and UserRemovedPasskey events.
+type PasskeyPayload struct {
+	PasskeyID uuid.UUID `json:"passkey_id"`
+	Name      string    `json:"name"`
+}
+
+// Payload of CrosshairAdded and CrosshairDeleted events.
+type CrosshairPayload struct {
+	// Not set if all crosshairs of the user were deleted at once.
+	CrosshairID *uuid.UUID `json:"crosshair_id,omitempty"`
+	Code        string     `json:"code,omitempty"`
+}
+
+// Payload of TwitchConnected and TwitchDisconnected events.
+type TwitchPayload struct {
+	TwitchID    string `json:"twitch_id"`
+	TwitchLogin string `json:"twitch_login"`
+}
+
+// Payload of RetentionPurged events.
+type RetentionPayload struct {
+	AnonymisedIPs        AnonymisedIPs `json:"anonymised_ips"`
+	TwitchBotLogsDeleted int64         `json:"twitch_bot_logs_deleted"`
+	EventsDeleted        int64         `json:"events_deleted"`
+}
+
+// Amount of IPs anonymised per table.
+type AnonymisedIPs struct {
+	Users      int64 `json:"users"`
+	Crosshairs int64 `json:"crosshairs"`
+	Events     int64 `json:"events"`
+}
+
+// Total returns the amount of anonymised IPs and deleted rows.
+func (p RetentionPayload) Total() int64 {
+	return p.AnonymisedIPs.Users + p.AnonymisedIPs.Crosshairs + p.AnonymisedIPs.Events + p.TwitchBotLogsDeleted + p.EventsDeleted
+}
+
+// Payload of the admin events.
+type AdminActionPayload struct {
+	ActorID uuid.UUID `json:"actor_id"`
+	// Set for suspensions and bans.
+	Reason string     `json:"reason,omitempty"`
+	Until  *time.Time `json:"until,omitempty"`
+	// Set for role changes.
+	Role string `json:"role,omitempty"`
+}
+
+// NewEvent returns an event of the type with its severity and the payload (nil for none) as JSON.
+//
+// Request data is filled in by the caller.
+func NewEvent(eventType EventType, userID *uuid.UUID, payload interface{}) *Event {
+	event := &Event{
+		Type:      eventType,
+		UserID:    userID,
+		Severity:  eventType.Severity(),
+		Timestamp: time.Now(),
+	}
+
+	if payload != nil {
+		event.Payload, _ = json.Marshal(payload)
+	}
+
+	return event
+}
+
+// EventQuery filters and pages events, nil / empty fields are not filtered on.
+type EventQuery struct {
+	Type     EventType
+	UserID   *uuid.UUID
+	Severity EventSeverity
+	From     *time.Time
+	To       *time.Time
+
+	// Cursor returned with the previous page, empty for the first page.
+	Cursor string
+	Limit  int
+}
@@ -0,0 +1,56 @@
+package database
+
+// Permissions checked by the API, every permission is created on migration.
+const (
+	PermUsersRead      = "users:read"
+	PermUsersManage    = "users:manage"
+	PermCrosshairsRead = "crosshairs:read"
+	PermLogsRead       = "logs:read"
+	PermEventsRead     = "events:read"
+	PermStatsRead      = "stats:read"
+	PermStatsSystem    = "stats:system"
+	PermProsManage     = "pros:manage"
+	PermQuotasManage   = "quotas:manage"
+	PermRolesManage    = "roles:manage"
+	PermAuditRead      = "audit:read"
+	PermWebhooksManage = "webhooks:manage"
+)
+
+// Roles which always exist and can not be changed or deleted.
+const (
+	// Given to every registered user, has no permissions by default.
+	RoleUser = "user"
+	// Has every permission, new permissions are granted on migration.
+	RoleAdmin = "admin"
+)
+
+// Permissions lists every known permission with its description.
+var Permissions = []Permission{
+	{Name: PermUsersRead, Description: "List and look up user accounts"},
+	{Name: PermUsersManage, Description: "Suspend, ban and delete users and force password resets"},
+	{Name: PermCrosshairsRead, Description: "List the crosshairs of all users"},
+	{Name: PermLogsRead, Description: "Read the API logs"},
+	{Name: PermEventsRead, Description: "Read events"},
+	{Name: PermStatsRead, Description: "Read request and usage statistics"},
+	{Name: PermStatsSystem, Description: "Read system statistics of the host (engineer token required as well)"},
+	{Name: PermProsManage, Description: "Add, edit and delete pro players"},
+	{Name: PermQuotasManage, Description: "Change crosshair quotas of roles and users"},
+	{Name: PermRolesManage, Description: "Create, edit and delete roles and assign them to users"},
+	{Name: PermAuditRead, Description: "Read and export the audit log"},
+	{Name: PermWebhooksManage, Description: "Configure webhooks and read their delivery log"},
+}
+
+// IsKnownPermission reports whether the permission is one of Permissions.
+func IsKnownPermission(name string) bool {
+	for _, perm := range Permissions {
+		if perm.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBuiltinRole reports whether the role is created by the application itself.
+func IsBuiltinRole(name string) bool {
+	return name == RoleUser || name == RoleAdmin
+}
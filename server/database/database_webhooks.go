@@ -0,0 +1,128 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sent by test deliveries, not a real event so webhooks can not subscribe to it.
+const WebhookPing EventType = "ping"
+
+// Webhook is an URL events are POSTed to, configured by admins.
+type Webhook struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	URL         string `gorm:"not null"`
+	Description string
+	// Key for the HMAC signature of every delivery, only shown on creation and rotation.
+	Secret     string      `gorm:"not null"`
+	EventTypes []EventType `gorm:"type:jsonb;serializer:json;not null"`
+	Enabled    bool        `gorm:"not null"`
+	CreatedBy  uuid.UUID   `gorm:"type:uuid"`
+}
+
+// SubscribedTo reports whether events of the type are sent to the webhook.
+func (w *Webhook) SubscribedTo(eventType EventType) bool {
+	for _, subscribed := range w.EventTypes {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	// Waiting for its first attempt or a retry.
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	// Ran out of attempts or can not be delivered anymore (e.g. webhook deleted).
+	DeliveryFailed WebhookDeliveryStatus = "failed"
+)
+
+// IsValid reports whether the status is one of the known statuses.
+func (s WebhookDeliveryStatus) IsValid() bool {
+	switch s {
+	case DeliveryPending, DeliverySucceeded, DeliveryFailed:
+		return true
+	}
+	return false
+}
+
+// WebhookDelivery is an event queued for a webhook, it stays as log entry once delivered or failed.
+type WebhookDelivery struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CreatedAt time.Time `gorm:"index"`
+	UpdatedAt time.Time
+
+	WebhookID uuid.UUID `gorm:"type:uuid;not null;index"`
+	// Nil for test deliveries.
+	EventID   *uuid.UUID `gorm:"type:uuid"`
+	EventType EventType  `gorm:"not null"`
+	// Request body, JSON of a WebhookPayload.
+	Payload json.RawMessage `gorm:"type:jsonb;serializer:json;not null"`
+
+	Status        WebhookDeliveryStatus `gorm:"not null;index"`
+	Attempts      int                   `gorm:"not null"`
+	NextAttemptAt time.Time             `gorm:"not null;index"`
+	LastAttemptAt *time.Time
+	DeliveredAt   *time.Time
+
+	// Result of the last attempt, ResponseStatus is 0 if there was no response.
+	ResponseStatus int
+	ResponseBody   string
+	Error          string
+	DurationMS     int64
+}
+
+// WebhookPayload is the body POSTed to webhooks.
+type WebhookPayload struct {
+	// ID of the event, random for test deliveries.
+	ID        uuid.UUID       `json:"id"`
+	Type      EventType       `json:"type"`
+	Severity  EventSeverity   `json:"severity"`
+	UserID    *uuid.UUID      `json:"user_id"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewWebhookDelivery returns a pending delivery of the event to the webhook.
+func NewWebhookDelivery(webhookID uuid.UUID, event *Event) *WebhookDelivery {
+	payload := WebhookPayload{
+		ID:        event.ID,
+		Type:      event.Type,
+		Severity:  event.Severity,
+		UserID:    event.UserID,
+		Payload:   event.Payload,
+		CreatedAt: event.CreatedAt,
+	}
+
+	// Can not fail, every field is JSON already.
+	body, _ := json.Marshal(payload)
+
+	eventID := event.ID
+
+	return &WebhookDelivery{
+		WebhookID:     webhookID,
+		EventID:       &eventID,
+		EventType:     event.Type,
+		Payload:       body,
+		Status:        DeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+}
+
+// WebhookDeliveryQuery filters and pages the deliveries of a webhook, empty fields are not filtered on.
+type WebhookDeliveryQuery struct {
+	WebhookID uuid.UUID
+	Status    WebhookDeliveryStatus
+
+	// Cursor returned with the previous page, empty for the first page.
+	Cursor string
+	Limit  int
+}
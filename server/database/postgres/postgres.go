@@ -1,6 +1,8 @@
 package postgres
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 
 	"github.com/devusSs/crosshairs/config"
@@ -11,9 +13,25 @@ import (
 )
 
 const (
-	tableUsers      = "user_accounts"
-	tableCrosshairs = "crosshairs"
-	tableEvents     = "events"
+	tableUsers           = "user_accounts"
+	tableCrosshairs      = "crosshairs"
+	tableEvents          = "events"
+	tableRevisions       = "crosshair_revisions"
+	tableFavourites      = "favourites"
+	tableCrosshairCopies = "crosshair_copies"
+	tableProPlayers      = "pro_players"
+	tableProCHs          = "pro_crosshairs"
+	tableRoleQuotas      = "role_quotas"
+	tableCollections     = "collections"
+	tableCollectionItems = "collection_items"
+	tableRoles           = "roles"
+	tablePermissions     = "permissions"
+	tableRolePerms       = "role_permissions"
+	tableAuditLogs       = "audit_logs"
+	tableWebhooks        = "webhooks"
+	tableDeliveries      = "webhook_deliveries"
+	tableRecoveryCodes   = "recovery_codes"
+	tablePasskeys        = "passkeys"
 )
 
 type psql struct {
@@ -58,12 +76,68 @@ func (p *psql) MakeMigrations() error {
 	if err := p.db.AutoMigrate(&database.UserAccount{}); err != nil {
 		return err
 	}
+	if err := p.db.AutoMigrate(&database.Tag{}); err != nil {
+		return err
+	}
 	if err := p.db.AutoMigrate(&database.Crosshair{}); err != nil {
 		return err
 	}
+	if err := p.migrateCrosshairSettings(); err != nil {
+		return err
+	}
+	// Index for the full text search over crosshair notes in the gallery.
+	if err := p.db.Exec("CREATE INDEX IF NOT EXISTS idx_crosshairs_note_search ON crosshairs USING GIN (to_tsvector('simple', note))").Error; err != nil {
+		return err
+	}
+	if err := p.db.AutoMigrate(&database.RecoveryCode{}); err != nil {
+		return err
+	}
+	if err := p.db.AutoMigrate(&database.Passkey{}); err != nil {
+		return err
+	}
+	if err := p.migrateRoles(); err != nil {
+		return err
+	}
+	if err := p.migrateRoleQuotas(); err != nil {
+		return err
+	}
+	// Counts were not decreased on deletion in the past.
+	if err := p.db.Exec("UPDATE user_accounts SET crosshairs_registered = (SELECT COUNT(*) FROM crosshairs WHERE crosshairs.registrant_id = user_accounts.id)").Error; err != nil {
+		return err
+	}
+	if err := p.db.AutoMigrate(&database.CrosshairRevision{}); err != nil {
+		return err
+	}
+	if err := p.db.AutoMigrate(&database.Favourite{}); err != nil {
+		return err
+	}
+	if err := p.db.AutoMigrate(&database.CrosshairCopy{}); err != nil {
+		return err
+	}
+	if err := p.db.AutoMigrate(&database.Collection{}); err != nil {
+		return err
+	}
+	if err := p.db.AutoMigrate(&database.CollectionItem{}); err != nil {
+		return err
+	}
+	if err := p.db.AutoMigrate(&database.ProPlayer{}); err != nil {
+		return err
+	}
+	if err := p.db.AutoMigrate(&database.ProCrosshair{}); err != nil {
+		return err
+	}
 	if err := p.db.AutoMigrate(&database.Event{}); err != nil {
 		return err
 	}
+	if err := p.db.AutoMigrate(&database.Webhook{}); err != nil {
+		return err
+	}
+	if err := p.db.AutoMigrate(&database.WebhookDelivery{}); err != nil {
+		return err
+	}
+	if err := p.migrateAuditLogs(); err != nil {
+		return err
+	}
 	if err := p.db.AutoMigrate(&database.EngineerToken{}); err != nil {
 		return err
 	}
@@ -95,3 +169,20 @@ func (p *psql) GetLatestEngineerToken() (string, error) {
 	tx := p.db.Table("engineer_tokens").Last(&token)
 	return token.Token, tx.Error
 }
+
+// Cursors mark the last element of a page for keyset pagination, clients get them as an opaque string.
+func encodeCursor(cursor interface{}) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string, into interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return database.ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, into); err != nil {
+		return database.ErrInvalidCursor
+	}
+	return nil
+}
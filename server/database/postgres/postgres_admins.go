@@ -1,6 +1,12 @@
 package postgres
 
-import "github.com/devusSs/crosshairs/database"
+import (
+	"time"
+
+	"github.com/devusSs/crosshairs/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
 
 func (p *psql) GetAllUsers() ([]*database.UserAccount, error) {
 	var users []*database.UserAccount
@@ -10,6 +16,99 @@ func (p *psql) GetAllUsers() ([]*database.UserAccount, error) {
 
 func (p *psql) GetAllCrosshairs() ([]*database.Crosshair, error) {
 	var crosshairs []*database.Crosshair
-	tx := p.db.Table(tableCrosshairs).Find(&crosshairs)
+	tx := p.db.Table(tableCrosshairs).Preload("Tags").Find(&crosshairs)
 	return crosshairs, tx.Error
 }
+
+func (p *psql) SuspendUser(user uuid.UUID, until *time.Time, reason string) error {
+	return updateUserByID(p.db, user, map[string]interface{}{
+		"suspended_at":      time.Now(),
+		"suspended_until":   until,
+		"suspension_reason": reason,
+	})
+}
+
+func (p *psql) UnsuspendUser(user uuid.UUID) error {
+	return updateUserByID(p.db, user, map[string]interface{}{
+		"suspended_at":      nil,
+		"suspended_until":   nil,
+		"suspension_reason": "",
+	})
+}
+
+// Stores the reset code of the user as well, the flag is removed once the password was changed.
+func (p *psql) RequirePasswordReset(user *database.UserAccount) error {
+	return updateUserByID(p.db, user.ID, map[string]interface{}{
+		"password_reset_required":  true,
+		"password_reset_code":      user.PasswordResetCode,
+		"password_reset_code_time": user.PasswordResetCodeTime,
+	})
+}
+
+// Deletes the user with their crosshairs, favourites, copy records, collections, events, recovery codes, Twitch tokens and Twitch bot logs.
+//
+// Copies of their crosshairs saved by other users are kept. So are admin_* events about the user, the
+// moderation history should survive the account.
+func (p *psql) DeleteUser(user uuid.UUID) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		var account database.UserAccount
+		if err := tx.Table(tableUsers).Where("id = ?", user).First(&account).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Table(tableFavourites).Where("user_id = ?", user).Delete(&database.Favourite{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Table(tableCrosshairCopies).Where("user_id = ?", user).Delete(&database.CrosshairCopy{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Table(tableCollections).Where("owner_id = ?", user).Delete(&database.Collection{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Table(tableCrosshairs).Where("registrant_id = ?", user).Delete(&database.Crosshair{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Table(tableEvents).Where("user_id = ? AND type NOT LIKE ?", user, `admin\_%`).Delete(&database.Event{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Table(tableRecoveryCodes).Where("user_id = ?", user).Delete(&database.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Table(tablePasskeys).Where("user_id = ?", user).Delete(&database.Passkey{}).Error; err != nil {
+			return err
+		}
+		if account.TwitchLogin != "" {
+			if err := tx.Table("twitch_refresh_token_stores").Where("twitch_login = ?", account.TwitchLogin).Delete(&database.TwitchRefreshTokenStore{}).Error; err != nil {
+				return err
+			}
+			if err := twitchBotLogsOf(tx, account.TwitchLogin).Delete(&database.TwitchBotLog{}).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Table(tableUsers).Where("id = ?", user).Delete(&database.UserAccount{}).Error
+	})
+}
+
+func (p *psql) ScheduleUserDeletion(user uuid.UUID, at *time.Time) error {
+	return updateUserByID(p.db, user, map[string]interface{}{
+		"deletion_scheduled_at": at,
+	})
+}
+
+func (p *psql) GetUsersDueForDeletion(now time.Time) ([]*database.UserAccount, error) {
+	var users []*database.UserAccount
+	tx := p.db.Table(tableUsers).Where("deletion_scheduled_at <= ?", now).Find(&users)
+	return users, tx.Error
+}
+
+func updateUserByID(db *gorm.DB, user uuid.UUID, values map[string]interface{}) error {
+	tx := db.Table(tableUsers).Where("id = ?", user).Updates(values)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/devusSs/crosshairs/database"
+	"github.com/google/uuid"
+)
+
+// Rejects any change to written audit log entries, also for queries not going through the API.
+//
+// Executed one by one, prepared statements may only contain a single command.
+var auditImmutableTrigger = []string{
+	`CREATE OR REPLACE FUNCTION audit_logs_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit log entries can not be changed or deleted';
+END;
+$$ LANGUAGE plpgsql`,
+	"DROP TRIGGER IF EXISTS audit_logs_immutable ON audit_logs",
+	"CREATE TRIGGER audit_logs_immutable BEFORE UPDATE OR DELETE ON audit_logs FOR EACH ROW EXECUTE FUNCTION audit_logs_immutable()",
+}
+
+func (p *psql) migrateAuditLogs() error {
+	if err := p.db.AutoMigrate(&database.AuditLog{}); err != nil {
+		return err
+	}
+	for _, statement := range auditImmutableTrigger {
+		if err := p.db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type auditCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        uuid.UUID `json:"i"`
+}
+
+func (p *psql) AddAuditLog(entry *database.AuditLog) error {
+	return p.db.Table(tableAuditLogs).Create(entry).Error
+}
+
+// Returns a page of audit log entries (newest first) and the cursor of the next page (empty on the last page).
+func (p *psql) GetAuditLogs(query *database.AuditQuery) ([]*database.AuditLog, string, error) {
+	tx := p.db.Table(tableAuditLogs)
+
+	if query.ActorID != nil {
+		tx = tx.Where("actor_id = ?", *query.ActorID)
+	}
+
+	if query.Action != "" {
+		tx = tx.Where("action = ?", query.Action)
+	}
+
+	if query.TargetType != "" {
+		tx = tx.Where("target_type = ?", query.TargetType)
+	}
+
+	if query.TargetID != "" {
+		tx = tx.Where("target_id = ?", query.TargetID)
+	}
+
+	if query.From != nil {
+		tx = tx.Where("created_at >= ?", *query.From)
+	}
+
+	if query.To != nil {
+		tx = tx.Where("created_at < ?", *query.To)
+	}
+
+	if query.Cursor != "" {
+		var cursor auditCursor
+		if err := decodeCursor(query.Cursor, &cursor); err != nil {
+			return nil, "", err
+		}
+		tx = tx.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+
+	// Fetch one more to know whether there is another page.
+	var entries []*database.AuditLog
+	if err := tx.Order("created_at desc, id desc").Limit(query.Limit + 1).Find(&entries).Error; err != nil {
+		return nil, "", err
+	}
+
+	if len(entries) <= query.Limit {
+		return entries, "", nil
+	}
+
+	entries = entries[:query.Limit]
+	last := entries[len(entries)-1]
+
+	return entries, encodeCursor(auditCursor{last.CreatedAt, last.ID}), nil
+}
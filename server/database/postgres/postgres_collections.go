@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/devusSs/crosshairs/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Creates the collection with its items, the positions of the items are set from their order.
+func (p *psql) AddCollection(col *database.Collection) (*database.Collection, error) {
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(tableCollections).Omit(clause.Associations).Create(col).Error; err != nil {
+			return err
+		}
+		return createCollectionItems(tx, col)
+	})
+	return col, err
+}
+
+// Gets the collections of a user with their crosshairs, sorted by name.
+func (p *psql) GetCollectionsFromUser(user uuid.UUID) ([]*database.Collection, error) {
+	var collections []*database.Collection
+	tx := preloadCollectionItems(p.db.Table(tableCollections)).Where("owner_id = ?", user).Order("name asc").Find(&collections)
+	return collections, tx.Error
+}
+
+func (p *psql) GetCollectionByID(id uuid.UUID) (*database.Collection, error) {
+	var col database.Collection
+	tx := preloadCollectionItems(p.db.Table(tableCollections)).Where("id = ?", id).First(&col)
+	return &col, tx.Error
+}
+
+// Updates name and description of the collection and replaces all of its items.
+func (p *psql) UpdateCollection(col *database.Collection) (*database.Collection, error) {
+	col.UpdatedAt = time.Now()
+
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(tableCollections).Where("id = ?", col.ID).Updates(map[string]interface{}{
+			"name":        col.Name,
+			"description": col.Description,
+			"updated_at":  col.UpdatedAt,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Table(tableCollectionItems).Where("collection_id = ?", col.ID).Delete(&database.CollectionItem{}).Error; err != nil {
+			return err
+		}
+
+		return createCollectionItems(tx, col)
+	})
+
+	return col, err
+}
+
+func (p *psql) DeleteCollection(id uuid.UUID) error {
+	tx := p.db.Table(tableCollections).Where("id = ?", id).Delete(&database.Collection{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func createCollectionItems(tx *gorm.DB, col *database.Collection) error {
+	for i := range col.Items {
+		col.Items[i].CollectionID = col.ID
+		col.Items[i].Position = i
+	}
+
+	if len(col.Items) == 0 {
+		return nil
+	}
+
+	return tx.Table(tableCollectionItems).Omit(clause.Associations).Create(&col.Items).Error
+}
+
+func preloadCollectionItems(tx *gorm.DB) *gorm.DB {
+	return tx.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position asc")
+	}).Preload("Items.Crosshair").Preload("Items.Crosshair.Tags")
+}
@@ -1,29 +1,93 @@
 package postgres
 
 import (
+	"time"
+
 	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/sharecode"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// Crosshairs saved before their settings were stored have NULL settings columns, their codes are decoded once to fill them.
+//
+// Codes which do not decode (anymore) are left as they are.
+func (p *psql) migrateCrosshairSettings() error {
+	var crosshairs []*database.Crosshair
+	return p.db.Table(tableCrosshairs).Where("setting_style IS NULL").FindInBatches(&crosshairs, 500, func(tx *gorm.DB, batch int) error {
+		for _, ch := range crosshairs {
+			settings, err := sharecode.Decode(ch.Code)
+			if err != nil {
+				continue
+			}
+			ch.Settings = *settings
+
+			// Saves all columns so zero values of the settings are written as well.
+			if err := p.db.Table(tableCrosshairs).Omit(clause.Associations).Save(ch).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+// Saves the crosshair if its owner has not reached their quota yet, returns database.ErrQuotaExceeded otherwise.
+//
+// The owner is locked while counting and inserting so concurrent requests can not exceed the quota.
 func (p *psql) AddCrosshair(ch *database.Crosshair) (*database.Crosshair, error) {
-	tx := p.db.Table(tableCrosshairs).Save(ch)
-	return ch, tx.Error
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		var user database.UserAccount
+		if err := tx.Table(tableUsers).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", ch.RegistrantID).First(&user).Error; err != nil {
+			return err
+		}
+
+		quota, err := crosshairQuota(tx, &user)
+		if err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Table(tableCrosshairs).Where("registrant_id = ?", ch.RegistrantID).Count(&count).Error; err != nil {
+			return err
+		}
+
+		if quota != database.QuotaUnlimited && count >= int64(quota) {
+			return database.ErrQuotaExceeded
+		}
+
+		if err := tx.Table(tableCrosshairs).Create(ch).Error; err != nil {
+			return err
+		}
+
+		return tx.Table(tableUsers).Where("id = ?", ch.RegistrantID).Update("crosshairs_registered", count+1).Error
+	})
+
+	return ch, err
 }
 
 func (p *psql) GetAllCrosshairsFromUser(user uuid.UUID) ([]*database.Crosshair, error) {
 	var crosshairs []*database.Crosshair
-	tx := p.db.Table(tableCrosshairs).Where("registrant_id = ?", user).Find(&crosshairs)
+	tx := p.db.Table(tableCrosshairs).Preload("Tags").Where("registrant_id = ?", user).Find(&crosshairs)
 	return crosshairs, tx.Error
 }
 
 func (p *psql) DeleteAllCrosshairsFromUser(user uuid.UUID) error {
-	tx := p.db.Table(tableCrosshairs).Where("registrant_id = ?", user).Delete(&database.Crosshair{})
-	return tx.Error
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(tableCrosshairs).Where("registrant_id = ?", user).Delete(&database.Crosshair{}).Error; err != nil {
+			return err
+		}
+		return syncCrosshairCount(tx, user)
+	})
 }
 
 func (p *psql) DeleteCrosshairFromUserByCode(user uuid.UUID, crosshairCode string) error {
-	tx := p.db.Table(tableCrosshairs).Where("registrant_id = ?", user).Where("code = ?", crosshairCode).Delete(&database.Crosshair{})
-	return tx.Error
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(tableCrosshairs).Where("registrant_id = ?", user).Where("code = ?", crosshairCode).Delete(&database.Crosshair{}).Error; err != nil {
+			return err
+		}
+		return syncCrosshairCount(tx, user)
+	})
 }
 
 func (p *psql) EditCrosshairNote(ch *database.Crosshair) (*database.Crosshair, error) {
@@ -31,8 +95,285 @@ func (p *psql) EditCrosshairNote(ch *database.Crosshair) (*database.Crosshair, e
 	return ch, tx.Error
 }
 
+func (p *psql) GetCrosshairFromUserByCode(user uuid.UUID, crosshairCode string) (*database.Crosshair, error) {
+	var crosshair database.Crosshair
+	tx := p.db.Table(tableCrosshairs).Preload("Tags").Where("registrant_id = ?", user).Where("code = ?", crosshairCode).First(&crosshair)
+	return &crosshair, tx.Error
+}
+
+func (p *psql) GetCrosshairBySlug(slug string) (*database.Crosshair, error) {
+	var crosshair database.Crosshair
+	tx := p.db.Table(tableCrosshairs).Preload("Tags").Where("slug = ?", slug).First(&crosshair)
+	return &crosshair, tx.Error
+}
+
+func (p *psql) GetCrosshairByID(id uuid.UUID) (*database.Crosshair, error) {
+	var crosshair database.Crosshair
+	tx := p.db.Table(tableCrosshairs).Preload("Tags").Where("id = ?", id).First(&crosshair)
+	return &crosshair, tx.Error
+}
+
+// Records the copy and increments the save count of the crosshair.
+//
+// Returns false if the user copied the crosshair before, the save count is left as is then.
+func (p *psql) AddCrosshairCopy(copied *database.CrosshairCopy) (bool, error) {
+	var added bool
+
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Table(tableCrosshairCopies).Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(copied)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return nil
+		}
+
+		added = true
+
+		return tx.Table(tableCrosshairs).Where("id = ?", copied.CrosshairID).Update("save_count", gorm.Expr("save_count + 1")).Error
+	})
+
+	return added, err
+}
+
+func (p *psql) UpdateCrosshairVisibility(ch *database.Crosshair) (*database.Crosshair, error) {
+	tx := p.db.Table(tableCrosshairs).Where("id = ?", ch.ID).Update("visibility", ch.Visibility)
+	return ch, tx.Error
+}
+
+func (p *psql) UpdateCrosshairSlug(ch *database.Crosshair) (*database.Crosshair, error) {
+	tx := p.db.Table(tableCrosshairs).Where("id = ?", ch.ID).Update("slug", ch.Slug)
+	return ch, tx.Error
+}
+
+// Sets the preview link on every (pro) crosshair with the code, previews are shared between users.
+func (p *psql) UpdateCrosshairPreviewURL(crosshairCode string, previewURL string) error {
+	tx := p.db.Table(tableCrosshairs).Where("code = ?", crosshairCode).Update("preview_url", previewURL)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	tx = p.db.Table(tableProCHs).Where("code = ?", crosshairCode).Update("preview_url", previewURL)
+	return tx.Error
+}
+
 func (p *psql) GetAllCrosshairsFromUserSortByDate(user uuid.UUID) ([]*database.Crosshair, error) {
 	var crosshairs []*database.Crosshair
-	tx := p.db.Table(tableCrosshairs).Order("created_at desc").Where("id = ?", user).Find(&crosshairs)
+	tx := p.db.Table(tableCrosshairs).Order("created_at desc").Where("registrant_id = ?", user).Find(&crosshairs)
+	return crosshairs, tx.Error
+}
+
+// Replaces the tags of a crosshair, tags which do not exist yet are created.
+func (p *psql) SetCrosshairTags(ch *database.Crosshair, names []string) (*database.Crosshair, error) {
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		return replaceCrosshairTags(tx, ch, names)
+	})
+
+	return ch, err
+}
+
+func replaceCrosshairTags(tx *gorm.DB, ch *database.Crosshair, names []string) error {
+	tags := make([]database.Tag, 0, len(names))
+
+	for _, name := range names {
+		tag := database.Tag{Name: name}
+
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tag).Error; err != nil {
+			return err
+		}
+
+		// Tag already existed, nothing was inserted.
+		if tag.ID == 0 {
+			if err := tx.Where("name = ?", name).First(&tag).Error; err != nil {
+				return err
+			}
+		}
+
+		tags = append(tags, tag)
+	}
+
+	if err := tx.Model(ch).Association("Tags").Replace(tags); err != nil {
+		return err
+	}
+
+	ch.Tags = tags
+
+	return nil
+}
+
+// Stores the current version of the crosshair as a revision, then updates code, note, settings,
+// preview and tags to the ones of ch.
+func (p *psql) UpdateCrosshair(ch *database.Crosshair, tags []string) (*database.Crosshair, error) {
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		var current database.Crosshair
+		if err := tx.Table(tableCrosshairs).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", ch.ID).First(&current).Error; err != nil {
+			return err
+		}
+
+		var currentTags []database.Tag
+		if err := tx.Model(&current).Association("Tags").Find(&currentTags); err != nil {
+			return err
+		}
+
+		var version int
+		if err := tx.Table(tableRevisions).Where("crosshair_id = ?", ch.ID).Select("COALESCE(MAX(version), 0)").Scan(&version).Error; err != nil {
+			return err
+		}
+
+		revision := &database.CrosshairRevision{
+			CrosshairID: current.ID,
+			Version:     version + 1,
+			Code:        current.Code,
+			Note:        current.Note,
+			Settings:    current.Settings,
+			Tags:        []string{},
+		}
+
+		for _, tag := range currentTags {
+			revision.Tags = append(revision.Tags, tag.Name)
+		}
+
+		if err := tx.Table(tableRevisions).Omit(clause.Associations).Create(revision).Error; err != nil {
+			return err
+		}
+
+		current.Code = ch.Code
+		current.Note = ch.Note
+		current.Settings = ch.Settings
+		current.PreviewURL = ch.PreviewURL
+
+		// Saves all columns so zero values of the settings are written as well.
+		if err := tx.Table(tableCrosshairs).Omit(clause.Associations).Save(&current).Error; err != nil {
+			return err
+		}
+
+		return replaceCrosshairTags(tx, ch, tags)
+	})
+
+	return ch, err
+}
+
+func (p *psql) GetCrosshairRevisions(crosshairID uuid.UUID) ([]*database.CrosshairRevision, error) {
+	var revisions []*database.CrosshairRevision
+	tx := p.db.Table(tableRevisions).Where("crosshair_id = ?", crosshairID).Order("version desc").Find(&revisions)
+	return revisions, tx.Error
+}
+
+func (p *psql) GetCrosshairRevision(crosshairID uuid.UUID, version int) (*database.CrosshairRevision, error) {
+	var revision database.CrosshairRevision
+	tx := p.db.Table(tableRevisions).Where("crosshair_id = ? AND version = ?", crosshairID, version).First(&revision)
+	return &revision, tx.Error
+}
+
+// Gets the public crosshairs closest to the settings by size, gap and thickness.
+//
+// This is only a rough preselection, callers rank the results with sharecode.Distance.
+func (p *psql) GetSimilarPublicCrosshairs(settings *sharecode.Settings, limit int) ([]*database.Crosshair, error) {
+	var crosshairs []*database.Crosshair
+	tx := p.db.Table(tableCrosshairs).Preload("Tags").
+		Where("visibility = ?", database.VisibilityPublic).
+		Clauses(similarityOrder(settings)).
+		Limit(limit).
+		Find(&crosshairs)
 	return crosshairs, tx.Error
 }
+
+// Orders by the main parts of sharecode.Distance which can be compared in SQL.
+func similarityOrder(settings *sharecode.Settings) clause.OrderBy {
+	return clause.OrderBy{Expression: gorm.Expr("ABS(setting_size - ?) + ABS(setting_gap - ?) + 2 * ABS(setting_thickness - ?)",
+		settings.Size, settings.Gap, settings.Thickness)}
+}
+
+// Position of the last crosshair of a gallery page, sent to clients as an opaque string.
+type galleryCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        uuid.UUID `json:"i"`
+	SaveCount int       `json:"s"`
+}
+
+func encodeGalleryCursor(ch *database.Crosshair) string {
+	return encodeCursor(galleryCursor{ch.CreatedAt, ch.ID, ch.SaveCount})
+}
+
+func decodeGalleryCursor(cursor string) (*galleryCursor, error) {
+	var decoded galleryCursor
+	if err := decodeCursor(cursor, &decoded); err != nil {
+		return nil, err
+	}
+	return &decoded, nil
+}
+
+// Returns a page of public crosshairs and the cursor of the next page (empty on the last page).
+//
+// Uses keyset pagination on the sort columns so pages stay stable while crosshairs are added.
+func (p *psql) GetPublicCrosshairs(query *database.GalleryQuery) ([]*database.Crosshair, string, error) {
+	tx := p.db.Table(tableCrosshairs).Preload("Tags").Where("visibility = ?", database.VisibilityPublic)
+
+	if query.Search != "" {
+		tx = tx.Where("to_tsvector('simple', note) @@ plainto_tsquery('simple', ?)", query.Search)
+	}
+
+	if len(query.Tags) > 0 {
+		withAllTags := p.db.Table("crosshair_tags").
+			Select("crosshair_tags.crosshair_id").
+			Joins("JOIN tags ON tags.id = crosshair_tags.tag_id").
+			Where("tags.name IN ?", query.Tags).
+			Group("crosshair_tags.crosshair_id").
+			Having("COUNT(DISTINCT tags.id) = ?", len(query.Tags))
+
+		tx = tx.Where("id IN (?)", withAllTags)
+	}
+
+	if query.Style != nil {
+		tx = tx.Where("setting_style = ?", *query.Style)
+	}
+
+	if query.Color != nil {
+		tx = tx.Where("setting_color = ?", *query.Color)
+	}
+
+	if query.MinSize != nil {
+		tx = tx.Where("setting_size >= ?", *query.MinSize)
+	}
+
+	if query.MaxSize != nil {
+		tx = tx.Where("setting_size <= ?", *query.MaxSize)
+	}
+
+	var cursor *galleryCursor
+
+	if query.Cursor != "" {
+		var err error
+		cursor, err = decodeGalleryCursor(query.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	switch query.Sort {
+	case database.SortMostSaved:
+		if cursor != nil {
+			tx = tx.Where("(save_count, created_at, id) < (?, ?, ?)", cursor.SaveCount, cursor.CreatedAt, cursor.ID)
+		}
+		tx = tx.Order("save_count desc, created_at desc, id desc")
+	default:
+		if cursor != nil {
+			tx = tx.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+		}
+		tx = tx.Order("created_at desc, id desc")
+	}
+
+	// Fetch one more to know whether there is another page.
+	var crosshairs []*database.Crosshair
+	if err := tx.Limit(query.Limit + 1).Find(&crosshairs).Error; err != nil {
+		return nil, "", err
+	}
+
+	if len(crosshairs) <= query.Limit {
+		return crosshairs, "", nil
+	}
+
+	crosshairs = crosshairs[:query.Limit]
+
+	return crosshairs, encodeGalleryCursor(crosshairs[len(crosshairs)-1]), nil
+}
@@ -1,32 +1,91 @@
 package postgres
 
-import "github.com/devusSs/crosshairs/database"
+import (
+	"encoding/json"
+	"time"
 
-func (p *psql) AddEvent(event *database.Event) (*database.Event, error) {
-	tx := p.db.Table(tableEvents).Create(&event)
-	return event, tx.Error
-}
+	"github.com/devusSs/crosshairs/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
 
-func (p *psql) GetEvents() ([]*database.Event, error) {
-	var events []*database.Event
-	tx := p.db.Table(tableEvents).Order("created_at desc").Find(&events)
-	return events, tx.Error
+type eventCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        uuid.UUID `json:"i"`
 }
 
-func (p *psql) GetEventsByType(eventType string) ([]*database.Event, error) {
-	var events []*database.Event
-	tx := p.db.Table(tableEvents).Order("created_at desc").Where("type = ?", eventType).Find(&events)
-	return events, tx.Error
-}
+// Stores the event and queues its webhook deliveries in one transaction, deliveries are not lost on restarts.
+func (p *psql) AddEvent(event *database.Event) (*database.Event, error) {
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(tableEvents).Create(&event).Error; err != nil {
+			return err
+		}
 
-func (p *psql) GetEventsWithLimit(limit int) ([]*database.Event, error) {
-	var events []*database.Event
-	tx := p.db.Table(tableEvents).Order("created_at desc").Limit(limit).Find(&events)
-	return events, tx.Error
+		subscribed, err := json.Marshal([]database.EventType{event.Type})
+		if err != nil {
+			return err
+		}
+
+		var webhooks []*database.Webhook
+		if err := tx.Table(tableWebhooks).Where("enabled AND event_types @> ?::jsonb", string(subscribed)).Find(&webhooks).Error; err != nil {
+			return err
+		}
+
+		for _, webhook := range webhooks {
+			if err := tx.Table(tableDeliveries).Create(database.NewWebhookDelivery(webhook.ID, event)).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	return event, err
 }
 
-func (p *psql) GetEventsByTypeWithLimit(eventType string, limit int) ([]*database.Event, error) {
+// Returns a page of events (newest first) and the cursor of the next page (empty on the last page).
+func (p *psql) GetEvents(query *database.EventQuery) ([]*database.Event, string, error) {
+	tx := p.db.Table(tableEvents)
+
+	if query.Type != "" {
+		tx = tx.Where("type = ?", query.Type)
+	}
+
+	if query.UserID != nil {
+		tx = tx.Where("user_id = ?", *query.UserID)
+	}
+
+	if query.Severity != "" {
+		tx = tx.Where("severity = ?", query.Severity)
+	}
+
+	if query.From != nil {
+		tx = tx.Where("created_at >= ?", *query.From)
+	}
+
+	if query.To != nil {
+		tx = tx.Where("created_at < ?", *query.To)
+	}
+
+	if query.Cursor != "" {
+		var cursor eventCursor
+		if err := decodeCursor(query.Cursor, &cursor); err != nil {
+			return nil, "", err
+		}
+		tx = tx.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+
+	// Fetch one more to know whether there is another page.
 	var events []*database.Event
-	tx := p.db.Table(tableEvents).Order("created_at desc").Limit(limit).Where("type = ?", eventType).Find(&events)
-	return events, tx.Error
+	if err := tx.Order("created_at desc, id desc").Limit(query.Limit + 1).Find(&events).Error; err != nil {
+		return nil, "", err
+	}
+
+	if len(events) <= query.Limit {
+		return events, "", nil
+	}
+
+	events = events[:query.Limit]
+	last := events[len(events)-1]
+
+	return events, encodeCursor(eventCursor{last.CreatedAt, last.ID}), nil
 }
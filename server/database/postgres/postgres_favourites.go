@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"github.com/devusSs/crosshairs/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Adds the favourite and increments the save count of the crosshair.
+//
+// Returns false if the user already had the crosshair as favourite.
+func (p *psql) AddFavourite(fav *database.Favourite) (bool, error) {
+	var added bool
+
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Table(tableFavourites).Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(fav)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return nil
+		}
+
+		added = true
+
+		return tx.Table(tableCrosshairs).Where("id = ?", fav.CrosshairID).Update("save_count", gorm.Expr("save_count + 1")).Error
+	})
+
+	return added, err
+}
+
+// Removes the favourite and decrements the save count of the crosshair.
+//
+// Returns false if the user did not have the crosshair as favourite.
+func (p *psql) DeleteFavourite(fav *database.Favourite) (bool, error) {
+	var deleted bool
+
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Table(tableFavourites).Where("user_id = ? AND crosshair_id = ?", fav.UserID, fav.CrosshairID).Delete(&database.Favourite{})
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return nil
+		}
+
+		deleted = true
+
+		return tx.Table(tableCrosshairs).Where("id = ? AND save_count > 0", fav.CrosshairID).Update("save_count", gorm.Expr("save_count - 1")).Error
+	})
+
+	return deleted, err
+}
+
+// Gets the favourites of a user, newest first. Crosshairs made private by their owner are left out.
+func (p *psql) GetFavouriteCrosshairs(user uuid.UUID) ([]*database.Crosshair, error) {
+	var crosshairs []*database.Crosshair
+	tx := p.db.Table(tableCrosshairs).Preload("Tags").
+		Select("crosshairs.*").
+		Joins("JOIN favourites ON favourites.crosshair_id = crosshairs.id").
+		Where("favourites.user_id = ?", user).
+		Where("crosshairs.visibility <> ?", database.VisibilityPrivate).
+		Order("favourites.created_at desc").
+		Find(&crosshairs)
+	return crosshairs, tx.Error
+}
@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"github.com/devusSs/crosshairs/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func (p *psql) AddPasskey(passkey *database.Passkey) (*database.Passkey, error) {
+	tx := p.db.Table(tablePasskeys).Create(passkey)
+	return passkey, tx.Error
+}
+
+// Gets the passkeys of a user, oldest first.
+func (p *psql) GetPasskeysFromUser(user uuid.UUID) ([]*database.Passkey, error) {
+	var passkeys []*database.Passkey
+	tx := p.db.Table(tablePasskeys).Where("user_id = ?", user).Order("created_at asc").Find(&passkeys)
+	return passkeys, tx.Error
+}
+
+func (p *psql) GetPasskeyFromUser(user uuid.UUID, id uuid.UUID) (*database.Passkey, error) {
+	var passkey database.Passkey
+	tx := p.db.Table(tablePasskeys).Where("user_id = ? AND id = ?", user, id).First(&passkey)
+	return &passkey, tx.Error
+}
+
+func (p *psql) GetPasskeyByCredentialID(credentialID []byte) (*database.Passkey, error) {
+	var passkey database.Passkey
+	tx := p.db.Table(tablePasskeys).Where("credential_id = ?", credentialID).First(&passkey)
+	return &passkey, tx.Error
+}
+
+func (p *psql) RenamePasskey(passkey *database.Passkey) (*database.Passkey, error) {
+	tx := p.db.Table(tablePasskeys).Where("id = ?", passkey.ID).Update("name", passkey.Name)
+	return passkey, tx.Error
+}
+
+func (p *psql) UpdatePasskeyUsage(passkey *database.Passkey) error {
+	return p.db.Table(tablePasskeys).Where("id = ?", passkey.ID).Updates(map[string]interface{}{
+		"sign_count":      passkey.SignCount,
+		"clone_warning":   passkey.CloneWarning,
+		"backup_eligible": passkey.BackupEligible,
+		"backup_state":    passkey.BackupState,
+		"last_used_at":    passkey.LastUsedAt,
+	}).Error
+}
+
+func (p *psql) DeletePasskeyFromUser(user uuid.UUID, id uuid.UUID) error {
+	tx := p.db.Table(tablePasskeys).Where("user_id = ? AND id = ?", user, id).Delete(&database.Passkey{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
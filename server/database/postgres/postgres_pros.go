@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/sharecode"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func (p *psql) AddProPlayer(player *database.ProPlayer) (*database.ProPlayer, error) {
+	tx := p.db.Table(tableProPlayers).Create(player)
+	return player, tx.Error
+}
+
+func (p *psql) GetProPlayers() ([]*database.ProPlayer, error) {
+	var players []*database.ProPlayer
+	tx := p.db.Table(tableProPlayers).Preload("Crosshairs").Order("name asc").Find(&players)
+	return players, tx.Error
+}
+
+func (p *psql) GetProPlayerByID(id uuid.UUID) (*database.ProPlayer, error) {
+	var player database.ProPlayer
+	tx := p.db.Table(tableProPlayers).Preload("Crosshairs").Where("id = ?", id).First(&player)
+	return &player, tx.Error
+}
+
+func (p *psql) GetProPlayerByName(name string) (*database.ProPlayer, error) {
+	var player database.ProPlayer
+	tx := p.db.Table(tableProPlayers).Preload("Crosshairs").Where("LOWER(name) = LOWER(?)", name).First(&player)
+	return &player, tx.Error
+}
+
+// Updates the player details and replaces all of their crosshairs.
+func (p *psql) UpdateProPlayer(player *database.ProPlayer) (*database.ProPlayer, error) {
+	player.UpdatedAt = time.Now()
+
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(tableProPlayers).Where("id = ?", player.ID).Updates(map[string]interface{}{
+			"name":          player.Name,
+			"team":          player.Team,
+			"source":        player.Source,
+			"last_verified": player.LastVerified,
+			"updated_at":    player.UpdatedAt,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Table(tableProCHs).Where("pro_player_id = ?", player.ID).Delete(&database.ProCrosshair{}).Error; err != nil {
+			return err
+		}
+
+		for i := range player.Crosshairs {
+			player.Crosshairs[i].ID = uuid.Nil
+			player.Crosshairs[i].ProPlayerID = player.ID
+		}
+
+		if len(player.Crosshairs) == 0 {
+			return nil
+		}
+
+		return tx.Table(tableProCHs).Create(&player.Crosshairs).Error
+	})
+
+	return player, err
+}
+
+func (p *psql) DeleteProPlayer(id uuid.UUID) error {
+	tx := p.db.Table(tableProPlayers).Where("id = ?", id).Delete(&database.ProPlayer{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (p *psql) GetProPlayersByIDs(ids []uuid.UUID) ([]*database.ProPlayer, error) {
+	var players []*database.ProPlayer
+	tx := p.db.Table(tableProPlayers).Where("id IN ?", ids).Find(&players)
+	return players, tx.Error
+}
+
+func (p *psql) GetSimilarProCrosshairs(settings *sharecode.Settings, limit int) ([]*database.ProCrosshair, error) {
+	var crosshairs []*database.ProCrosshair
+	tx := p.db.Table(tableProCHs).Clauses(similarityOrder(settings)).Limit(limit).Find(&crosshairs)
+	return crosshairs, tx.Error
+}
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/devusSs/crosshairs/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Quotas created on migration, existing quotas are not changed.
+var defaultRoleQuotas = []database.RoleQuota{
+	{Role: "user", MaxCrosshairs: database.DefaultCrosshairQuota},
+	{Role: "admin", MaxCrosshairs: database.QuotaUnlimited},
+}
+
+func (p *psql) migrateRoleQuotas() error {
+	if err := p.db.AutoMigrate(&database.RoleQuota{}); err != nil {
+		return err
+	}
+
+	quotas := append([]database.RoleQuota(nil), defaultRoleQuotas...)
+	return p.db.Table(tableRoleQuotas).Clauses(clause.OnConflict{DoNothing: true}).Create(&quotas).Error
+}
+
+func (p *psql) GetRoleQuotas() ([]*database.RoleQuota, error) {
+	var quotas []*database.RoleQuota
+	tx := p.db.Table(tableRoleQuotas).Order("role asc").Find(&quotas)
+	return quotas, tx.Error
+}
+
+// Creates or updates the quota of a role.
+func (p *psql) SetRoleQuota(quota *database.RoleQuota) (*database.RoleQuota, error) {
+	quota.UpdatedAt = time.Now()
+	tx := p.db.Table(tableRoleQuotas).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "role"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_crosshairs", "updated_at"}),
+	}).Create(quota)
+	return quota, tx.Error
+}
+
+// Sets or (with nil) removes the quota override of a user.
+func (p *psql) SetUserCrosshairQuota(user uuid.UUID, quota *int) error {
+	tx := p.db.Table(tableUsers).Where("id = ?", user).Update("crosshair_quota", quota)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Returns the amount of crosshairs the user may save, the override of the user takes precedence over their role.
+func (p *psql) GetCrosshairQuota(user *database.UserAccount) (int, error) {
+	return crosshairQuota(p.db, user)
+}
+
+func crosshairQuota(tx *gorm.DB, user *database.UserAccount) (int, error) {
+	if user.CrosshairQuota != nil {
+		return *user.CrosshairQuota, nil
+	}
+
+	var quota database.RoleQuota
+	err := tx.Table(tableRoleQuotas).Where("role = ?", user.Role).First(&quota).Error
+	if err != nil {
+		if database.IsNotFoundError(err) {
+			return database.DefaultCrosshairQuota, nil
+		}
+		return 0, err
+	}
+
+	return quota.MaxCrosshairs, nil
+}
+
+// Sets the crosshair count of a user to the amount of crosshairs actually stored.
+func syncCrosshairCount(tx *gorm.DB, user uuid.UUID) error {
+	count := tx.Table(tableCrosshairs).Select("COUNT(*)").Where("registrant_id = ?", user)
+	return tx.Table(tableUsers).Where("id = ?", user).Update("crosshairs_registered", count).Error
+}
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/devusSs/crosshairs/database"
+	"github.com/google/uuid"
+)
+
+// Rows are anonymised in batches so large tables are neither loaded nor locked at once.
+const anonymiseBatchSize = 500
+
+// A column holding IPs and the column holding the time they were stored at.
+type ipColumn struct {
+	table    string
+	column   string
+	storedAt string
+}
+
+var (
+	userRegisterIPs = ipColumn{tableUsers, "register_ip", "created_at"}
+	userLoginIPs    = ipColumn{tableUsers, "login_ip", "last_login"}
+	crosshairIPs    = ipColumn{tableCrosshairs, "register_ip", "created_at"}
+	eventIssuerIPs  = ipColumn{tableEvents, "issuer_ip", "created_at"}
+)
+
+// Anonymises the IPs of users, crosshairs and events stored before the time.
+//
+// Only IPs changed by anonymise are counted, it should return anonymised IPs unchanged.
+func (p *psql) AnonymiseIPs(before time.Time, anonymise func(string) string) (*database.AnonymisedIPs, error) {
+	var result database.AnonymisedIPs
+
+	for _, column := range []ipColumn{userRegisterIPs, userLoginIPs} {
+		updated, err := p.anonymiseColumn(column, before, anonymise)
+		if err != nil {
+			return nil, err
+		}
+		result.Users += updated
+	}
+
+	var err error
+
+	result.Crosshairs, err = p.anonymiseColumn(crosshairIPs, before, anonymise)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Events, err = p.anonymiseColumn(eventIssuerIPs, before, anonymise)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (p *psql) anonymiseColumn(column ipColumn, before time.Time, anonymise func(string) string) (int64, error) {
+	type storedIP struct {
+		ID uuid.UUID
+		IP string
+	}
+
+	var updated int64
+
+	// Keyset pagination, updated rows do not move the next batch.
+	last := uuid.Nil
+
+	for {
+		var rows []storedIP
+		tx := p.db.Table(column.table).
+			Select("id, "+column.column+" AS ip").
+			Where(column.storedAt+" < ? AND "+column.column+" <> '' AND id > ?", before, last).
+			Order("id").
+			Limit(anonymiseBatchSize).
+			Find(&rows)
+		if tx.Error != nil {
+			return updated, tx.Error
+		}
+
+		for _, row := range rows {
+			anonymised := anonymise(row.IP)
+			if anonymised == row.IP {
+				continue
+			}
+
+			if err := p.db.Table(column.table).Where("id = ?", row.ID).Update(column.column, anonymised).Error; err != nil {
+				return updated, err
+			}
+			updated++
+		}
+
+		if len(rows) < anonymiseBatchSize {
+			return updated, nil
+		}
+
+		last = rows[len(rows)-1].ID
+	}
+}
+
+func (p *psql) DeleteTwitchBotLogsBefore(before time.Time) (int64, error) {
+	tx := p.db.Table("twitch_bot_logs").Where("created_at < ?", before).Delete(&database.TwitchBotLog{})
+	return tx.RowsAffected, tx.Error
+}
+
+// Deliveries of the events are kept, they hold their own copy of the event.
+func (p *psql) DeleteEventsBefore(before time.Time) (int64, error) {
+	tx := p.db.Table(tableEvents).Where("created_at < ?", before).Delete(&database.Event{})
+	return tx.RowsAffected, tx.Error
+}
@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/devusSs/crosshairs/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Creates the known permissions and built-in roles, the admin role is granted every permission.
+func (p *psql) migrateRoles() error {
+	if err := p.db.AutoMigrate(&database.Permission{}); err != nil {
+		return err
+	}
+	if err := p.db.AutoMigrate(&database.Role{}); err != nil {
+		return err
+	}
+
+	perms := append([]database.Permission(nil), database.Permissions...)
+	if err := p.db.Table(tablePermissions).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"description"}),
+	}).Create(&perms).Error; err != nil {
+		return err
+	}
+
+	roles := []database.Role{
+		{Name: database.RoleUser, Description: "Default role of registered users"},
+		{Name: database.RoleAdmin, Description: "Has every permission"},
+	}
+	if err := p.db.Table(tableRoles).Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(&roles).Error; err != nil {
+		return err
+	}
+
+	// Roles used to be plain strings on the user, keep the ones already in use.
+	if err := p.db.Exec("INSERT INTO roles (name, created_at, updated_at) SELECT DISTINCT role, NOW(), NOW() FROM user_accounts ON CONFLICT DO NOTHING").Error; err != nil {
+		return err
+	}
+
+	return p.db.Exec("INSERT INTO role_permissions (role_name, permission_name) SELECT ?, name FROM permissions ON CONFLICT DO NOTHING", database.RoleAdmin).Error
+}
+
+func (p *psql) GetRoles() ([]*database.Role, error) {
+	var roles []*database.Role
+	tx := p.db.Table(tableRoles).Preload("Permissions").Order("name asc").Find(&roles)
+	return roles, tx.Error
+}
+
+func (p *psql) GetRole(name string) (*database.Role, error) {
+	var role database.Role
+	tx := p.db.Table(tableRoles).Preload("Permissions").Where("name = ?", name).First(&role)
+	return &role, tx.Error
+}
+
+// Creates or updates the role and replaces all of its permissions.
+func (p *psql) SaveRole(role *database.Role) (*database.Role, error) {
+	now := time.Now()
+	role.CreatedAt = now
+	role.UpdatedAt = now
+
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(tableRoles).Omit(clause.Associations).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"description", "updated_at"}),
+		}).Create(role).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Table(tableRolePerms).Where("role_name = ?", role.Name).Delete(nil).Error; err != nil {
+			return err
+		}
+
+		if len(role.Permissions) == 0 {
+			return nil
+		}
+
+		var rows []map[string]interface{}
+		for _, perm := range role.Permissions {
+			rows = append(rows, map[string]interface{}{"role_name": role.Name, "permission_name": perm.Name})
+		}
+
+		return tx.Table(tableRolePerms).Create(rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return p.GetRole(role.Name)
+}
+
+func (p *psql) DeleteRole(name string) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(tableRolePerms).Where("role_name = ?", name).Delete(nil).Error; err != nil {
+			return err
+		}
+
+		res := tx.Table(tableRoles).Where("name = ?", name).Delete(&database.Role{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func (p *psql) SetRoleTwoFactorRequired(role string, required bool) error {
+	tx := p.db.Table(tableRoles).Where("name = ?", role).Updates(map[string]interface{}{
+		"require_two_factor": required,
+		"updated_at":         time.Now(),
+	})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (p *psql) UpdateUserRole(user uuid.UUID, role string) error {
+	tx := p.db.Table(tableUsers).Where("id = ?", user).Update("role", role)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (p *psql) CountUsersWithRole(role string) (int64, error) {
+	var count int64
+	tx := p.db.Table(tableUsers).Where("role = ?", role).Count(&count)
+	return count, tx.Error
+}
@@ -1,6 +1,9 @@
 package postgres
 
-import "github.com/devusSs/crosshairs/database"
+import (
+	"github.com/devusSs/crosshairs/database"
+	"gorm.io/gorm"
+)
 
 func (p *psql) WriteTwitchBotLog(botLog *database.TwitchBotLog) error {
 	tx := p.db.Table("twitch_bot_logs").Create(&botLog)
@@ -45,3 +48,14 @@ func (p *psql) DeleteAllTwitchTokenRefreshStore(loginName *database.TwitchRefres
 	tx := p.db.Table("twitch_refresh_token_stores").Where("twitch_login = ?", loginName.TwitchLogin).Delete(&database.TwitchRefreshTokenStore{})
 	return tx.Error
 }
+
+func (p *psql) GetTwitchBotLogsByTwitchLogin(login string) ([]*database.TwitchBotLog, error) {
+	var logs []*database.TwitchBotLog
+	tx := twitchBotLogsOf(p.db, login).Order("created_at").Find(&logs)
+	return logs, tx.Error
+}
+
+// Messages are JSON objects, the channel is the streamer and the user the one sending the command.
+func twitchBotLogsOf(db *gorm.DB, login string) *gorm.DB {
+	return db.Table("twitch_bot_logs").Where("message::jsonb ->> 'channel' = ? OR message::jsonb ->> 'user' = ?", login, login)
+}
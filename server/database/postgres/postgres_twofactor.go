@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/devusSs/crosshairs/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Enrolling again replaces a secret which has not been confirmed yet.
+func (p *psql) SetTOTPSecret(user uuid.UUID, secret string) error {
+	return updateUserByID(p.db, user, map[string]interface{}{
+		"totp_secret":        secret,
+		"two_factor_enabled": false,
+	})
+}
+
+func (p *psql) EnableTwoFactor(user uuid.UUID, step int64, codeHashes []string) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := updateUserByID(tx, user, map[string]interface{}{
+			"two_factor_enabled": true,
+			"totp_last_step":     step,
+		}); err != nil {
+			return err
+		}
+
+		return replaceRecoveryCodes(tx, user, codeHashes)
+	})
+}
+
+// Removes the secret and every recovery code of the user.
+func (p *psql) DisableTwoFactor(user uuid.UUID) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := updateUserByID(tx, user, map[string]interface{}{
+			"totp_secret":             "",
+			"two_factor_enabled":      false,
+			"totp_last_step":          0,
+			"two_factor_failures":     0,
+			"two_factor_locked_until": nil,
+		}); err != nil {
+			return err
+		}
+
+		return tx.Table(tableRecoveryCodes).Where("user_id = ?", user).Delete(&database.RecoveryCode{}).Error
+	})
+}
+
+// The step is only stored if it is newer, concurrent logins with the same code can not both succeed.
+func (p *psql) UseTOTPStep(user uuid.UUID, step int64) (bool, error) {
+	tx := p.db.Table(tableUsers).Where("id = ? AND totp_last_step < ?", user, step).Update("totp_last_step", step)
+	return tx.RowsAffected > 0, tx.Error
+}
+
+func (p *psql) AddTwoFactorFailure(user uuid.UUID) (int, error) {
+	var failures int
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		// The update locks the row, concurrent wrong codes are counted one after another.
+		if err := updateUserByID(tx, user, map[string]interface{}{
+			"two_factor_failures": gorm.Expr("two_factor_failures + 1"),
+		}); err != nil {
+			return err
+		}
+
+		return tx.Table(tableUsers).Where("id = ?", user).Select("two_factor_failures").Scan(&failures).Error
+	})
+	return failures, err
+}
+
+func (p *psql) LockTwoFactor(user uuid.UUID, until time.Time) error {
+	return updateUserByID(p.db, user, map[string]interface{}{
+		"two_factor_locked_until": until,
+	})
+}
+
+func (p *psql) ResetTwoFactorFailures(user uuid.UUID) error {
+	return updateUserByID(p.db, user, map[string]interface{}{
+		"two_factor_failures":     0,
+		"two_factor_locked_until": nil,
+	})
+}
+
+func (p *psql) UseRecoveryCode(user uuid.UUID, codeHash string) (bool, error) {
+	tx := p.db.Table(tableRecoveryCodes).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user, codeHash).
+		Update("used_at", time.Now())
+	return tx.RowsAffected > 0, tx.Error
+}
+
+func (p *psql) ReplaceRecoveryCodes(user uuid.UUID, codeHashes []string) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, user, codeHashes)
+	})
+}
+
+func (p *psql) CountUnusedRecoveryCodes(user uuid.UUID) (int64, error) {
+	var count int64
+	tx := p.db.Table(tableRecoveryCodes).Where("user_id = ? AND used_at IS NULL", user).Count(&count)
+	return count, tx.Error
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, user uuid.UUID, codeHashes []string) error {
+	if err := tx.Table(tableRecoveryCodes).Where("user_id = ?", user).Delete(&database.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+
+	if len(codeHashes) == 0 {
+		return nil
+	}
+
+	codes := make([]database.RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, database.RecoveryCode{UserID: user, CodeHash: hash})
+	}
+
+	return tx.Table(tableRecoveryCodes).Create(&codes).Error
+}
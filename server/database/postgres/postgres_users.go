@@ -1,6 +1,10 @@
 package postgres
 
-import "github.com/devusSs/crosshairs/database"
+import (
+	"github.com/devusSs/crosshairs/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
 
 func (p *psql) AddUser(user *database.UserAccount) (*database.UserAccount, error) {
 	tx := p.db.Table(tableUsers).Create(user)
@@ -32,11 +36,6 @@ func (p *psql) GetUserByUID(user *database.UserAccount) (*database.UserAccount,
 	return user, tx.Error
 }
 
-func (p *psql) UpdateUserCrosshairCount(user *database.UserAccount) (*database.UserAccount, error) {
-	tx := p.db.Table(tableUsers).Where("id = ?", user.ID).Update("crosshairs_registered", user.CrosshairsRegistered+1)
-	return user, tx.Error
-}
-
 func (p *psql) AddResetPasswordCodeAndTime(user *database.UserAccount) (*database.UserAccount, error) {
 	tx := p.db.Table(tableUsers).Where("e_mail = ?", user.EMail).Update("password_reset_code", user.PasswordResetCode)
 	if tx.Error != nil {
@@ -52,12 +51,12 @@ func (p *psql) GetUserByResetpasswordCode(user *database.UserAccount) (*database
 }
 
 func (p *psql) UpdateUserPassword(user *database.UserAccount) (*database.UserAccount, error) {
-	tx := p.db.Table(tableUsers).Where("e_mail = ?", user.EMail).Where("password_reset_code = ?", user.PasswordResetCode).Update("password", user.Password)
+	tx := p.db.Table(tableUsers).Where("e_mail = ?", user.EMail).Where("password_reset_code = ?", user.PasswordResetCode).Updates(map[string]interface{}{"password": user.Password, "password_reset_required": false, "password_unknown": false})
 	return user, tx.Error
 }
 
 func (p *psql) UpdateUserPasswordRaw(user *database.UserAccount) (*database.UserAccount, error) {
-	tx := p.db.Table(tableUsers).Where("e_mail = ?", user.EMail).Update("password", user.Password)
+	tx := p.db.Table(tableUsers).Where("e_mail = ?", user.EMail).Updates(map[string]interface{}{"password": user.Password, "password_reset_required": false, "password_unknown": false})
 	return user, tx.Error
 }
 
@@ -71,6 +70,17 @@ func (p *psql) UpdateUserAvatarURL(user *database.UserAccount) (*database.UserAc
 	return user, tx.Error
 }
 
+func (p *psql) GetUsersByUIDs(ids []uuid.UUID) ([]*database.UserAccount, error) {
+	var users []*database.UserAccount
+	tx := p.db.Table(tableUsers).Where("id IN ?", ids).Find(&users)
+	return users, tx.Error
+}
+
+func (p *psql) UpdateUserDisplayName(user *database.UserAccount) (*database.UserAccount, error) {
+	tx := p.db.Table(tableUsers).Where("id = ?", user.ID).Update("display_name", user.DisplayName)
+	return user, tx.Error
+}
+
 func (p *psql) AddUserTwitchDetails(user *database.UserAccount) (*database.UserAccount, error) {
 	tx := p.db.Table(tableUsers).Where("id = ?", user.ID).Update("twitch_id", user.TwitchID).Update("twitch_login", user.TwitchLogin).Update("twitch_created_at", user.TwitchCreatedAt)
 	return user, tx.Error
@@ -80,3 +90,26 @@ func (p *psql) GetUserByTwitchLogin(user *database.UserAccount) (*database.UserA
 	tx := p.db.Table(tableUsers).Where("twitch_login = ?", user.TwitchLogin).First(&user)
 	return user, tx.Error
 }
+
+func (p *psql) GetUserByTwitchID(user *database.UserAccount) (*database.UserAccount, error) {
+	tx := p.db.Table(tableUsers).Where("twitch_id = ?", user.TwitchID).First(&user)
+	return user, tx.Error
+}
+
+// Only updates the user if the e-mail is still unverified.
+func (p *psql) ClaimUnverifiedUser(user uuid.UUID, passwordHash string) error {
+	tx := p.db.Table(tableUsers).Where("id = ? AND verified_mail = ?", user, false).Updates(map[string]interface{}{
+		"verified_mail":           true,
+		"password":                passwordHash,
+		"password_unknown":        true,
+		"password_reset_code":     "",
+		"password_reset_required": false,
+	})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/devusSs/crosshairs/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type deliveryCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        uuid.UUID `json:"i"`
+}
+
+func (p *psql) AddWebhook(webhook *database.Webhook) (*database.Webhook, error) {
+	tx := p.db.Table(tableWebhooks).Create(webhook)
+	return webhook, tx.Error
+}
+
+func (p *psql) GetWebhooks() ([]*database.Webhook, error) {
+	var webhooks []*database.Webhook
+	tx := p.db.Table(tableWebhooks).Order("created_at").Find(&webhooks)
+	return webhooks, tx.Error
+}
+
+func (p *psql) GetWebhookByID(id uuid.UUID) (*database.Webhook, error) {
+	var webhook database.Webhook
+	tx := p.db.Table(tableWebhooks).Where("id = ?", id).First(&webhook)
+	return &webhook, tx.Error
+}
+
+func (p *psql) UpdateWebhook(webhook *database.Webhook) (*database.Webhook, error) {
+	tx := p.db.Table(tableWebhooks).Save(webhook)
+	return webhook, tx.Error
+}
+
+// Deletes the webhook and its deliveries, pending ones are not sent anymore.
+func (p *psql) DeleteWebhook(id uuid.UUID) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(tableDeliveries).Where("webhook_id = ?", id).Delete(&database.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+
+		res := tx.Table(tableWebhooks).Where("id = ?", id).Delete(&database.Webhook{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func (p *psql) AddWebhookDelivery(delivery *database.WebhookDelivery) (*database.WebhookDelivery, error) {
+	tx := p.db.Table(tableDeliveries).Create(delivery)
+	return delivery, tx.Error
+}
+
+// Claimed deliveries are locked while claiming so workers of several instances never claim the same one.
+//
+// A worker which dies while delivering loses its claim once the lease is over, the delivery is retried then.
+func (p *psql) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]*database.WebhookDelivery, error) {
+	var deliveries []*database.WebhookDelivery
+
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		if err := tx.Table(tableDeliveries).
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", database.DeliveryPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&deliveries).Error; err != nil {
+			return err
+		}
+
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			ids = append(ids, delivery.ID)
+		}
+
+		return tx.Table(tableDeliveries).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+
+	return deliveries, err
+}
+
+func (p *psql) UpdateWebhookDelivery(delivery *database.WebhookDelivery) error {
+	return p.db.Table(tableDeliveries).Save(delivery).Error
+}
+
+// Returns a page of deliveries (newest first) and the cursor of the next page (empty on the last page).
+func (p *psql) GetWebhookDeliveries(query *database.WebhookDeliveryQuery) ([]*database.WebhookDelivery, string, error) {
+	tx := p.db.Table(tableDeliveries).Where("webhook_id = ?", query.WebhookID)
+
+	if query.Status != "" {
+		tx = tx.Where("status = ?", query.Status)
+	}
+
+	if query.Cursor != "" {
+		var cursor deliveryCursor
+		if err := decodeCursor(query.Cursor, &cursor); err != nil {
+			return nil, "", err
+		}
+		tx = tx.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+
+	// Fetch one more to know whether there is another page.
+	var deliveries []*database.WebhookDelivery
+	if err := tx.Order("created_at desc, id desc").Limit(query.Limit + 1).Find(&deliveries).Error; err != nil {
+		return nil, "", err
+	}
+
+	if len(deliveries) <= query.Limit {
+		return deliveries, "", nil
+	}
+
+	deliveries = deliveries[:query.Limit]
+	last := deliveries[len(deliveries)-1]
+
+	return deliveries, encodeCursor(deliveryCursor{last.CreatedAt, last.ID}), nil
+}
@@ -0,0 +1,120 @@
+package demo
+
+import "errors"
+
+var errOutOfData = errors.New("unexpected end of data")
+
+// bitReader reads Source engine bit buffers, bits are stored least significant bit first.
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func newBitReader(data []byte) *bitReader {
+	return &bitReader{data: data}
+}
+
+func (r *bitReader) readBit() bool {
+	if r.pos >= len(r.data)*8 {
+		r.err = errOutOfData
+		return false
+	}
+
+	bit := r.data[r.pos>>3]>>(r.pos&7)&1 == 1
+	r.pos++
+
+	return bit
+}
+
+// Reads an unsigned integer of up to 32 bits.
+func (r *bitReader) readInt(bits int) uint32 {
+	if r.pos+bits > len(r.data)*8 {
+		r.pos = len(r.data) * 8
+		r.err = errOutOfData
+		return 0
+	}
+
+	var value uint32
+	for read := 0; read < bits; {
+		offset := r.pos & 7
+		n := 8 - offset
+		if n > bits-read {
+			n = bits - read
+		}
+
+		value |= uint32(r.data[r.pos>>3]>>offset&(1<<n-1)) << read
+
+		r.pos += n
+		read += n
+	}
+	return value
+}
+
+func (r *bitReader) readByte() byte {
+	return byte(r.readInt(8))
+}
+
+func (r *bitReader) readBytes(n int) []byte {
+	if r.pos+n*8 > len(r.data)*8 {
+		r.err = errOutOfData
+		return nil
+	}
+
+	bytes := make([]byte, n)
+	for i := range bytes {
+		bytes[i] = r.readByte()
+	}
+	return bytes
+}
+
+func (r *bitReader) skip(bits int) {
+	if r.pos+bits > len(r.data)*8 {
+		r.pos = len(r.data) * 8
+		r.err = errOutOfData
+		return
+	}
+	r.pos += bits
+}
+
+// Reads a zero terminated string, stops after 4096 characters to not run away on broken data.
+func (r *bitReader) readString() string {
+	var str []byte
+	for i := 0; i < 4096 && r.err == nil; i++ {
+		b := r.readByte()
+		if b == 0 {
+			break
+		}
+		str = append(str, b)
+	}
+	return string(str)
+}
+
+// Reads a protobuf style varint of up to 64 bits.
+func (r *bitReader) readVarInt() uint64 {
+	var value uint64
+	for shift := 0; shift < 70 && r.err == nil; shift += 7 {
+		b := r.readByte()
+		value |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return value
+}
+
+// Reads the variable length integers used for entity indices.
+func (r *bitReader) readUBitInt() uint32 {
+	value := r.readInt(6)
+
+	switch value & (16 | 32) {
+	case 16:
+		value = value&15 | r.readInt(4)<<4
+	case 32:
+		value = value&15 | r.readInt(8)<<4
+	case 48:
+		value = value&15 | r.readInt(28)<<4
+	}
+
+	return value
+}
@@ -0,0 +1,313 @@
+// Package demo reads CS:GO demo (.dem) files and extracts the crosshair share codes of all players.
+//
+// The game networks every player's crosshair code through the m_szCrosshairCodes array of the
+// player resource entity, indexed by the player's entity index. Player names and Steam IDs come
+// from the userinfo string table, its entries are indexed the same way. Entities are decoded
+// with the send tables of the demo, their values are skipped except for the crosshair codes.
+//
+// CS2 (Source 2) demos use a different format and are rejected with ErrUnsupportedDemo.
+package demo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/devusSs/crosshairs/sharecode"
+)
+
+const (
+	headerMagic     = "HL2DEMO\x00"
+	source2Magic    = "PBDEMS2\x00"
+	headerStringLen = 260
+
+	// Size of the split screen command info in front of packet frames.
+	cmdInfoSize = 152
+
+	// Frames larger than this are considered corrupt.
+	maxChunkSize = 16 << 20
+)
+
+// Frame types of the demo file.
+const (
+	frameSignon = iota + 1
+	framePacket
+	frameSyncTick
+	frameConsoleCmd
+	frameUserCmd
+	frameDataTables
+	frameStop
+	frameCustomData
+	frameStringTables
+)
+
+var (
+	ErrInvalidDemo     = errors.New("file is not a CS:GO demo")
+	ErrUnsupportedDemo = errors.New("CS2 (Source 2) demos are not supported, only CS:GO demos can be read")
+)
+
+// Header holds the information of the demo file header.
+type Header struct {
+	Protocol        int
+	NetworkProtocol int
+	ServerName      string
+	ClientName      string
+	MapName         string
+	GameDirectory   string
+	PlaybackTime    float64 // seconds
+	Ticks           int
+	Frames          int
+}
+
+// Player is a (human or bot) player which joined the server during the demo.
+type Player struct {
+	EntityIndex int
+	UserID      int
+	SteamID64   uint64
+	Name        string
+	IsBot       bool
+	// Last valid crosshair code the player used in the demo, empty if they had none (e.g. bots).
+	CrosshairCode string
+}
+
+// Result of parsing a demo.
+type Result struct {
+	Header  Header
+	Players []*Player
+}
+
+type parser struct {
+	r *bufio.Reader
+
+	stringTables []stringTable
+	players      map[int]*Player
+
+	serverClasses []*serverClass
+	classBits     int
+	entities      map[int]*entity
+	// Reused for every entity update.
+	propIndices []int
+
+	// Crosshair codes networked before the user info of their player, by entity index.
+	pendingCodes map[int]string
+}
+
+// Parse reads a demo from r and returns its header, players and their crosshair codes.
+//
+// The demo is streamed, r is read until the stop frame or EOF.
+func Parse(r io.Reader) (*Result, error) {
+	p := &parser{
+		r:            bufio.NewReaderSize(r, 1<<16),
+		players:      make(map[int]*Player),
+		entities:     make(map[int]*entity),
+		pendingCodes: make(map[int]string),
+	}
+
+	header, err := ReadHeader(p.r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.readFrames(); err != nil {
+		return nil, err
+	}
+
+	return p.result(header), nil
+}
+
+// ReadHeader reads and validates the header at the start of a demo.
+//
+// Useful to reject files which are no (supported) demos before parsing them completely.
+func ReadHeader(r io.Reader) (*Header, error) {
+	raw := make([]byte, len(headerMagic)+8+4*headerStringLen+16)
+
+	if _, err := io.ReadFull(r, raw); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrInvalidDemo
+		}
+		return nil, err
+	}
+
+	switch string(raw[:len(headerMagic)]) {
+	case headerMagic:
+	case source2Magic:
+		return nil, ErrUnsupportedDemo
+	default:
+		return nil, ErrInvalidDemo
+	}
+
+	data := raw[len(headerMagic):]
+
+	header := &Header{
+		Protocol:        int(int32(binary.LittleEndian.Uint32(data[0:4]))),
+		NetworkProtocol: int(int32(binary.LittleEndian.Uint32(data[4:8]))),
+	}
+	data = data[8:]
+
+	for _, field := range []*string{&header.ServerName, &header.ClientName, &header.MapName, &header.GameDirectory} {
+		*field = cString(data[:headerStringLen])
+		data = data[headerStringLen:]
+	}
+
+	header.PlaybackTime = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[0:4])))
+	header.Ticks = int(int32(binary.LittleEndian.Uint32(data[4:8])))
+	header.Frames = int(int32(binary.LittleEndian.Uint32(data[8:12])))
+
+	return header, nil
+}
+
+func (p *parser) readFrames() error {
+	for {
+		cmd, err := p.r.ReadByte()
+		if err != nil {
+			// Demos of aborted matches may miss the stop frame.
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		if cmd == frameStop {
+			return nil
+		}
+
+		// Tick (int32) and player slot (byte).
+		if err := p.skip(5); err != nil {
+			return err
+		}
+
+		switch cmd {
+		case frameSignon, framePacket:
+			if err := p.skip(cmdInfoSize + 8); err != nil {
+				return err
+			}
+
+			chunk, err := p.readChunk()
+			if err != nil {
+				return err
+			}
+
+			if err := p.handlePacket(chunk); err != nil {
+				return fmt.Errorf("%w: %s", ErrInvalidDemo, err.Error())
+			}
+		case frameSyncTick:
+		case frameConsoleCmd:
+			if err := p.skipChunk(); err != nil {
+				return err
+			}
+		case frameDataTables:
+			chunk, err := p.readChunk()
+			if err != nil {
+				return err
+			}
+
+			if err := p.handleDataTablesFrame(chunk); err != nil {
+				return fmt.Errorf("%w: %s", ErrInvalidDemo, err.Error())
+			}
+		case frameUserCmd, frameCustomData:
+			if err := p.skip(4); err != nil {
+				return err
+			}
+			if err := p.skipChunk(); err != nil {
+				return err
+			}
+		case frameStringTables:
+			chunk, err := p.readChunk()
+			if err != nil {
+				return err
+			}
+
+			if err := p.handleStringTablesFrame(chunk); err != nil {
+				return fmt.Errorf("%w: %s", ErrInvalidDemo, err.Error())
+			}
+		default:
+			return fmt.Errorf("%w: unknown frame type %d", ErrInvalidDemo, cmd)
+		}
+	}
+}
+
+func (p *parser) chunkSize() (int, error) {
+	var size int32
+	if err := binary.Read(p.r, binary.LittleEndian, &size); err != nil {
+		return 0, truncated(err)
+	}
+
+	if size < 0 || size > maxChunkSize {
+		return 0, fmt.Errorf("%w: invalid frame size %d", ErrInvalidDemo, size)
+	}
+
+	return int(size), nil
+}
+
+func (p *parser) readChunk() ([]byte, error) {
+	size, err := p.chunkSize()
+	if err != nil {
+		return nil, err
+	}
+
+	chunk := make([]byte, size)
+	if _, err := io.ReadFull(p.r, chunk); err != nil {
+		return nil, truncated(err)
+	}
+
+	return chunk, nil
+}
+
+func (p *parser) skipChunk() error {
+	size, err := p.chunkSize()
+	if err != nil {
+		return err
+	}
+
+	return p.skip(size)
+}
+
+func (p *parser) skip(n int) error {
+	if _, err := p.r.Discard(n); err != nil {
+		return truncated(err)
+	}
+	return nil
+}
+
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: file is truncated", ErrInvalidDemo)
+	}
+	return err
+}
+
+// Sets the crosshair code of the player with the entity index, invalid codes are ignored.
+func (p *parser) setCrosshairCode(entityIndex int, code string) {
+	code = strings.TrimSpace(code)
+	if !sharecode.IsValid(code) {
+		return
+	}
+
+	player, ok := p.players[entityIndex]
+	if !ok {
+		p.pendingCodes[entityIndex] = code
+		return
+	}
+
+	player.CrosshairCode = code
+}
+
+// Builds the result, players are ordered by their entity index.
+func (p *parser) result(header *Header) *Result {
+	result := &Result{Header: *header}
+
+	for _, player := range p.players {
+		result.Players = append(result.Players, player)
+	}
+
+	sort.Slice(result.Players, func(i, j int) bool {
+		return result.Players[i].EntityIndex < result.Players[j].EntityIndex
+	})
+
+	return result
+}
@@ -0,0 +1,553 @@
+package demo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the fixture demo in testdata")
+
+const (
+	fixturePath = "testdata/crosshairs.dem"
+
+	codeFirst  = "CSGO-O4Jsi-V36wY-rTMGK-9w7qF-jQ8WB"
+	codeLatest = "CSGO-6G2cS-WzcxT-fH3dp-Rf7oq-X9oJN"
+	codeOther  = "CSGO-ejaUm-2nJUY-Od9yh-eHhGU-sPZfE"
+)
+
+func TestParseFixture(t *testing.T) {
+	fixture := buildFixture()
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(fixturePath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fixturePath, fixture, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stored, err := os.ReadFile(fixturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, fixture) {
+		t.Fatalf("%s is outdated, run go test ./demo -update", fixturePath)
+	}
+
+	result, err := Parse(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantHeader := Header{
+		Protocol:        4,
+		NetworkProtocol: 13857,
+		ServerName:      "Valve CS:GO EU West Server",
+		ClientName:      "GOTV Demo",
+		MapName:         "de_mirage",
+		GameDirectory:   "csgo",
+		PlaybackTime:    1.5,
+		Ticks:           96,
+		Frames:          4,
+	}
+	if result.Header != wantHeader {
+		t.Errorf("header is %+v, want %+v", result.Header, wantHeader)
+	}
+
+	// The GOTV client in slot 3 is left out, the player in slot 4 joined after their crosshair was networked.
+	wantPlayers := []*Player{
+		{EntityIndex: 1, UserID: 2, SteamID64: 76561197960287930, Name: "first", CrosshairCode: codeLatest},
+		{EntityIndex: 2, UserID: 3, Name: "BOT Albert", IsBot: true},
+		{EntityIndex: 4, UserID: 5, SteamID64: 76561197960287931, Name: "late", CrosshairCode: codeOther},
+	}
+	if !reflect.DeepEqual(result.Players, wantPlayers) {
+		t.Errorf("players differ, got:")
+		for _, player := range result.Players {
+			t.Errorf("  %+v", player)
+		}
+	}
+}
+
+func TestFlattenSendTables(t *testing.T) {
+	p := &parser{}
+	if err := p.handleDataTablesFrame(fixtureDataTables()); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.classBits != 1 {
+		t.Errorf("class bits are %d, want 1", p.classBits)
+	}
+
+	tests := []struct {
+		class int
+		want  []string
+	}{
+		// Props which change often are moved to the front, array elements are no props of their own.
+		{0, []string{"m_flSimulationTime", "m_nModelIndex", "m_iAmmo"}},
+		// Excluded props are left out, props with lower priority come first and data tables keep their prefix.
+		{1, []string{
+			"baseclass.m_iScore", "baseclass.m_iPing",
+			"m_szCrosshairCodes.000", "m_szCrosshairCodes.001", "m_szCrosshairCodes.002",
+			"m_szCrosshairCodes.003", "m_szCrosshairCodes.004",
+		}},
+	}
+
+	for _, tt := range tests {
+		class := p.serverClasses[tt.class]
+
+		var names []string
+		for _, prop := range class.props {
+			names = append(names, prop.name)
+		}
+
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("props of %s are %v, want %v", class.name, names, tt.want)
+		}
+	}
+
+	for i, prop := range p.serverClasses[1].props[2:] {
+		if prop.crosshairOf != i {
+			t.Errorf("%s holds the crosshair of %d, want %d", prop.name, prop.crosshairOf, i)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	fixture := buildFixture()
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrInvalidDemo},
+		{"no demo", bytes.Repeat([]byte("x"), 2048), ErrInvalidDemo},
+		{"cs2 demo", append([]byte(source2Magic), make([]byte, 2048)...), ErrUnsupportedDemo},
+		{"truncated", fixture[:len(fixture)-20], ErrInvalidDemo},
+		{"truncated header", fixture[:100], ErrInvalidDemo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(bytes.NewReader(tt.data)); !errors.Is(err, tt.want) {
+				t.Errorf("Parse returned %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBitReader(t *testing.T) {
+	w := &bitWriter{}
+	w.writeBit(true)
+	w.writeInt(0x2a5, 10)
+	w.writeInt(0xdeadbeef, 32)
+	w.writeVarInt(300)
+	w.writeString("CSGO")
+	w.writeUBitInt(5)
+	w.writeUBitInt(200)
+	w.writeUBitInt(70000)
+
+	r := newBitReader(w.bytes())
+
+	if !r.readBit() || r.readInt(10) != 0x2a5 || r.readInt(32) != 0xdeadbeef || r.readVarInt() != 300 || r.readString() != "CSGO" {
+		t.Error("read values differ from the written ones")
+	}
+	for _, want := range []uint32{5, 200, 70000} {
+		if got := r.readUBitInt(); got != want {
+			t.Errorf("readUBitInt = %d, want %d", got, want)
+		}
+	}
+	if r.err != nil {
+		t.Error(r.err)
+	}
+
+	r.readInt(32)
+	if !errors.Is(r.err, errOutOfData) {
+		t.Errorf("reading past the end returned %v", r.err)
+	}
+}
+
+// Builds a small CS:GO demo with a player resource, two players, a bot and the GOTV client.
+//
+// Crosshairs change during the demo and one player's user info arrives after their crosshair code.
+func buildFixture() []byte {
+	var demo bytes.Buffer
+
+	demo.WriteString(headerMagic)
+	writeInt32(&demo, 4)
+	writeInt32(&demo, 13857)
+	for _, value := range []string{"Valve CS:GO EU West Server", "GOTV Demo", "de_mirage", "csgo"} {
+		field := make([]byte, headerStringLen)
+		copy(field, value)
+		demo.Write(field)
+	}
+	writeInt32(&demo, int32(math.Float32bits(1.5)))
+	writeInt32(&demo, 96)
+	writeInt32(&demo, 4)
+	writeInt32(&demo, 0)
+
+	writeFrame(&demo, frameDataTables, 0, fixtureDataTables())
+
+	// Signon: user info of the first player, the bot and GOTV, then the player resource and the world.
+	userInfo := &bitWriter{}
+	userInfo.writeBit(false)
+	for i, info := range [][]byte{
+		playerInfo("first", 2, 76561197960287930, false, false),
+		playerInfo("BOT Albert", 3, 0, true, false),
+		playerInfo("GOTV", 4, 0, false, true),
+	} {
+		writeStringTableEntry(userInfo, i, info)
+	}
+
+	createStringTable := concat(
+		protoBytes(1, []byte(userInfoTable)),
+		protoVarint(2, 64),
+		protoVarint(3, 3),
+		protoVarint(4, 0),
+		protoVarint(7, 0),
+		protoBytes(8, userInfo.bytes()),
+	)
+
+	entities := &bitWriter{}
+	// The world, entity 0.
+	entities.writeUBitInt(0)
+	writeCreateEntity(entities, 0)
+	writeProps(entities, []int{0, 1, 2}, func() {
+		entities.writeInt(math.Float32bits(12.5), 32)
+		entities.writeInt(1, 12)
+		// Two elements of the ammo array.
+		entities.writeInt(2, 3)
+		entities.writeInt(30, 6)
+		entities.writeInt(90, 6)
+	})
+	// The player resource, entity 5.
+	entities.writeUBitInt(4)
+	writeCreateEntity(entities, 1)
+	writeProps(entities, []int{0, 1, 2, 3, 4, 5, 6}, func() {
+		entities.writeVarInt(12)
+		entities.writeInt(35, 10)
+		writeStringProp(entities, "")
+		writeStringProp(entities, codeFirst)
+		writeStringProp(entities, "CSGO-invalid")
+		writeStringProp(entities, "")
+		writeStringProp(entities, codeOther)
+	})
+
+	packetEntities := concat(
+		protoVarint(1, 2048),
+		protoVarint(2, 2),
+		protoVarint(3, 0),
+		protoBytes(7, entities.bytes()),
+	)
+
+	writeFrame(&demo, frameSignon, 0, nil,
+		netMessage{svcCreateStringTable, createStringTable},
+		netMessage{svcPacketEntities, packetEntities},
+	)
+
+	// Later packet: the first player changes their crosshair, the world leaves and the late player joins.
+	entities = &bitWriter{}
+	entities.writeUBitInt(0)
+	entities.writeBit(true)
+	entities.writeBit(true)
+	entities.writeUBitInt(4)
+	entities.writeBit(false)
+	entities.writeBit(false)
+	writeProps(entities, []int{3}, func() {
+		writeStringProp(entities, codeLatest)
+	})
+
+	packetEntities = concat(
+		protoVarint(1, 2048),
+		protoVarint(2, 2),
+		protoVarint(3, 1),
+		protoBytes(7, entities.bytes()),
+	)
+
+	userInfo = &bitWriter{}
+	userInfo.writeBit(false)
+	// Not the entry after the previous one, the index is written out.
+	userInfo.writeBit(false)
+	userInfo.writeInt(3, 6)
+	userInfo.writeBit(true)
+	userInfo.writeBit(false)
+	userInfo.writeString("76561197960287931")
+	userInfo.writeBit(true)
+	info := playerInfo("late", 5, 76561197960287931, false, false)
+	userInfo.writeInt(uint32(len(info)), 14)
+	userInfo.writeBytes(info)
+
+	updateStringTable := concat(
+		protoVarint(1, 0),
+		protoVarint(2, 1),
+		protoBytes(3, userInfo.bytes()),
+	)
+
+	writeFrame(&demo, framePacket, 64, nil,
+		netMessage{svcPacketEntities, packetEntities},
+		netMessage{svcUpdateStringTable, updateStringTable},
+	)
+
+	demo.WriteByte(frameStop)
+
+	return demo.Bytes()
+}
+
+// Send tables of the world and the player resource, with the props needed to test flattening.
+func fixtureDataTables() []byte {
+	tables := [][]byte{
+		sendTableMessage("DT_World",
+			sendPropMessage(propInt, "m_nModelIndex", 0, 128, "", 0, 12),
+			sendPropMessage(propFloat, "m_flSimulationTime", flagNoScale|flagChangesOften, 128, "", 0, 32),
+			sendPropMessage(propInt, "lengthprop", flagInsideArray, 128, "", 0, 6),
+			sendPropMessage(propArray, "m_iAmmo", 0, 128, "", 4, 0),
+		),
+		sendTableMessage("DT_PlayerResource",
+			sendPropMessage(propInt, "m_iPing", 0, 128, "", 0, 10),
+			sendPropMessage(propInt, "m_iScore", flagVarInt, 1, "", 0, 32),
+			sendPropMessage(propInt, "m_iMVPs", flagExclude, 128, "DT_CSPlayerResource", 0, 0),
+		),
+		sendTableMessage("m_szCrosshairCodes",
+			sendPropMessage(propString, "000", 0, 128, "", 0, 0),
+			sendPropMessage(propString, "001", 0, 128, "", 0, 0),
+			sendPropMessage(propString, "002", 0, 128, "", 0, 0),
+			sendPropMessage(propString, "003", 0, 128, "", 0, 0),
+			sendPropMessage(propString, "004", 0, 128, "", 0, 0),
+		),
+		sendTableMessage("DT_CSPlayerResource",
+			sendPropMessage(propDataTable, "baseclass", 0, 128, "DT_PlayerResource", 0, 0),
+			sendPropMessage(propInt, "m_iMVPs", 0, 128, "", 0, 8),
+			sendPropMessage(propDataTable, "m_szCrosshairCodes", 0, 128, "m_szCrosshairCodes", 0, 0),
+		),
+		protoVarint(1, 1),
+	}
+
+	w := &bitWriter{}
+	for _, table := range tables {
+		w.writeVarInt(svcSendTable)
+		w.writeVarInt(uint64(len(table)))
+		w.writeBytes(table)
+	}
+
+	w.writeInt(2, 16)
+	for i, class := range [][2]string{{"CWorld", "DT_World"}, {playerResourceClass, "DT_CSPlayerResource"}} {
+		w.writeInt(uint32(i), 16)
+		w.writeString(class[0])
+		w.writeString(class[1])
+	}
+
+	return w.bytes()
+}
+
+func sendTableMessage(name string, props ...[]byte) []byte {
+	message := protoBytes(2, []byte(name))
+	for _, prop := range props {
+		message = append(message, protoBytes(4, prop)...)
+	}
+	return message
+}
+
+func sendPropMessage(typ int, name string, flags, priority int, dtName string, numElements, numBits int) []byte {
+	message := concat(
+		protoVarint(1, uint64(typ)),
+		protoBytes(2, []byte(name)),
+		protoVarint(3, uint64(flags)),
+		protoVarint(4, uint64(priority)),
+		protoVarint(6, uint64(numElements)),
+		protoVarint(9, uint64(numBits)),
+	)
+	if dtName != "" {
+		message = append(message, protoBytes(5, []byte(dtName))...)
+	}
+	return message
+}
+
+// Builds a player_info_t struct.
+func playerInfo(name string, userID int32, steamID uint64, fake, hltv bool) []byte {
+	info := make([]byte, 340)
+	binary.BigEndian.PutUint64(info[8:16], steamID)
+	copy(info[16:144], name)
+	binary.BigEndian.PutUint32(info[144:148], uint32(userID))
+	if fake {
+		info[316] = 1
+	}
+	if hltv {
+		info[317] = 1
+	}
+	return info
+}
+
+// Writes an entry which directly follows the previous one.
+func writeStringTableEntry(w *bitWriter, index int, userData []byte) {
+	w.writeBit(true)
+	w.writeBit(true)
+	w.writeBit(false)
+	w.writeString(string(rune('0' + index)))
+	w.writeBit(true)
+	w.writeInt(uint32(len(userData)), 14)
+	w.writeBytes(userData)
+}
+
+func writeCreateEntity(w *bitWriter, classID int) {
+	w.writeBit(false)
+	w.writeBit(true)
+	w.writeInt(uint32(classID), 1)
+	w.writeInt(7, 10)
+}
+
+// Writes the prop indices the new way followed by their values.
+func writeProps(w *bitWriter, indices []int, values func()) {
+	w.writeBit(true)
+
+	last := -1
+	for _, index := range indices {
+		writePropIndex(w, index-last-1)
+		last = index
+	}
+	writePropIndex(w, lastPropIndex)
+
+	values()
+}
+
+func writePropIndex(w *bitWriter, offset int) {
+	if offset == 0 {
+		w.writeBit(true)
+		return
+	}
+	w.writeBit(false)
+
+	if offset < 8 {
+		w.writeBit(true)
+		w.writeInt(uint32(offset), 3)
+		return
+	}
+	w.writeBit(false)
+
+	switch {
+	case offset < 32:
+		w.writeInt(uint32(offset), 7)
+	case offset < 128:
+		w.writeInt(uint32(offset&31|32), 7)
+		w.writeInt(uint32(offset>>5), 2)
+	case offset < 512:
+		w.writeInt(uint32(offset&31|64), 7)
+		w.writeInt(uint32(offset>>5), 4)
+	default:
+		w.writeInt(uint32(offset&31|96), 7)
+		w.writeInt(uint32(offset>>5), 7)
+	}
+}
+
+func writeStringProp(w *bitWriter, value string) {
+	w.writeInt(uint32(len(value)), maxStringBits)
+	w.writeBytes([]byte(value))
+}
+
+type netMessage struct {
+	id   int
+	data []byte
+}
+
+// Writes a frame, the net messages are appended to the data of signon and packet frames.
+func writeFrame(demo *bytes.Buffer, cmd byte, tick int32, data []byte, messages ...netMessage) {
+	demo.WriteByte(cmd)
+	writeInt32(demo, tick)
+	demo.WriteByte(0)
+
+	if cmd == frameSignon || cmd == framePacket {
+		demo.Write(make([]byte, cmdInfoSize+8))
+
+		for _, message := range messages {
+			data = binary.AppendUvarint(data, uint64(message.id))
+			data = binary.AppendUvarint(data, uint64(len(message.data)))
+			data = append(data, message.data...)
+		}
+	}
+
+	writeInt32(demo, int32(len(data)))
+	demo.Write(data)
+}
+
+func writeInt32(buf *bytes.Buffer, value int32) {
+	_ = binary.Write(buf, binary.LittleEndian, value)
+}
+
+func protoVarint(number int, value uint64) []byte {
+	data := binary.AppendUvarint(nil, uint64(number)<<3)
+	return binary.AppendUvarint(data, value)
+}
+
+func protoBytes(number int, value []byte) []byte {
+	data := binary.AppendUvarint(nil, uint64(number)<<3|2)
+	data = binary.AppendUvarint(data, uint64(len(value)))
+	return append(data, value...)
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// bitWriter writes bit buffers the way bitReader reads them.
+type bitWriter struct {
+	data []byte
+	pos  int
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.pos&7 == 0 {
+		w.data = append(w.data, 0)
+	}
+	if bit {
+		w.data[w.pos>>3] |= 1 << (w.pos & 7)
+	}
+	w.pos++
+}
+
+func (w *bitWriter) writeInt(value uint32, bits int) {
+	for i := 0; i < bits; i++ {
+		w.writeBit(value>>i&1 == 1)
+	}
+}
+
+func (w *bitWriter) writeBytes(data []byte) {
+	for _, b := range data {
+		w.writeInt(uint32(b), 8)
+	}
+}
+
+func (w *bitWriter) writeString(value string) {
+	w.writeBytes([]byte(value))
+	w.writeInt(0, 8)
+}
+
+func (w *bitWriter) writeVarInt(value uint64) {
+	w.writeBytes(binary.AppendUvarint(nil, value))
+}
+
+func (w *bitWriter) writeUBitInt(value uint32) {
+	switch {
+	case value < 16:
+		w.writeInt(value, 6)
+	case value < 1<<8:
+		w.writeInt(value&15|16, 6)
+		w.writeInt(value>>4, 4)
+	case value < 1<<12:
+		w.writeInt(value&15|32, 6)
+		w.writeInt(value>>4, 8)
+	default:
+		w.writeInt(value&15|48, 6)
+		w.writeInt(value>>4, 28)
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	return w.data
+}
@@ -0,0 +1,255 @@
+package demo
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// Prop index offset which ends the list of changed props of an entity.
+const lastPropIndex = 0xfff
+
+var errUnknownEntity = errors.New("update of unknown entity")
+
+type entity struct {
+	class *serverClass
+}
+
+// Decodes the entity updates of a svc_PacketEntities message and records the crosshair codes of the player resource.
+//
+// Baselines are not applied, the player resource starts without crosshair codes and all of them are sent as updates.
+func (p *parser) handlePacketEntities(message []byte) error {
+	if p.serverClasses == nil {
+		return errors.New("entities sent before data tables")
+	}
+
+	fields, err := decodeProtobuf(message)
+	if err != nil {
+		return err
+	}
+
+	var updatedEntries int
+	var entityData []byte
+
+	for _, field := range fields {
+		switch field.number {
+		case 2:
+			updatedEntries = int(field.varint)
+		case 7:
+			entityData = field.bytes
+		}
+	}
+
+	r := newBitReader(entityData)
+	index := -1
+
+	for i := 0; i < updatedEntries && r.err == nil; i++ {
+		index += 1 + int(r.readUBitInt())
+
+		// Leaves the PVS, the second bit tells whether it is deleted as well.
+		if r.readBit() {
+			if r.readBit() {
+				delete(p.entities, index)
+			}
+			continue
+		}
+
+		ent := p.entities[index]
+
+		// Enters the PVS, created with its class and serial number.
+		if r.readBit() {
+			classID := int(r.readInt(p.classBits))
+			r.skip(10)
+
+			if classID >= len(p.serverClasses) {
+				return fmt.Errorf("entity %d has unknown class %d", index, classID)
+			}
+
+			ent = &entity{class: p.serverClasses[classID]}
+			p.entities[index] = ent
+		}
+
+		// Without the class the rest of the message can not be read.
+		if ent == nil {
+			return fmt.Errorf("%w %d", errUnknownEntity, index)
+		}
+
+		if err := p.readEntityProps(r, ent); err != nil {
+			return err
+		}
+	}
+
+	return r.err
+}
+
+// Reads the changed props of an entity, first their indices and then their values.
+func (p *parser) readEntityProps(r *bitReader, ent *entity) error {
+	newWay := r.readBit()
+
+	p.propIndices = p.propIndices[:0]
+	for index := -1; r.err == nil; {
+		index = readPropIndex(r, index, newWay)
+		if index < 0 {
+			break
+		}
+		p.propIndices = append(p.propIndices, index)
+	}
+
+	for _, index := range p.propIndices {
+		if index >= len(ent.class.props) {
+			return fmt.Errorf("prop %d of class %s does not exist", index, ent.class.name)
+		}
+
+		prop := ent.class.props[index]
+
+		if prop.crosshairOf > 0 {
+			p.setCrosshairCode(prop.crosshairOf, readStringProp(r))
+			continue
+		}
+
+		skipProp(r, prop.prop)
+	}
+
+	return r.err
+}
+
+// Returns the next prop index of an entity update or -1 after the last one.
+func readPropIndex(r *bitReader, last int, newWay bool) int {
+	if newWay && r.readBit() {
+		return last + 1
+	}
+
+	var offset uint32
+	if newWay && r.readBit() {
+		offset = r.readInt(3)
+	} else {
+		offset = r.readInt(7)
+		switch offset & (32 | 64) {
+		case 32:
+			offset = offset&^96 | r.readInt(2)<<5
+		case 64:
+			offset = offset&^96 | r.readInt(4)<<5
+		case 96:
+			offset = offset&^96 | r.readInt(7)<<5
+		}
+	}
+
+	if offset == lastPropIndex {
+		return -1
+	}
+
+	return last + 1 + int(offset)
+}
+
+func readStringProp(r *bitReader) string {
+	length := int(r.readInt(maxStringBits))
+	return cString(r.readBytes(length))
+}
+
+// Reads over the value of a prop, only crosshair codes are needed.
+func skipProp(r *bitReader, prop *sendProp) {
+	switch prop.typ {
+	case propInt:
+		if prop.flags&flagVarInt != 0 {
+			r.readVarInt()
+		} else {
+			r.skip(prop.numBits)
+		}
+	case propInt64:
+		if prop.flags&flagVarInt != 0 {
+			r.readVarInt()
+		} else {
+			r.skip(prop.numBits)
+		}
+	case propFloat:
+		skipFloat(r, prop)
+	case propVector:
+		skipFloat(r, prop)
+		skipFloat(r, prop)
+		if prop.flags&flagNormal != 0 {
+			// Only the sign of z is sent, its value follows from x and y.
+			r.skip(1)
+		} else {
+			skipFloat(r, prop)
+		}
+	case propVectorXY:
+		skipFloat(r, prop)
+		skipFloat(r, prop)
+	case propString:
+		r.skip(int(r.readInt(maxStringBits)) * 8)
+	case propArray:
+		elements := int(r.readInt(bits.Len(uint(prop.numElements))))
+		for i := 0; i < elements && r.err == nil; i++ {
+			if prop.elementProp == nil {
+				r.err = fmt.Errorf("array %s without element prop", prop.name)
+				return
+			}
+			skipProp(r, prop.elementProp)
+		}
+	}
+}
+
+func skipFloat(r *bitReader, prop *sendProp) {
+	switch {
+	case prop.flags&flagCoord != 0:
+		hasInt, hasFraction := r.readBit(), r.readBit()
+		if hasInt || hasFraction {
+			// Sign.
+			r.skip(1)
+		}
+		if hasInt {
+			r.skip(coordIntegerBits)
+		}
+		if hasFraction {
+			r.skip(coordFractionalBits)
+		}
+	case prop.flags&flagCoordMP != 0:
+		skipCoordMP(r, false, false)
+	case prop.flags&flagCoordMPLowPrecision != 0:
+		skipCoordMP(r, false, true)
+	case prop.flags&flagCoordMPIntegral != 0:
+		skipCoordMP(r, true, false)
+	case prop.flags&flagNoScale != 0:
+		r.skip(32)
+	case prop.flags&flagNormal != 0:
+		r.skip(1 + normalFractionalBits)
+	case prop.flags&flagCellCoord != 0:
+		r.skip(prop.numBits + coordFractionalBits)
+	case prop.flags&flagCellCoordLowPrecision != 0:
+		r.skip(prop.numBits + coordFractionalBitsLowPrecise)
+	case prop.flags&flagCellCoordIntegral != 0:
+		r.skip(prop.numBits)
+	default:
+		r.skip(prop.numBits)
+	}
+}
+
+func skipCoordMP(r *bitReader, integral, lowPrecision bool) {
+	inBounds := r.readBit()
+
+	integerBits := coordIntegerBits
+	if inBounds {
+		integerBits = coordIntegerBitsMP
+	}
+
+	if integral {
+		if r.readBit() {
+			// Sign.
+			r.skip(1 + integerBits)
+		}
+		return
+	}
+
+	hasInt := r.readBit()
+	// Sign.
+	r.skip(1)
+	if hasInt {
+		r.skip(integerBits)
+	}
+
+	if lowPrecision {
+		r.skip(coordFractionalBitsLowPrecise)
+	} else {
+		r.skip(coordFractionalBits)
+	}
+}
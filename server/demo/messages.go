@@ -0,0 +1,342 @@
+package demo
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"strings"
+)
+
+// Net message ids of the CS:GO protocol we care about.
+const (
+	svcCreateStringTable = 12
+	svcUpdateStringTable = 13
+	svcPacketEntities    = 26
+)
+
+const (
+	userInfoTable = "userinfo"
+
+	// Amount of recent entries the string table encoding may reference.
+	stringTableHistory = 32
+)
+
+var errInvalidProtobuf = errors.New("invalid protobuf message")
+
+type stringTable struct {
+	name             string
+	maxEntries       int
+	userDataFixed    bool
+	userDataSizeBits int
+}
+
+// protoField is a decoded protobuf field, either a varint or a length delimited value.
+type protoField struct {
+	number int
+	varint uint64
+	bytes  []byte
+}
+
+// Decodes the top level fields of a protobuf message.
+//
+// We only need a handful of fields from a few messages, a full protobuf
+// dependency and the generated CS:GO messages would be overkill.
+func decodeProtobuf(data []byte) ([]protoField, error) {
+	var fields []protoField
+
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errInvalidProtobuf
+		}
+		data = data[n:]
+
+		field := protoField{number: int(key >> 3)}
+
+		switch key & 7 {
+		case 0:
+			field.varint, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errInvalidProtobuf
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return nil, errInvalidProtobuf
+			}
+			data = data[8:]
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return nil, errInvalidProtobuf
+			}
+			field.bytes = data[n : n+int(length)]
+			data = data[n+int(length):]
+		case 5:
+			if len(data) < 4 {
+				return nil, errInvalidProtobuf
+			}
+			data = data[4:]
+		default:
+			return nil, errInvalidProtobuf
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// Handles the net messages of a packet frame.
+func (p *parser) handlePacket(data []byte) error {
+	for len(data) > 0 {
+		cmd, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errInvalidProtobuf
+		}
+		data = data[n:]
+
+		size, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < size {
+			return errInvalidProtobuf
+		}
+		message := data[n : n+int(size)]
+		data = data[n+int(size):]
+
+		switch cmd {
+		case svcCreateStringTable:
+			if err := p.handleCreateStringTable(message); err != nil {
+				return err
+			}
+		case svcUpdateStringTable:
+			if err := p.handleUpdateStringTable(message); err != nil {
+				return err
+			}
+		case svcPacketEntities:
+			if err := p.handlePacketEntities(message); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *parser) handleCreateStringTable(message []byte) error {
+	fields, err := decodeProtobuf(message)
+	if err != nil {
+		return err
+	}
+
+	var table stringTable
+	var numEntries, flags int
+	var stringData []byte
+
+	for _, field := range fields {
+		switch field.number {
+		case 1:
+			table.name = string(field.bytes)
+		case 2:
+			table.maxEntries = int(field.varint)
+		case 3:
+			numEntries = int(field.varint)
+		case 4:
+			table.userDataFixed = field.varint != 0
+		case 6:
+			table.userDataSizeBits = int(field.varint)
+		case 7:
+			flags = int(field.varint)
+		case 8:
+			stringData = field.bytes
+		}
+	}
+
+	p.stringTables = append(p.stringTables, table)
+
+	// Compressed tables never contain the user info, skip them.
+	if table.name != userInfoTable || flags&1 != 0 {
+		return nil
+	}
+
+	return p.parseStringTableEntries(table, numEntries, stringData)
+}
+
+func (p *parser) handleUpdateStringTable(message []byte) error {
+	fields, err := decodeProtobuf(message)
+	if err != nil {
+		return err
+	}
+
+	var tableID, numEntries int
+	var stringData []byte
+
+	for _, field := range fields {
+		switch field.number {
+		case 1:
+			tableID = int(field.varint)
+		case 2:
+			numEntries = int(field.varint)
+		case 3:
+			stringData = field.bytes
+		}
+	}
+
+	if tableID < 0 || tableID >= len(p.stringTables) {
+		return nil
+	}
+
+	table := p.stringTables[tableID]
+	if table.name != userInfoTable {
+		return nil
+	}
+
+	return p.parseStringTableEntries(table, numEntries, stringData)
+}
+
+// Parses the entries of a string table as sent in svc_CreateStringTable / svc_UpdateStringTable.
+func (p *parser) parseStringTableEntries(table stringTable, numEntries int, data []byte) error {
+	r := newBitReader(data)
+
+	// Dictionary encoded tables are not used for the user info.
+	if r.readBit() {
+		return nil
+	}
+
+	entryBits := bits.Len(uint(table.maxEntries - 1))
+	lastEntry := -1
+
+	var history []string
+
+	for i := 0; i < numEntries && r.err == nil; i++ {
+		entryIndex := lastEntry + 1
+		if !r.readBit() {
+			entryIndex = int(r.readInt(entryBits))
+		}
+		lastEntry = entryIndex
+
+		var entry string
+		if r.readBit() {
+			if r.readBit() {
+				// Entry starts with a part of a previous entry.
+				index := int(r.readInt(5))
+				length := int(r.readInt(5))
+
+				if index < len(history) && length <= len(history[index]) {
+					entry = history[index][:length]
+				}
+
+				entry += r.readString()
+			} else {
+				entry = r.readString()
+			}
+		}
+
+		history = append(history, entry)
+		if len(history) > stringTableHistory {
+			history = history[1:]
+		}
+
+		if !r.readBit() {
+			continue
+		}
+
+		var userData []byte
+		if table.userDataFixed {
+			userData = r.readBytes((table.userDataSizeBits + 7) / 8)
+		} else {
+			userData = r.readBytes(int(r.readInt(14)))
+		}
+
+		p.handleUserInfo(entryIndex, userData)
+	}
+
+	return r.err
+}
+
+// Parses the string tables snapshot stored in dem_stringtables frames.
+func (p *parser) handleStringTablesFrame(data []byte) error {
+	r := newBitReader(data)
+
+	numTables := int(r.readByte())
+
+	for i := 0; i < numTables && r.err == nil; i++ {
+		name := r.readString()
+
+		numStrings := int(r.readInt(16))
+		for j := 0; j < numStrings && r.err == nil; j++ {
+			r.readString()
+
+			if r.readBit() {
+				userData := r.readBytes(int(r.readInt(16)))
+
+				if name == userInfoTable {
+					p.handleUserInfo(j, userData)
+				}
+			}
+		}
+
+		// Client side strings, not needed.
+		if r.readBit() {
+			numStrings := int(r.readInt(16))
+			for j := 0; j < numStrings && r.err == nil; j++ {
+				r.readString()
+
+				if r.readBit() {
+					r.readBytes(int(r.readInt(16)))
+				}
+			}
+		}
+	}
+
+	return r.err
+}
+
+// Parses a player_info_t struct, all numbers are stored big endian.
+func (p *parser) handleUserInfo(entryIndex int, data []byte) {
+	const (
+		nameOffset    = 16
+		nameLength    = 128
+		userIDOffset  = nameOffset + nameLength
+		guidOffset    = userIDOffset + 4
+		guidLength    = 33
+		friendsOffset = guidOffset + guidLength + 3
+		fakeOffset    = friendsOffset + 4 + nameLength
+		hltvOffset    = fakeOffset + 1
+	)
+
+	if len(data) <= hltvOffset {
+		return
+	}
+
+	player := &Player{
+		EntityIndex: entryIndex + 1,
+		SteamID64:   binary.BigEndian.Uint64(data[8:16]),
+		Name:        cString(data[nameOffset : nameOffset+nameLength]),
+		UserID:      int(int32(binary.BigEndian.Uint32(data[userIDOffset:guidOffset]))),
+		IsBot:       data[fakeOffset] != 0,
+	}
+
+	// Ignore the GOTV client, it does not play.
+	if data[hltvOffset] != 0 {
+		return
+	}
+
+	// Updates of the same player (e.g. a new name) keep their crosshair.
+	if existing, ok := p.players[player.EntityIndex]; ok && existing.UserID == player.UserID {
+		player.CrosshairCode = existing.CrosshairCode
+	}
+
+	if code, ok := p.pendingCodes[player.EntityIndex]; ok {
+		player.CrosshairCode = code
+		delete(p.pendingCodes, player.EntityIndex)
+	}
+
+	p.players[player.EntityIndex] = player
+}
+
+func cString(data []byte) string {
+	if index := strings.IndexByte(string(data), 0); index >= 0 {
+		return string(data[:index])
+	}
+	return string(data)
+}
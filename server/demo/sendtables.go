@@ -0,0 +1,364 @@
+package demo
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Net message id of the send tables inside the dem_datatables frame.
+const svcSendTable = 9
+
+// Types of send props.
+const (
+	propInt = iota
+	propFloat
+	propVector
+	propVectorXY
+	propString
+	propArray
+	propDataTable
+	propInt64
+)
+
+// Flags of send props, only the ones which change how a prop is read or flattened.
+const (
+	flagCoord                 = 1 << 1
+	flagNoScale               = 1 << 2
+	flagNormal                = 1 << 5
+	flagExclude               = 1 << 6
+	flagInsideArray           = 1 << 8
+	flagCollapsible           = 1 << 11
+	flagCoordMP               = 1 << 12
+	flagCoordMPLowPrecision   = 1 << 13
+	flagCoordMPIntegral       = 1 << 14
+	flagCellCoord             = 1 << 15
+	flagCellCoordLowPrecision = 1 << 16
+	flagCellCoordIntegral     = 1 << 17
+	flagChangesOften          = 1 << 18
+	flagVarInt                = 1 << 19
+)
+
+// Bit sizes of encoded prop values.
+const (
+	maxStringBits                 = 9
+	coordIntegerBits              = 14
+	coordFractionalBits           = 5
+	coordIntegerBitsMP            = 11
+	coordFractionalBitsLowPrecise = 3
+	normalFractionalBits          = 11
+)
+
+// Props which change often are sorted as if they had this priority.
+const changesOftenPriority = 64
+
+const (
+	playerResourceClass = "CCSPlayerResource"
+	crosshairCodesProp  = "m_szCrosshairCodes."
+)
+
+var errUnknownSendTable = errors.New("unknown send table")
+
+type sendProp struct {
+	typ         int
+	name        string
+	flags       int
+	priority    int
+	dtName      string
+	numElements int
+	numBits     int
+
+	// Set for arrays, the prop every element is read with.
+	elementProp *sendProp
+}
+
+type sendTable struct {
+	name  string
+	props []*sendProp
+}
+
+// flatProp is a prop of the flattened send table of a server class, entity updates reference them by index.
+type flatProp struct {
+	prop *sendProp
+	// Full name including the names of the data tables, e.g. m_szCrosshairCodes.001.
+	name string
+	// Entity index of the player the prop holds the crosshair code of, 0 for every other prop.
+	crosshairOf int
+}
+
+type serverClass struct {
+	id    int
+	name  string
+	table string
+	props []flatProp
+}
+
+type excludedProp struct {
+	table string
+	name  string
+}
+
+// Parses the dem_datatables frame: the send tables followed by the server classes.
+func (p *parser) handleDataTablesFrame(data []byte) error {
+	r := newBitReader(data)
+
+	tables := make(map[string]*sendTable)
+
+	for r.err == nil {
+		cmd := r.readVarInt()
+		size := int(r.readVarInt())
+		message := r.readBytes(size)
+		if r.err != nil {
+			break
+		}
+
+		if cmd != svcSendTable {
+			return fmt.Errorf("unexpected message %d in data tables", cmd)
+		}
+
+		table, isEnd, err := parseSendTable(message)
+		if err != nil {
+			return err
+		}
+		if isEnd {
+			break
+		}
+
+		tables[table.name] = table
+	}
+
+	numClasses := int(r.readInt(16))
+
+	p.serverClasses = make([]*serverClass, 0, numClasses)
+
+	for i := 0; i < numClasses && r.err == nil; i++ {
+		class := &serverClass{
+			id:    int(r.readInt(16)),
+			name:  r.readString(),
+			table: r.readString(),
+		}
+
+		if class.id != i {
+			return fmt.Errorf("server class %s has id %d, want %d", class.name, class.id, i)
+		}
+
+		p.serverClasses = append(p.serverClasses, class)
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+
+	for _, class := range p.serverClasses {
+		if err := class.flatten(tables); err != nil {
+			return err
+		}
+	}
+
+	p.classBits = bits.Len(uint(numClasses - 1))
+
+	return nil
+}
+
+func parseSendTable(message []byte) (*sendTable, bool, error) {
+	fields, err := decodeProtobuf(message)
+	if err != nil {
+		return nil, false, err
+	}
+
+	table := &sendTable{}
+	isEnd := false
+
+	for _, field := range fields {
+		switch field.number {
+		case 1:
+			isEnd = field.varint != 0
+		case 2:
+			table.name = string(field.bytes)
+		case 4:
+			prop, err := parseSendProp(field.bytes)
+			if err != nil {
+				return nil, false, err
+			}
+
+			// Arrays are read with the prop sent right before them.
+			if prop.typ == propArray && len(table.props) > 0 {
+				prop.elementProp = table.props[len(table.props)-1]
+			}
+
+			table.props = append(table.props, prop)
+		}
+	}
+
+	return table, isEnd, nil
+}
+
+func parseSendProp(message []byte) (*sendProp, error) {
+	fields, err := decodeProtobuf(message)
+	if err != nil {
+		return nil, err
+	}
+
+	prop := &sendProp{}
+
+	for _, field := range fields {
+		switch field.number {
+		case 1:
+			prop.typ = int(field.varint)
+		case 2:
+			prop.name = string(field.bytes)
+		case 3:
+			prop.flags = int(field.varint)
+		case 4:
+			prop.priority = int(field.varint)
+		case 5:
+			prop.dtName = string(field.bytes)
+		case 6:
+			prop.numElements = int(field.varint)
+		case 9:
+			prop.numBits = int(field.varint)
+		}
+	}
+
+	return prop, nil
+}
+
+// Builds the list of props entity updates of the class index into, the same way the engine does.
+func (c *serverClass) flatten(tables map[string]*sendTable) error {
+	table, ok := tables[c.table]
+	if !ok {
+		return fmt.Errorf("%w %s of class %s", errUnknownSendTable, c.table, c.name)
+	}
+
+	var excludes []excludedProp
+	if err := gatherExcludes(tables, table, &excludes); err != nil {
+		return err
+	}
+
+	c.props = nil
+	if err := c.gatherProps(tables, table, excludes, ""); err != nil {
+		return err
+	}
+
+	c.sortByPriority()
+
+	if c.name == playerResourceClass {
+		for i := range c.props {
+			if index, ok := strings.CutPrefix(c.props[i].name, crosshairCodesProp); ok {
+				// Element 000 belongs to the world, players start at 1.
+				c.props[i].crosshairOf, _ = strconv.Atoi(index)
+			}
+		}
+	}
+
+	return nil
+}
+
+func gatherExcludes(tables map[string]*sendTable, table *sendTable, excludes *[]excludedProp) error {
+	for _, prop := range table.props {
+		if prop.flags&flagExclude != 0 {
+			*excludes = append(*excludes, excludedProp{table: prop.dtName, name: prop.name})
+		}
+
+		if prop.typ == propDataTable {
+			sub, ok := tables[prop.dtName]
+			if !ok {
+				return fmt.Errorf("%w %s", errUnknownSendTable, prop.dtName)
+			}
+			if err := gatherExcludes(tables, sub, excludes); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Props of collapsible data tables are added in place, other data tables are added as a whole before the props of the table.
+func (c *serverClass) gatherProps(tables map[string]*sendTable, table *sendTable, excludes []excludedProp, prefix string) error {
+	var props []flatProp
+	if err := c.iterateProps(tables, table, excludes, prefix, &props); err != nil {
+		return err
+	}
+
+	c.props = append(c.props, props...)
+	return nil
+}
+
+func (c *serverClass) iterateProps(tables map[string]*sendTable, table *sendTable, excludes []excludedProp, prefix string, props *[]flatProp) error {
+	for _, prop := range table.props {
+		if prop.flags&(flagInsideArray|flagExclude) != 0 || isExcluded(excludes, table, prop) {
+			continue
+		}
+
+		if prop.typ != propDataTable {
+			*props = append(*props, flatProp{prop: prop, name: prefix + prop.name})
+			continue
+		}
+
+		sub, ok := tables[prop.dtName]
+		if !ok {
+			return fmt.Errorf("%w %s", errUnknownSendTable, prop.dtName)
+		}
+
+		var err error
+		if prop.flags&flagCollapsible != 0 {
+			err = c.iterateProps(tables, sub, excludes, prefix, props)
+		} else {
+			err = c.gatherProps(tables, sub, excludes, prefix+prop.name+".")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isExcluded(excludes []excludedProp, table *sendTable, prop *sendProp) bool {
+	for _, exclude := range excludes {
+		if exclude.table == table.name && exclude.name == prop.name {
+			return true
+		}
+	}
+	return false
+}
+
+// Moves props with a lower priority to the front, props which change often count as priority 64.
+//
+// This is no stable sort, the engine swaps props and so do we.
+func (c *serverClass) sortByPriority() {
+	priorities := []int{changesOftenPriority}
+	seen := map[int]bool{changesOftenPriority: true}
+
+	for _, prop := range c.props {
+		if !seen[prop.prop.priority] {
+			seen[prop.prop.priority] = true
+			priorities = append(priorities, prop.prop.priority)
+		}
+	}
+
+	sort.Ints(priorities)
+
+	start := 0
+	for _, priority := range priorities {
+		for {
+			current := start
+			for ; current < len(c.props); current++ {
+				prop := c.props[current].prop
+				if prop.priority == priority || (priority == changesOftenPriority && prop.flags&flagChangesOften != 0) {
+					c.props[start], c.props[current] = c.props[current], c.props[start]
+					start++
+					break
+				}
+			}
+
+			if current == len(c.props) {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,305 @@
+// Package jobs runs long running work (demo parsing, image rendering, ...) in the background
+// so it never blocks an HTTP request.
+//
+// Jobs are submitted with a type and a JSON payload, workers pick them up from a Store
+// and run the Handler registered for the type. Failed jobs are retried with a backoff
+// until they run out of attempts, results and errors are kept on the job for polling.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/devusSs/crosshairs/logging"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultMaxAttempts = 3
+	baseRetryDelay     = 5 * time.Second
+
+	// Maximum runtime of a single attempt.
+	jobTimeout = 10 * time.Minute
+
+	// How long workers wait for a job before checking whether they should stop.
+	popTimeout = 2 * time.Second
+
+	// How often jobs whose worker died are looked for, see Store.Requeue.
+	requeueInterval = time.Minute
+)
+
+var (
+	ErrJobNotFound    = errors.New("job not found")
+	ErrNoJob          = errors.New("no job available")
+	ErrUnknownJobType = errors.New("unknown job type")
+	ErrJobInterrupted = errors.New("job was interrupted")
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+type Job struct {
+	ID          uuid.UUID       `json:"id"`
+	Type        string          `json:"type"`
+	UserID      uuid.UUID       `json:"user_id"`
+	Status      Status          `json:"status"`
+	Payload     json.RawMessage `json:"payload"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// LastAttempt reports whether the current attempt is the last one, e.g. to clean up files.
+func (j *Job) LastAttempt() bool {
+	return j.Attempts >= j.MaxAttempts
+}
+
+// Handler runs a job and returns a JSON serializable result.
+type Handler func(ctx context.Context, job *Job) (interface{}, error)
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as not retryable, e.g. for invalid input.
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+type Service struct {
+	store    Store
+	handlers map[string]Handler
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewService(store Store) *Service {
+	return &Service{
+		store:    store,
+		handlers: make(map[string]Handler),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Register sets the handler for a job type, needs to be called before Start.
+func (s *Service) Register(jobType string, handler Handler) {
+	s.handlers[jobType] = handler
+}
+
+// Submit queues a new job for the user and returns it.
+func (s *Service) Submit(ctx context.Context, jobType string, userID uuid.UUID, payload interface{}) (*Job, error) {
+	if _, ok := s.handlers[jobType]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJobType, jobType)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	job := &Job{
+		ID:          uuid.New(),
+		Type:        jobType,
+		UserID:      userID,
+		Status:      StatusQueued,
+		Payload:     data,
+		MaxAttempts: defaultMaxAttempts,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err := s.store.Save(ctx, job); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.Push(ctx, job.ID, now); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// Get returns the current state of a job.
+func (s *Service) Get(ctx context.Context, id uuid.UUID) (*Job, error) {
+	return s.store.Get(ctx, id)
+}
+
+// Start launches the workers, they run until Stop is called.
+//
+// Jobs left running by a previous (crashed) process are queued again once their lease runs out.
+func (s *Service) Start(workers int) {
+	s.wg.Add(1)
+	go s.requeue()
+
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+}
+
+// Stop waits for the running jobs to finish and closes the store.
+func (s *Service) Stop() error {
+	close(s.stop)
+	s.wg.Wait()
+	return s.store.Close()
+}
+
+func (s *Service) work() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		id, err := s.store.Pop(context.Background(), popTimeout)
+		if err != nil {
+			if !errors.Is(err, ErrNoJob) {
+				log.Printf("%s Error fetching job: %s\n", logging.ErrSign, err.Error())
+				time.Sleep(popTimeout)
+			}
+			continue
+		}
+
+		err = s.run(id)
+		if err != nil {
+			log.Printf("%s Error running job %s: %s\n", logging.ErrSign, id.String(), err.Error())
+		}
+
+		// On other store errors the job stays leased and is requeued later.
+		if err == nil || errors.Is(err, ErrJobNotFound) {
+			if err := s.store.Ack(context.Background(), id); err != nil {
+				log.Printf("%s Error acknowledging job %s: %s\n", logging.ErrSign, id.String(), err.Error())
+			}
+		}
+	}
+}
+
+func (s *Service) requeue() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(requeueInterval)
+	defer ticker.Stop()
+
+	for {
+		requeued, err := s.store.Requeue(context.Background())
+		if err != nil {
+			log.Printf("%s Error requeueing interrupted jobs: %s\n", logging.ErrSign, err.Error())
+		}
+		if requeued > 0 {
+			log.Printf("%s Requeued %d interrupted job(s)\n", logging.WarnSign, requeued)
+		}
+
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Runs a single attempt of a job, errors returned are store errors, not job errors.
+func (s *Service) run(id uuid.UUID) error {
+	ctx := context.Background()
+
+	job, err := s.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	switch job.Status {
+	case StatusSucceeded, StatusFailed:
+		// Finished before, only the acknowledgement got lost.
+		return nil
+	case StatusRunning:
+		// Requeued after the worker running it died, that attempt counts as failed.
+		// Not retrying it endlessly keeps a job crashing the API from doing so over and over.
+		if job.LastAttempt() {
+			job.Status = StatusFailed
+			job.Error = ErrJobInterrupted.Error()
+			job.UpdatedAt = time.Now()
+			return s.store.Save(ctx, job)
+		}
+	}
+
+	job.Status = StatusRunning
+	job.Attempts++
+	job.UpdatedAt = time.Now()
+
+	if err := s.store.Save(ctx, job); err != nil {
+		return err
+	}
+
+	result, err := s.handle(job)
+	if err == nil {
+		job.Result, err = json.Marshal(result)
+	}
+
+	job.UpdatedAt = time.Now()
+
+	if err == nil {
+		job.Status = StatusSucceeded
+		job.Error = ""
+		return s.store.Save(ctx, job)
+	}
+
+	job.Error = err.Error()
+
+	var permanent *permanentError
+	if errors.As(err, &permanent) || job.LastAttempt() {
+		job.Status = StatusFailed
+		return s.store.Save(ctx, job)
+	}
+
+	job.Status = StatusQueued
+
+	if err := s.store.Save(ctx, job); err != nil {
+		return err
+	}
+
+	// Exponential backoff, 5s, 10s, 20s, ...
+	delay := baseRetryDelay << (job.Attempts - 1)
+
+	return s.store.Push(ctx, job.ID, time.Now().Add(delay))
+}
+
+// Calls the job's handler, panics are turned into (retryable) errors.
+func (s *Service) handle(job *Job) (result interface{}, err error) {
+	handler, ok := s.handlers[job.Type]
+	if !ok {
+		return nil, Permanent(fmt.Errorf("%w: %s", ErrUnknownJobType, job.Type))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+
+	return handler(ctx, job)
+}
@@ -0,0 +1,164 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Submits a job and runs one attempt of it like a worker would.
+func runOnce(t *testing.T, svc *Service, store *MemoryStore, jobType string) *Job {
+	t.Helper()
+
+	ctx := context.Background()
+
+	job, err := svc.Submit(ctx, jobType, uuid.New(), map[string]string{"key": "value"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := store.Pop(ctx, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != job.ID {
+		t.Fatalf("popped %s, want %s", id, job.ID)
+	}
+
+	if err := svc.run(id); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err = svc.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestServiceRun(t *testing.T) {
+	store := NewMemoryStore()
+	svc := NewService(store)
+
+	svc.Register("succeed", func(ctx context.Context, job *Job) (interface{}, error) {
+		return map[string]int{"attempt": job.Attempts}, nil
+	})
+	svc.Register("retry", func(ctx context.Context, job *Job) (interface{}, error) {
+		return nil, errors.New("temporary")
+	})
+	svc.Register("permanent", func(ctx context.Context, job *Job) (interface{}, error) {
+		return nil, Permanent(errors.New("invalid payload"))
+	})
+	svc.Register("panic", func(ctx context.Context, job *Job) (interface{}, error) {
+		panic("boom")
+	})
+
+	job := runOnce(t, svc, store, "succeed")
+	if job.Status != StatusSucceeded || string(job.Result) != `{"attempt":1}` {
+		t.Errorf("succeeded job has status %s and result %s", job.Status, job.Result)
+	}
+
+	job = runOnce(t, svc, store, "retry")
+	if job.Status != StatusQueued || job.Attempts != 1 || job.Error != "temporary" {
+		t.Errorf("failed job has status %s after %d attempts with error %q, want queued", job.Status, job.Attempts, job.Error)
+	}
+
+	job = runOnce(t, svc, store, "permanent")
+	if job.Status != StatusFailed || job.Attempts != 1 {
+		t.Errorf("permanently failed job has status %s after %d attempts, want failed", job.Status, job.Attempts)
+	}
+
+	job = runOnce(t, svc, store, "panic")
+	if job.Status != StatusQueued || job.Error != "job panicked: boom" {
+		t.Errorf("panicked job has status %s with error %q, want queued", job.Status, job.Error)
+	}
+
+	if _, err := svc.Submit(context.Background(), "unknown", uuid.New(), nil); !errors.Is(err, ErrUnknownJobType) {
+		t.Errorf("Submit of unknown type returned %v, want ErrUnknownJobType", err)
+	}
+}
+
+func TestServiceRunInterrupted(t *testing.T) {
+	store := NewMemoryStore()
+	svc := NewService(store)
+	ctx := context.Background()
+
+	runs := 0
+	svc.Register("test", func(ctx context.Context, job *Job) (interface{}, error) {
+		runs++
+		return nil, nil
+	})
+
+	// Left behind by a worker which died while running the job.
+	interrupted := &Job{ID: uuid.New(), Type: "test", Status: StatusRunning, Attempts: 1, MaxAttempts: 3}
+	exhausted := &Job{ID: uuid.New(), Type: "test", Status: StatusRunning, Attempts: 3, MaxAttempts: 3}
+	finished := &Job{ID: uuid.New(), Type: "test", Status: StatusSucceeded, Attempts: 1, MaxAttempts: 3}
+
+	for _, job := range []*Job{interrupted, exhausted, finished} {
+		if err := store.Save(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+		if err := svc.run(job.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if runs != 1 {
+		t.Errorf("handler ran %d times, want 1", runs)
+	}
+
+	job, _ := svc.Get(ctx, interrupted.ID)
+	if job.Status != StatusSucceeded || job.Attempts != 2 {
+		t.Errorf("interrupted job has status %s after %d attempts, want succeeded after 2", job.Status, job.Attempts)
+	}
+
+	job, _ = svc.Get(ctx, exhausted.ID)
+	if job.Status != StatusFailed || job.Error != ErrJobInterrupted.Error() {
+		t.Errorf("interrupted job without attempts left has status %s with error %q", job.Status, job.Error)
+	}
+
+	job, _ = svc.Get(ctx, finished.ID)
+	if job.Status != StatusSucceeded || job.Attempts != 1 {
+		t.Errorf("finished job ran again, status %s after %d attempts", job.Status, job.Attempts)
+	}
+}
+
+func TestServiceWorkers(t *testing.T) {
+	store := NewMemoryStore()
+	svc := NewService(store)
+
+	done := make(chan uuid.UUID, 1)
+	svc.Register("test", func(ctx context.Context, job *Job) (interface{}, error) {
+		done <- job.ID
+		return nil, nil
+	})
+
+	svc.Start(2)
+
+	job, err := svc.Submit(context.Background(), "test", uuid.New(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case id := <-done:
+		if id != job.ID {
+			t.Errorf("ran %s, want %s", id, job.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job was not run")
+	}
+
+	if err := svc.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.processing) != 0 {
+		t.Errorf("%d jobs were not acknowledged", len(store.processing))
+	}
+}
@@ -0,0 +1,208 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisJobPrefix  = "jobs:job:"
+	redisQueueKey   = "jobs:queue"
+	redisDelayedKey = "jobs:delayed"
+	// Popped jobs stay in this list until they are acknowledged, their leases are a
+	// sorted set scored by the time they run out.
+	redisProcessingKey = "jobs:processing"
+	redisLeasesKey     = "jobs:leases"
+
+	// Jobs (and their results) are removed after this time.
+	jobRetention = 24 * time.Hour
+)
+
+// RedisStore keeps jobs in Redis so they survive restarts of the API.
+//
+// Jobs are stored as JSON, the queue is a list and retries waiting for their
+// backoff are kept in a sorted set scored by the time they are due. Pop moves jobs
+// into a processing list atomically so a crashed worker does not lose them.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(host string, port int, password string) (*RedisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%d", host, port),
+		Password: password,
+	})
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, err
+	}
+
+	return &RedisStore{client}, nil
+}
+
+func (r *RedisStore) Save(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Set(ctx, redisJobPrefix+job.ID.String(), data, jobRetention).Err()
+}
+
+func (r *RedisStore) Get(ctx context.Context, id uuid.UUID) (*Job, error) {
+	data, err := r.client.Get(ctx, redisJobPrefix+id.String()).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrJobNotFound
+		}
+		return nil, err
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (r *RedisStore) Push(ctx context.Context, id uuid.UUID, runAt time.Time) error {
+	if time.Until(runAt) > 0 {
+		return r.client.ZAdd(ctx, redisDelayedKey, redis.Z{Score: float64(runAt.Unix()), Member: id.String()}).Err()
+	}
+
+	return r.client.LPush(ctx, redisQueueKey, id.String()).Err()
+}
+
+func (r *RedisStore) Pop(ctx context.Context, timeout time.Duration) (uuid.UUID, error) {
+	if err := r.promoteDelayed(ctx); err != nil {
+		return uuid.Nil, err
+	}
+
+	result, err := r.client.BLMove(ctx, redisQueueKey, redisProcessingKey, "RIGHT", "LEFT", timeout).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return uuid.Nil, ErrNoJob
+		}
+		return uuid.Nil, err
+	}
+
+	id, err := uuid.Parse(result)
+	if err != nil {
+		// Nothing can run it, do not leave it around in the processing list.
+		if err := r.client.LRem(ctx, redisProcessingKey, 1, result).Err(); err != nil {
+			return uuid.Nil, err
+		}
+		return uuid.Nil, fmt.Errorf("invalid job id %q in queue: %w", result, err)
+	}
+
+	lease := redis.Z{Score: float64(time.Now().Add(processingLease).Unix()), Member: result}
+	if err := r.client.ZAdd(ctx, redisLeasesKey, lease).Err(); err != nil {
+		return uuid.Nil, err
+	}
+
+	return id, nil
+}
+
+func (r *RedisStore) Ack(ctx context.Context, id uuid.UUID) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, redisProcessingKey, 1, id.String())
+		pipe.ZRem(ctx, redisLeasesKey, id.String())
+		return nil
+	})
+	return err
+}
+
+func (r *RedisStore) Requeue(ctx context.Context) (int, error) {
+	processing, err := r.client.LRange(ctx, redisProcessingKey, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	requeued := 0
+
+	for _, id := range processing {
+		until, err := r.client.ZScore(ctx, redisLeasesKey, id).Result()
+		if errors.Is(err, redis.Nil) {
+			// Either just popped and the lease is about to be set or the worker died in between,
+			// give it a lease so it is requeued later if it is still not acknowledged then.
+			lease := redis.Z{Score: float64(now.Add(processingLease).Unix()), Member: id}
+			if err := r.client.ZAddNX(ctx, redisLeasesKey, lease).Err(); err != nil {
+				return requeued, err
+			}
+			continue
+		}
+		if err != nil {
+			return requeued, err
+		}
+
+		if int64(until) > now.Unix() {
+			continue
+		}
+
+		// Only the instance which actually removed the lease requeues the job, others may race us here.
+		removed, err := r.client.ZRem(ctx, redisLeasesKey, id).Result()
+		if err != nil {
+			return requeued, err
+		}
+
+		if removed == 0 {
+			continue
+		}
+
+		// Pushed to the end Pop takes from, the job already waited long enough.
+		_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.LRem(ctx, redisProcessingKey, 1, id)
+			pipe.RPush(ctx, redisQueueKey, id)
+			return nil
+		})
+		if err != nil {
+			return requeued, err
+		}
+
+		requeued++
+	}
+
+	return requeued, nil
+}
+
+// Moves retries which are due from the delayed set into the queue.
+func (r *RedisStore) promoteDelayed(ctx context.Context) error {
+	due, err := r.client.ZRangeByScore(ctx, redisDelayedKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range due {
+		// Only the worker which actually removed the entry queues it, others may race us here.
+		removed, err := r.client.ZRem(ctx, redisDelayedKey, id).Result()
+		if err != nil {
+			return err
+		}
+
+		if removed == 0 {
+			continue
+		}
+
+		if err := r.client.LPush(ctx, redisQueueKey, id).Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *RedisStore) Close() error {
+	return r.client.Close()
+}
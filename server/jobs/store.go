@@ -0,0 +1,137 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// How long a popped job may run before it is considered lost, needs to be longer than jobTimeout.
+const processingLease = jobTimeout + time.Minute
+
+// Store persists jobs and the queue of jobs waiting to run.
+type Store interface {
+	Save(ctx context.Context, job *Job) error
+	// Returns ErrJobNotFound if the job does not exist (anymore).
+	Get(ctx context.Context, id uuid.UUID) (*Job, error)
+	// Queues the job to run at runAt or as soon as possible if runAt is in the past.
+	Push(ctx context.Context, id uuid.UUID, runAt time.Time) error
+	// Waits up to timeout for a job which is due, returns ErrNoJob if there is none.
+	//
+	// The job is leased to the caller until it calls Ack, it is not lost if the caller dies.
+	Pop(ctx context.Context, timeout time.Duration) (uuid.UUID, error)
+	// Releases a popped job once its attempt finished and its state is saved.
+	Ack(ctx context.Context, id uuid.UUID) error
+	// Queues popped jobs again whose lease ran out without Ack, returns how many there were.
+	Requeue(ctx context.Context) (int, error)
+	Close() error
+}
+
+// MemoryStore keeps jobs in memory, used for tests and when running without Redis.
+//
+// Jobs are lost on restart and never expire.
+type MemoryStore struct {
+	mu    sync.Mutex
+	jobs  map[uuid.UUID]Job
+	queue chan uuid.UUID
+	// Popped jobs and when their lease runs out.
+	processing map[uuid.UUID]time.Time
+	lease      time.Duration
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		jobs:       make(map[uuid.UUID]Job),
+		queue:      make(chan uuid.UUID, 1024),
+		processing: make(map[uuid.UUID]time.Time),
+		lease:      processingLease,
+	}
+}
+
+func (m *MemoryStore) Save(ctx context.Context, job *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.jobs[job.ID] = *job
+	return nil
+}
+
+func (m *MemoryStore) Get(ctx context.Context, id uuid.UUID) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return &job, nil
+}
+
+func (m *MemoryStore) Push(ctx context.Context, id uuid.UUID, runAt time.Time) error {
+	if delay := time.Until(runAt); delay > 0 {
+		time.AfterFunc(delay, func() { m.queue <- id })
+		return nil
+	}
+
+	select {
+	case m.queue <- id:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *MemoryStore) Pop(ctx context.Context, timeout time.Duration) (uuid.UUID, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case id := <-m.queue:
+		m.mu.Lock()
+		m.processing[id] = time.Now().Add(m.lease)
+		m.mu.Unlock()
+		return id, nil
+	case <-timer.C:
+		return uuid.Nil, ErrNoJob
+	case <-ctx.Done():
+		return uuid.Nil, ctx.Err()
+	}
+}
+
+func (m *MemoryStore) Ack(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.processing, id)
+	return nil
+}
+
+func (m *MemoryStore) Requeue(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	requeued := 0
+	for id, until := range m.processing {
+		if time.Now().Before(until) {
+			continue
+		}
+
+		select {
+		case m.queue <- id:
+		default:
+			// Queue is full, the job stays leased and is requeued next time.
+			continue
+		}
+
+		delete(m.processing, id)
+		requeued++
+	}
+
+	return requeued, nil
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
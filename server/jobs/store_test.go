@@ -0,0 +1,144 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMemoryStoreSaveGet(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, uuid.New()); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("Get of unknown job returned %v, want ErrJobNotFound", err)
+	}
+
+	job := &Job{ID: uuid.New(), Type: "test", Status: StatusQueued}
+	if err := store.Save(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	// The store keeps a copy, changes need to be saved.
+	job.Status = StatusRunning
+
+	saved, err := store.Get(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != StatusQueued {
+		t.Errorf("saved job has status %s, want %s", saved.Status, StatusQueued)
+	}
+}
+
+func TestMemoryStorePushPop(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	first, second := uuid.New(), uuid.New()
+	for _, id := range []uuid.UUID{first, second} {
+		if err := store.Push(ctx, id, time.Now().Add(-time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []uuid.UUID{first, second} {
+		id, err := store.Pop(ctx, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != want {
+			t.Errorf("popped %s, want %s", id, want)
+		}
+	}
+
+	if _, err := store.Pop(ctx, 10*time.Millisecond); !errors.Is(err, ErrNoJob) {
+		t.Errorf("Pop of empty queue returned %v, want ErrNoJob", err)
+	}
+}
+
+func TestMemoryStorePushDelayed(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	id := uuid.New()
+	if err := store.Push(ctx, id, time.Now().Add(100*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Pop(ctx, 10*time.Millisecond); !errors.Is(err, ErrNoJob) {
+		t.Fatalf("delayed job was popped before it was due: %v", err)
+	}
+
+	popped, err := store.Pop(ctx, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if popped != id {
+		t.Errorf("popped %s, want %s", popped, id)
+	}
+}
+
+func TestMemoryStorePopCancelled(t *testing.T) {
+	store := NewMemoryStore()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := store.Pop(ctx, time.Second); !errors.Is(err, context.Canceled) {
+		t.Errorf("Pop with cancelled context returned %v, want context.Canceled", err)
+	}
+}
+
+func TestMemoryStoreRequeue(t *testing.T) {
+	store := NewMemoryStore()
+	store.lease = 50 * time.Millisecond
+	ctx := context.Background()
+
+	acked, lost := uuid.New(), uuid.New()
+	for _, id := range []uuid.UUID{acked, lost} {
+		if err := store.Push(ctx, id, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Pop(ctx, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.Ack(ctx, acked); err != nil {
+		t.Fatal(err)
+	}
+
+	requeued, err := store.Requeue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requeued != 0 {
+		t.Fatalf("requeued %d jobs with a running lease", requeued)
+	}
+
+	time.Sleep(store.lease)
+
+	requeued, err = store.Requeue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requeued != 1 {
+		t.Fatalf("requeued %d jobs, want 1", requeued)
+	}
+
+	id, err := store.Pop(ctx, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != lost {
+		t.Errorf("popped %s after requeue, want %s", id, lost)
+	}
+
+	if _, err := store.Pop(ctx, 10*time.Millisecond); !errors.Is(err, ErrNoJob) {
+		t.Errorf("acknowledged job was requeued: %v", err)
+	}
+}
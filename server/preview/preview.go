@@ -0,0 +1,159 @@
+// Package preview renders crosshair settings into images.
+//
+// The renderer approximates the classic static crosshair at 1920x1080,
+// it does not simulate dynamic styles while moving or shooting.
+package preview
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+
+	"github.com/devusSs/crosshairs/sharecode"
+)
+
+const (
+	tileSize = 160
+
+	// Scale of one crosshair unit in pixels.
+	unitScale = 2
+	// The game adds this amount of pixels to the configured gap.
+	gapOffset = 4
+)
+
+// Background describes a map-like backdrop the crosshair is drawn on.
+type Background struct {
+	Name   string
+	Sky    color.RGBA
+	Wall   color.RGBA
+	Ground color.RGBA
+}
+
+// Backgrounds the previews are rendered on, from left to right.
+var Backgrounds = []Background{
+	{"dust2", color.RGBA{168, 196, 220, 255}, color.RGBA{196, 164, 116, 255}, color.RGBA{170, 140, 96, 255}},
+	{"mirage", color.RGBA{188, 206, 224, 255}, color.RGBA{214, 196, 160, 255}, color.RGBA{128, 112, 92, 255}},
+	{"nuke", color.RGBA{146, 166, 186, 255}, color.RGBA{108, 116, 124, 255}, color.RGBA{70, 74, 78, 255}},
+	{"inferno", color.RGBA{226, 196, 150, 255}, color.RGBA{176, 96, 64, 255}, color.RGBA{112, 88, 66, 255}},
+}
+
+// Render draws the crosshair once on every background next to each other.
+func Render(settings *sharecode.Settings) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, tileSize*len(Backgrounds), tileSize))
+
+	for i, background := range Backgrounds {
+		tile := image.Rect(i*tileSize, 0, (i+1)*tileSize, tileSize)
+		drawBackground(img, tile, background)
+		drawCrosshair(img, tile, settings)
+	}
+
+	return img
+}
+
+// RenderPNG renders the crosshair and encodes it as PNG.
+func RenderPNG(settings *sharecode.Settings) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, Render(settings)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func drawBackground(img *image.RGBA, tile image.Rectangle, background Background) {
+	horizon := tile.Min.Y + tile.Dy()*2/5
+	floor := tile.Min.Y + tile.Dy()*3/4
+
+	draw.Draw(img, image.Rect(tile.Min.X, tile.Min.Y, tile.Max.X, horizon), &image.Uniform{background.Sky}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(tile.Min.X, horizon, tile.Max.X, floor), &image.Uniform{background.Wall}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(tile.Min.X, floor, tile.Max.X, tile.Max.Y), &image.Uniform{background.Ground}, image.Point{}, draw.Src)
+
+	// Some darker bricks on the wall so the crosshair can be judged against texture as well.
+	brick := shade(background.Wall, 0.85)
+	for y := horizon; y < floor; y += 12 {
+		offset := 0
+		if (y-horizon)/12%2 == 1 {
+			offset = 12
+		}
+
+		for x := tile.Min.X + offset; x < tile.Max.X; x += 24 {
+			draw.Draw(img, image.Rect(x, y, minInt(x+22, tile.Max.X), minInt(y+10, floor)), &image.Uniform{brick}, image.Point{}, draw.Src)
+		}
+	}
+}
+
+func drawCrosshair(img *image.RGBA, tile image.Rectangle, s *sharecode.Settings) {
+	red, green, blue := s.RGB()
+	crosshairColor := color.RGBA{uint8(red), uint8(green), uint8(blue), 255}
+
+	alpha := uint8(255)
+	if s.UseAlpha {
+		alpha = uint8(s.Alpha)
+	}
+
+	centerX := tile.Min.X + tile.Dx()/2
+	centerY := tile.Min.Y + tile.Dy()/2
+
+	thickness := int(math.Max(1, math.Round(s.Thickness*unitScale)))
+	length := int(math.Round(s.Size * unitScale))
+	gap := int(math.Round(s.Gap)) + gapOffset
+	outline := int(math.Ceil(s.OutlineThickness))
+
+	// Offsets to center odd and even thicknesses around the middle pixel.
+	low := thickness / 2
+	high := thickness - low
+
+	var arms []image.Rectangle
+
+	if length > 0 {
+		arms = append(arms,
+			image.Rect(centerX+gap, centerY-low, centerX+gap+length, centerY+high), // right
+			image.Rect(centerX-gap-length, centerY-low, centerX-gap, centerY+high), // left
+			image.Rect(centerX-low, centerY+gap, centerX+high, centerY+gap+length), // bottom
+		)
+
+		if !s.TStyle {
+			arms = append(arms, image.Rect(centerX-low, centerY-gap-length, centerX+high, centerY-gap)) // top
+		}
+	}
+
+	if s.Dot {
+		arms = append(arms, image.Rect(centerX-low, centerY-low, centerX+high, centerY+high))
+	}
+
+	if s.DrawOutline && outline > 0 {
+		outlineColor := color.RGBA{0, 0, 0, 255}
+		for _, arm := range arms {
+			fill(img, tile, arm.Inset(-outline), outlineColor, alpha)
+		}
+	}
+
+	for _, arm := range arms {
+		fill(img, tile, arm, crosshairColor, alpha)
+	}
+}
+
+func fill(img *image.RGBA, tile, rect image.Rectangle, c color.RGBA, alpha uint8) {
+	mask := image.NewUniform(color.Alpha{alpha})
+	draw.DrawMask(img, rect.Intersect(tile), &image.Uniform{c}, image.Point{}, mask, image.Point{}, draw.Over)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func shade(c color.RGBA, factor float64) color.RGBA {
+	return color.RGBA{
+		uint8(float64(c.R) * factor),
+		uint8(float64(c.G) * factor),
+		uint8(float64(c.B) * factor),
+		c.A,
+	}
+}
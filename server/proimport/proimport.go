@@ -0,0 +1,276 @@
+// Package proimport imports pro players and their crosshairs from JSON or CSV files.
+//
+// JSON files contain an array of players:
+//
+//	[{"name": "s1mple", "team": "NAVI", "source": "https://...", "last_verified": "2023-05-01",
+//	  "crosshairs": [{"code": "CSGO-...", "note": "main"}]}]
+//
+// CSV files need a header row with at least the name and code columns, every other row
+// holds one crosshair: name,team,source,last_verified,code,note
+package proimport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/sharecode"
+)
+
+// Accepted formats of the last_verified field, empty means now.
+var dateLayouts = []string{"2006-01-02", time.RFC3339}
+
+// Row is one crosshair of a player as read from the import file.
+type Row struct {
+	// Position in the file, e.g. "line 3" or "players[1].crosshairs[0]".
+	Position     string
+	Name         string
+	Team         string
+	Source       string
+	LastVerified string
+	Code         string
+	Note         string
+}
+
+type RowError struct {
+	Position string
+	Player   string
+	Code     string
+	Err      error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("%s (%s, %s): %s", e.Position, e.Player, e.Code, e.Err.Error())
+}
+
+type Report struct {
+	PlayersCreated     int
+	PlayersUpdated     int
+	CrosshairsImported int
+	Errors             []RowError
+}
+
+type jsonPlayer struct {
+	Name         string `json:"name"`
+	Team         string `json:"team"`
+	Source       string `json:"source"`
+	LastVerified string `json:"last_verified"`
+	Crosshairs   []struct {
+		Code string `json:"code"`
+		Note string `json:"note"`
+	} `json:"crosshairs"`
+}
+
+// Reads the rows of a .json or .csv file.
+func ReadFile(path string) ([]Row, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return ReadJSON(file)
+	case ".csv":
+		return ReadCSV(file)
+	default:
+		return nil, errors.New("unsupported file type, want .json or .csv")
+	}
+}
+
+func ReadJSON(r io.Reader) ([]Row, error) {
+	var players []jsonPlayer
+	if err := json.NewDecoder(r).Decode(&players); err != nil {
+		return nil, err
+	}
+
+	var rows []Row
+	for i, player := range players {
+		// Players without crosshairs still get a row so they show up in the report.
+		if len(player.Crosshairs) == 0 {
+			rows = append(rows, Row{
+				Position:     fmt.Sprintf("players[%d]", i),
+				Name:         player.Name,
+				Team:         player.Team,
+				Source:       player.Source,
+				LastVerified: player.LastVerified,
+			})
+			continue
+		}
+
+		for j, ch := range player.Crosshairs {
+			rows = append(rows, Row{
+				Position:     fmt.Sprintf("players[%d].crosshairs[%d]", i, j),
+				Name:         player.Name,
+				Team:         player.Team,
+				Source:       player.Source,
+				LastVerified: player.LastVerified,
+				Code:         ch.Code,
+				Note:         ch.Note,
+			})
+		}
+	}
+
+	return rows, nil
+}
+
+func ReadCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, required := range []string{"name", "code"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing %s column in header", required)
+		}
+	}
+
+	var rows []Row
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line++
+
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		rows = append(rows, Row{
+			Position:     fmt.Sprintf("line %d", line),
+			Name:         field("name"),
+			Team:         field("team"),
+			Source:       field("source"),
+			LastVerified: field("last_verified"),
+			Code:         field("code"),
+			Note:         field("note"),
+		})
+	}
+
+	return rows, nil
+}
+
+// Validates the rows and creates or updates the players they belong to.
+//
+// Players are matched by name, the crosshairs of existing players are replaced
+// with the valid ones from the file. Invalid rows are skipped and reported,
+// players without any valid crosshair are not touched.
+func Import(svc database.Service, rows []Row) (*Report, error) {
+	report := &Report{}
+
+	var order []string
+	players := make(map[string]*database.ProPlayer)
+
+	for _, row := range rows {
+		player, err := validateRow(row)
+		if err != nil {
+			report.Errors = append(report.Errors, RowError{row.Position, row.Name, row.Code, err})
+			continue
+		}
+
+		key := strings.ToLower(player.Name)
+		existing, ok := players[key]
+		if !ok {
+			order = append(order, key)
+			players[key] = player
+			continue
+		}
+
+		existing.Crosshairs = append(existing.Crosshairs, player.Crosshairs...)
+	}
+
+	for _, key := range order {
+		player := players[key]
+
+		stored, err := svc.GetProPlayerByName(player.Name)
+		if err != nil && !database.IsNotFoundError(err) {
+			return report, err
+		}
+
+		if err == nil {
+			player.ID = stored.ID
+			if _, err := svc.UpdateProPlayer(player); err != nil {
+				return report, err
+			}
+			report.PlayersUpdated++
+		} else {
+			if _, err := svc.AddProPlayer(player); err != nil {
+				return report, err
+			}
+			report.PlayersCreated++
+		}
+
+		report.CrosshairsImported += len(player.Crosshairs)
+	}
+
+	return report, nil
+}
+
+func validateRow(row Row) (*database.ProPlayer, error) {
+	if row.Name == "" {
+		return nil, errors.New("missing player name")
+	}
+
+	if row.Code == "" {
+		return nil, errors.New("missing crosshair code")
+	}
+
+	settings, err := sharecode.Decode(row.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	lastVerified := time.Now()
+	if row.LastVerified != "" {
+		lastVerified, err = parseDate(row.LastVerified)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &database.ProPlayer{
+		Name:         row.Name,
+		Team:         row.Team,
+		Source:       row.Source,
+		LastVerified: lastVerified,
+		Crosshairs: []database.ProCrosshair{
+			{Code: row.Code, Note: row.Note, Settings: *settings},
+		},
+	}, nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid last_verified date %q, want YYYY-MM-DD", value)
+}
@@ -0,0 +1,213 @@
+package proimport
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devusSs/crosshairs/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	codeMain = "CSGO-O4Jsi-V36wY-rTMGK-9w7qF-jQ8WB"
+	codeAWP  = "CSGO-6G2cS-WzcxT-fH3dp-Rf7oq-X9oJN"
+)
+
+func TestReadJSON(t *testing.T) {
+	input := `[
+		{"name": "s1mple", "team": "NAVI", "source": "https://example.com", "last_verified": "2023-05-01",
+		 "crosshairs": [{"code": "` + codeMain + `", "note": "main"}, {"code": "` + codeAWP + `"}]},
+		{"name": "bench"}
+	]`
+
+	rows, err := ReadJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Row{
+		{Position: "players[0].crosshairs[0]", Name: "s1mple", Team: "NAVI", Source: "https://example.com", LastVerified: "2023-05-01", Code: codeMain, Note: "main"},
+		{Position: "players[0].crosshairs[1]", Name: "s1mple", Team: "NAVI", Source: "https://example.com", LastVerified: "2023-05-01", Code: codeAWP},
+		{Position: "players[1]", Name: "bench"},
+	}
+
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("ReadJSON = %+v, want %+v", rows, want)
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	input := "Code, Name,note\n" + codeMain + ", s1mple ,main\n" + codeAWP + ",s1mple\n"
+
+	rows, err := ReadCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Row{
+		{Position: "line 2", Name: "s1mple", Code: codeMain, Note: "main"},
+		{Position: "line 3", Name: "s1mple", Code: codeAWP},
+	}
+
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("ReadCSV = %+v, want %+v", rows, want)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		read func() ([]Row, error)
+	}{
+		{"json object", func() ([]Row, error) { return ReadJSON(strings.NewReader(`{"name": "s1mple"}`)) }},
+		{"csv without name column", func() ([]Row, error) { return ReadCSV(strings.NewReader("code\n" + codeMain)) }},
+		{"csv without code column", func() ([]Row, error) { return ReadCSV(strings.NewReader("name\ns1mple")) }},
+		{"csv empty", func() ([]Row, error) { return ReadCSV(strings.NewReader("")) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.read(); err == nil {
+				t.Error("invalid file was accepted")
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"players.json": `[{"name": "s1mple", "crosshairs": [{"code": "` + codeMain + `"}]}]`,
+		"players.CSV":  "name,code\ns1mple," + codeMain + "\n",
+		"players.txt":  codeMain,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"players.json", "players.CSV"} {
+		rows, err := ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("ReadFile(%s): %s", name, err)
+			continue
+		}
+		if len(rows) != 1 || rows[0].Name != "s1mple" || rows[0].Code != codeMain {
+			t.Errorf("ReadFile(%s) = %+v", name, rows)
+		}
+	}
+
+	if _, err := ReadFile(filepath.Join(dir, "players.txt")); err == nil {
+		t.Error("ReadFile accepted a .txt file")
+	}
+}
+
+func TestValidateRow(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     Row
+		wantErr bool
+	}{
+		{"valid", Row{Name: "s1mple", Code: codeMain, LastVerified: "2023-05-01"}, false},
+		{"rfc3339 date", Row{Name: "s1mple", Code: codeMain, LastVerified: "2023-05-01T12:00:00Z"}, false},
+		{"no date", Row{Name: "s1mple", Code: codeMain}, false},
+		{"missing name", Row{Code: codeMain}, true},
+		{"missing code", Row{Name: "s1mple"}, true},
+		{"invalid code", Row{Name: "s1mple", Code: "CSGO-P4Jsi-V36wY-rTMGK-9w7qF-jQ8WB"}, true},
+		{"invalid date", Row{Name: "s1mple", Code: codeMain, LastVerified: "01.05.2023"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			player, err := validateRow(tt.row)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateRow returned %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(player.Crosshairs) != 1 || player.Crosshairs[0].Code != tt.row.Code || player.Crosshairs[0].Settings.Size != 33 {
+				t.Errorf("validateRow returned crosshairs %+v", player.Crosshairs)
+			}
+		})
+	}
+
+	player, _ := validateRow(Row{Name: "s1mple", Code: codeMain, LastVerified: "2023-05-01"})
+	if want := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC); !player.LastVerified.Equal(want) {
+		t.Errorf("last verified is %s, want %s", player.LastVerified, want)
+	}
+}
+
+// Keeps pro players in memory, only implements what Import uses.
+type fakeDB struct {
+	database.Service
+	players map[string]*database.ProPlayer
+}
+
+func (f *fakeDB) GetProPlayerByName(name string) (*database.ProPlayer, error) {
+	player, ok := f.players[strings.ToLower(name)]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return player, nil
+}
+
+func (f *fakeDB) AddProPlayer(player *database.ProPlayer) (*database.ProPlayer, error) {
+	player.ID = uuid.New()
+	f.players[strings.ToLower(player.Name)] = player
+	return player, nil
+}
+
+func (f *fakeDB) UpdateProPlayer(player *database.ProPlayer) (*database.ProPlayer, error) {
+	f.players[strings.ToLower(player.Name)] = player
+	return player, nil
+}
+
+func TestImport(t *testing.T) {
+	existingID := uuid.New()
+	db := &fakeDB{players: map[string]*database.ProPlayer{
+		"zywoo": {ID: existingID, Name: "ZywOo", Crosshairs: []database.ProCrosshair{{Code: codeAWP}}},
+	}}
+
+	rows := []Row{
+		{Position: "line 2", Name: "s1mple", Code: codeMain, Note: "main"},
+		{Position: "line 3", Name: "S1MPLE", Code: codeAWP},
+		{Position: "line 4", Name: "zywoo", Code: codeMain},
+		{Position: "line 5", Name: "zywoo", Code: "CSGO-invalid"},
+		{Position: "line 6", Name: "bench"},
+	}
+
+	report, err := Import(db, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.PlayersCreated != 1 || report.PlayersUpdated != 1 || report.CrosshairsImported != 3 {
+		t.Errorf("report is %+v", report)
+	}
+
+	if len(report.Errors) != 2 || report.Errors[0].Position != "line 5" || report.Errors[1].Position != "line 6" {
+		t.Errorf("report errors are %+v", report.Errors)
+	}
+
+	if player := db.players["s1mple"]; player == nil || len(player.Crosshairs) != 2 {
+		t.Errorf("s1mple was stored as %+v", player)
+	}
+
+	zywoo := db.players["zywoo"]
+	if zywoo.ID != existingID || len(zywoo.Crosshairs) != 1 || zywoo.Crosshairs[0].Code != codeMain {
+		t.Errorf("crosshairs of existing player were not replaced: %+v", zywoo)
+	}
+
+	if _, ok := db.players["bench"]; ok {
+		t.Error("player without valid crosshairs was created")
+	}
+}
@@ -0,0 +1,156 @@
+// Package retention anonymises IPs and deletes logs once they are older than configured.
+//
+// The policy is applied on a schedule by the server and once with the -retention flag.
+// Whatever got anonymised or deleted is recorded as database.RetentionPurged event.
+// Audit logs are never touched, they are immutable.
+package retention
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/devusSs/crosshairs/config"
+	"github.com/devusSs/crosshairs/database"
+)
+
+type IPMode string
+
+const (
+	// Keeps the network of an IP, the last octet of IPv4 and everything after the /48 of IPv6 are zeroed.
+	IPModeTruncate IPMode = "truncate"
+	// Replaces an IP with a keyed hash, requests of the same IP can still be matched.
+	IPModeHash IPMode = "hash"
+)
+
+// Prefix of hashed IPs, used to not hash them again.
+const hashPrefix = "sha256:"
+
+type Policy struct {
+	// Days after which data is anonymised or deleted, 0 keeps it forever.
+	IPDays         int
+	TwitchLogsDays int
+	EventsDays     int
+
+	IPMode IPMode
+	// Key of the HMAC used by IPModeHash.
+	IPHashKey string
+}
+
+// PolicyFromConfig returns the policy of the config, IPs are hashed with the sessions key.
+func PolicyFromConfig(cfg *config.Config) Policy {
+	policy := Policy{
+		IPDays:         cfg.RetentionIPDays,
+		TwitchLogsDays: cfg.RetentionTwitchLogsDays,
+		EventsDays:     cfg.RetentionEventsDays,
+		IPMode:         IPMode(cfg.RetentionIPMode),
+		IPHashKey:      cfg.SecretSessionsKey,
+	}
+
+	if policy.IPMode == "" {
+		policy.IPMode = IPModeTruncate
+	}
+
+	return policy
+}
+
+// Enabled reports whether anything is ever anonymised or deleted.
+func (p Policy) Enabled() bool {
+	return p.IPDays > 0 || p.TwitchLogsDays > 0 || p.EventsDays > 0
+}
+
+// Run applies the policy once and returns what was purged, it is recorded as event if it is anything.
+func Run(svc database.Service, policy Policy) (*database.RetentionPayload, error) {
+	now := time.Now()
+	report := &database.RetentionPayload{}
+
+	if policy.IPDays > 0 {
+		anonymised, err := svc.AnonymiseIPs(daysBefore(now, policy.IPDays), policy.anonymiser())
+		if err != nil {
+			return nil, err
+		}
+		report.AnonymisedIPs = *anonymised
+	}
+
+	if policy.TwitchLogsDays > 0 {
+		deleted, err := svc.DeleteTwitchBotLogsBefore(daysBefore(now, policy.TwitchLogsDays))
+		if err != nil {
+			return nil, err
+		}
+		report.TwitchBotLogsDeleted = deleted
+	}
+
+	if policy.EventsDays > 0 {
+		deleted, err := svc.DeleteEventsBefore(daysBefore(now, policy.EventsDays))
+		if err != nil {
+			return nil, err
+		}
+		report.EventsDeleted = deleted
+	}
+
+	// Recorded last so it is not deleted right away.
+	if report.Total() > 0 {
+		if _, err := svc.AddEvent(database.NewEvent(database.RetentionPurged, nil, report)); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+func (p Policy) anonymiser() func(string) string {
+	if p.IPMode == IPModeHash {
+		return func(ip string) string {
+			return anonymiseList(ip, func(single string) string { return HashIP(p.IPHashKey, single) })
+		}
+	}
+
+	return func(ip string) string {
+		return anonymiseList(ip, TruncateIP)
+	}
+}
+
+// Stored IPs may be X-Forwarded-For headers holding a comma separated list.
+func anonymiseList(ips string, anonymise func(string) string) string {
+	var anonymised []string
+
+	for _, ip := range strings.Split(ips, ",") {
+		if ip = anonymise(strings.TrimSpace(ip)); ip != "" {
+			anonymised = append(anonymised, ip)
+		}
+	}
+
+	return strings.Join(anonymised, ", ")
+}
+
+// TruncateIP zeroes the host part of the IP, it returns an empty string for invalid IPs.
+func TruncateIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// HashIP returns the keyed hash of the IP, hashed IPs are returned unchanged.
+func HashIP(key, ip string) string {
+	if ip == "" || strings.HasPrefix(ip, hashPrefix) {
+		return ip
+	}
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(ip))
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func daysBefore(now time.Time, days int) time.Time {
+	return now.AddDate(0, 0, -days)
+}
@@ -0,0 +1,256 @@
+package sharecode
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var ErrNoCrosshairCommands = errors.New("no crosshair commands found")
+
+// DefaultSettings returns the game's default crosshair settings.
+//
+// Used as a base when parsing configs which only set some of the crosshair commands.
+func DefaultSettings() *Settings {
+	return &Settings{
+		Style:            2,
+		Size:             5,
+		Thickness:        0.5,
+		Gap:              1,
+		FixedGap:         3,
+		DrawOutline:      true,
+		OutlineThickness: 1,
+		Dot:              true,
+		Color:            1,
+		Red:              50,
+		Green:            250,
+		Blue:             50,
+		UseAlpha:         true,
+		Alpha:            200,
+		SplitDistance:    7,
+		InnerSplitAlpha:  1,
+		OuterSplitAlpha:  0.5,
+		SplitSizeRatio:   0.3,
+	}
+}
+
+// Config returns a block of console commands which can be pasted into a cfg file like autoexec.cfg.
+//
+// The title becomes a comment on the first line, line breaks in it are removed.
+func (s *Settings) Config(title string) string {
+	var cfg strings.Builder
+
+	if title != "" {
+		cfg.WriteString(fmt.Sprintf("// %s\n", commentText(title)))
+	}
+
+	for _, command := range s.Commands() {
+		cfg.WriteString(command)
+		cfg.WriteString("\n")
+	}
+
+	return cfg.String()
+}
+
+// CycleEntry is one crosshair of a CycleConfig.
+type CycleEntry struct {
+	Name     string
+	Settings *Settings
+}
+
+// CycleConfig returns a cfg which binds key to switch to the next of the crosshairs on every press.
+//
+// Every crosshair becomes an alias named after prefix and its position, starting at 1. After the last
+// crosshair the bind starts over with the first one. The config itself applies the first crosshair.
+// Like with Config the title becomes a comment on the first line.
+func CycleConfig(title, prefix, key string, entries []CycleEntry) string {
+	var cfg strings.Builder
+
+	if title != "" {
+		cfg.WriteString(fmt.Sprintf("// %s\n", commentText(title)))
+	}
+
+	for i, entry := range entries {
+		next := i + 2
+		if next > len(entries) {
+			next = 1
+		}
+
+		commands := append(entry.Settings.Commands(),
+			fmt.Sprintf("alias %s_next %s_%d", prefix, prefix, next),
+			fmt.Sprintf("echo Crosshair %d/%d - %s", i+1, len(entries), consoleText(entry.Name)),
+		)
+
+		cfg.WriteString(fmt.Sprintf("alias \"%s_%d\" \"%s\"\n", prefix, i+1, strings.Join(commands, "; ")))
+	}
+
+	if len(entries) > 0 {
+		cfg.WriteString(fmt.Sprintf("%s_1\n", prefix))
+	}
+
+	cfg.WriteString(fmt.Sprintf("bind \"%s\" \"%s_next\"\n", key, prefix))
+
+	return cfg.String()
+}
+
+// Removes characters which would end the quoted alias or the command early.
+func consoleText(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '"', ';':
+			return ' '
+		}
+		return r
+	}, commentText(text))
+}
+
+// Removes line breaks and other control characters which would end the comment early,
+// everything after them would be run as commands.
+func commentText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '\u2028' || r == '\u2029' {
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+// ParseCommands reads crosshair console commands (e.g. from an autoexec.cfg) into settings.
+//
+// Commands unrelated to the crosshair (binds, other convars, comments) are ignored.
+// Settings missing in the config keep the game's default value.
+func ParseCommands(cfg string) (*Settings, error) {
+	settings := DefaultSettings()
+	found := 0
+
+	scanner := bufio.NewScanner(strings.NewReader(cfg))
+
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		text := scanner.Text()
+
+		if index := strings.Index(text, "//"); index >= 0 {
+			text = text[:index]
+		}
+
+		for _, command := range splitCommands(text) {
+			fields := strings.Fields(strings.ReplaceAll(command, `"`, " "))
+			if len(fields) < 2 {
+				continue
+			}
+
+			name := strings.ToLower(fields[0])
+
+			setter, ok := commandSetters[name]
+			if !ok {
+				continue
+			}
+
+			if err := setter(settings, fields[1]); err != nil {
+				return nil, fmt.Errorf("line %d: invalid value %q for %s", line, fields[1], name)
+			}
+
+			found++
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if found == 0 {
+		return nil, ErrNoCrosshairCommands
+	}
+
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// Splits a line into its commands while keeping semicolons inside quotes (e.g. alias bodies) intact.
+func splitCommands(line string) []string {
+	var commands []string
+
+	quoted := false
+	start := 0
+
+	for i, char := range line {
+		switch char {
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				commands = append(commands, line[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(commands, line[start:])
+}
+
+var commandSetters = map[string]func(s *Settings, value string) error{
+	"cl_crosshairstyle":                        intSetter(func(s *Settings) *int { return &s.Style }),
+	"cl_crosshairsize":                         floatSetter(func(s *Settings) *float64 { return &s.Size }),
+	"cl_crosshairthickness":                    floatSetter(func(s *Settings) *float64 { return &s.Thickness }),
+	"cl_crosshairgap":                          floatSetter(func(s *Settings) *float64 { return &s.Gap }),
+	"cl_fixedcrosshairgap":                     floatSetter(func(s *Settings) *float64 { return &s.FixedGap }),
+	"cl_crosshair_drawoutline":                 boolSetter(func(s *Settings) *bool { return &s.DrawOutline }),
+	"cl_crosshair_outlinethickness":            floatSetter(func(s *Settings) *float64 { return &s.OutlineThickness }),
+	"cl_crosshairdot":                          boolSetter(func(s *Settings) *bool { return &s.Dot }),
+	"cl_crosshaircolor":                        intSetter(func(s *Settings) *int { return &s.Color }),
+	"cl_crosshaircolor_r":                      intSetter(func(s *Settings) *int { return &s.Red }),
+	"cl_crosshaircolor_g":                      intSetter(func(s *Settings) *int { return &s.Green }),
+	"cl_crosshaircolor_b":                      intSetter(func(s *Settings) *int { return &s.Blue }),
+	"cl_crosshairusealpha":                     boolSetter(func(s *Settings) *bool { return &s.UseAlpha }),
+	"cl_crosshairalpha":                        intSetter(func(s *Settings) *int { return &s.Alpha }),
+	"cl_crosshair_t":                           boolSetter(func(s *Settings) *bool { return &s.TStyle }),
+	"cl_crosshairgap_useweaponvalue":           boolSetter(func(s *Settings) *bool { return &s.GapUseWeaponValue }),
+	"cl_crosshair_recoil":                      boolSetter(func(s *Settings) *bool { return &s.FollowRecoil }),
+	"cl_crosshair_dynamic_splitdist":           intSetter(func(s *Settings) *int { return &s.SplitDistance }),
+	"cl_crosshair_dynamic_splitalpha_innermod": floatSetter(func(s *Settings) *float64 { return &s.InnerSplitAlpha }),
+	"cl_crosshair_dynamic_splitalpha_outermod": floatSetter(func(s *Settings) *float64 { return &s.OuterSplitAlpha }),
+	"cl_crosshair_dynamic_maxdist_splitratio":  floatSetter(func(s *Settings) *float64 { return &s.SplitSizeRatio }),
+}
+
+func intSetter(field func(s *Settings) *int) func(s *Settings, value string) error {
+	return func(s *Settings, value string) error {
+		// The game accepts floats for integer convars and truncates them.
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*field(s) = int(parsed)
+		return nil
+	}
+}
+
+func floatSetter(field func(s *Settings) *float64) func(s *Settings, value string) error {
+	return func(s *Settings, value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*field(s) = parsed
+		return nil
+	}
+}
+
+func boolSetter(field func(s *Settings) *bool) func(s *Settings, value string) error {
+	return func(s *Settings, value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*field(s) = parsed != 0
+		return nil
+	}
+}
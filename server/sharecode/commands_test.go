@@ -0,0 +1,187 @@
+package sharecode
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCommands(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    string
+		modify func(s *Settings)
+	}{
+		{
+			name: "single commands",
+			cfg:  "cl_crosshairstyle 4\ncl_crosshairsize 2.5\ncl_crosshairdot 0",
+			modify: func(s *Settings) {
+				s.Style = 4
+				s.Size = 2.5
+				s.Dot = false
+			},
+		},
+		{
+			name:   "quoted values and mixed case",
+			cfg:    `CL_CrosshairGap "-3"`,
+			modify: func(s *Settings) { s.Gap = -3 },
+		},
+		{
+			name: "semicolons and comments",
+			cfg:  "cl_crosshaircolor 5; cl_crosshaircolor_r 10 // cl_crosshaircolor_g 20\n// cl_crosshairalpha 10",
+			modify: func(s *Settings) {
+				s.Color = 5
+				s.Red = 10
+			},
+		},
+		{
+			name: "unrelated binds and convars",
+			cfg: strings.Join([]string{
+				"bind mouse4 +jump",
+				`bind "f" "cl_crosshairsize 100; +lookatweapon"`,
+				`alias "+jumpthrow" "+jump; -attack"`,
+				"sensitivity 2",
+				"cl_crosshairthickness 1",
+			}, "\n"),
+			modify: func(s *Settings) { s.Thickness = 1 },
+		},
+		{
+			name:   "integer convar with float value",
+			cfg:    "cl_crosshairalpha 254.9",
+			modify: func(s *Settings) { s.Alpha = 254 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCommands(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := DefaultSettings()
+			tt.modify(want)
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseCommands(%q) = %+v, want %+v", tt.cfg, *got, *want)
+			}
+		})
+	}
+}
+
+func TestParseCommandsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  string
+		want error
+	}{
+		{"empty", "", ErrNoCrosshairCommands},
+		{"only binds", "bind mouse4 +jump\nsensitivity 2", ErrNoCrosshairCommands},
+		{"only commented out", "// cl_crosshairsize 2", ErrNoCrosshairCommands},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCommands(tt.cfg); !errors.Is(err, tt.want) {
+				t.Errorf("ParseCommands(%q) returned %v, want %v", tt.cfg, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseCommands("cl_crosshairsize big"); err == nil {
+		t.Error("ParseCommands accepted a value which is no number")
+	}
+	if _, err := ParseCommands("cl_crosshairstyle 9"); err == nil {
+		t.Error("ParseCommands accepted an out of range value")
+	}
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	settings, err := Decode("CSGO-O4Jsi-V36wY-rTMGK-9w7qF-jQ8WB")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseCommands(settings.Config("main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(parsed, settings) {
+		t.Errorf("parsed config = %+v, want %+v", *parsed, *settings)
+	}
+}
+
+// Everything but the first line of the title comment would be run by the game.
+func TestConfigTitleCanNotBreakOut(t *testing.T) {
+	titles := []string{
+		"main\nquit",
+		"main\r\nquit",
+		"main\rquit",
+		"main\u2028quit",
+		"main\u0085quit",
+	}
+
+	for _, title := range titles {
+		cfg := DefaultSettings().Config(title)
+		first, rest, _ := strings.Cut(cfg, "\n")
+
+		if !strings.HasPrefix(first, "// ") || !strings.Contains(first, "quit") {
+			t.Errorf("title %q not kept in the comment: %q", title, first)
+		}
+		if strings.Contains(rest, "quit") {
+			t.Errorf("title %q ended the comment: %q", title, cfg)
+		}
+	}
+}
+
+func TestCycleConfig(t *testing.T) {
+	entries := []CycleEntry{
+		{Name: "main", Settings: DefaultSettings()},
+		{Name: "awp", Settings: DefaultSettings()},
+	}
+
+	cfg := CycleConfig("cycle", "ch", "f", entries)
+	lines := strings.Split(strings.TrimSuffix(cfg, "\n"), "\n")
+
+	if len(lines) != 5 {
+		t.Fatalf("got %d lines, want 5:\n%s", len(lines), cfg)
+	}
+	if lines[0] != "// cycle" {
+		t.Errorf("first line is %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], `alias "ch_1" "`) || !strings.Contains(lines[1], "alias ch_next ch_2; echo Crosshair 1/2 - main") {
+		t.Errorf("first alias is %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "alias ch_next ch_1; echo Crosshair 2/2 - awp") {
+		t.Errorf("last alias does not start over: %q", lines[2])
+	}
+	if lines[3] != "ch_1" || lines[4] != `bind "f" "ch_next"` {
+		t.Errorf("config ends with %q and %q", lines[3], lines[4])
+	}
+}
+
+// Names end up inside the quoted alias, quotes or semicolons in them would run the rest as commands.
+func TestCycleConfigNameCanNotBreakOut(t *testing.T) {
+	names := []string{
+		`main"; quit; "`,
+		"main; quit",
+		"main\nquit",
+	}
+
+	for _, name := range names {
+		cfg := CycleConfig("", "ch", "f", []CycleEntry{{Name: name, Settings: DefaultSettings()}})
+		alias, _, _ := strings.Cut(cfg, "\n")
+
+		body := strings.TrimSuffix(strings.TrimPrefix(alias, `alias "ch_1" "`), `"`)
+		if strings.Contains(body, `"`) {
+			t.Errorf("name %q ended the alias: %q", name, alias)
+		}
+
+		commands := splitCommands(body)
+		if last := strings.TrimSpace(commands[len(commands)-1]); !strings.HasPrefix(last, "echo ") || !strings.Contains(last, "quit") {
+			t.Errorf("name %q is not part of the echo: %q", name, last)
+		}
+	}
+}
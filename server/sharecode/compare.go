@@ -0,0 +1,110 @@
+package sharecode
+
+import (
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Preset colors of cl_crosshaircolor 0 to 4, 5 uses the custom RGB values.
+var presetColors = [][3]int{
+	{250, 50, 50},
+	{50, 250, 50},
+	{250, 250, 50},
+	{50, 50, 250},
+	{50, 250, 250},
+}
+
+// RGB returns the color the crosshair is drawn in, resolving the preset colors.
+func (s *Settings) RGB() (red, green, blue int) {
+	if s.Color >= 0 && s.Color < len(presetColors) {
+		preset := presetColors[s.Color]
+		return preset[0], preset[1], preset[2]
+	}
+	return s.Red, s.Green, s.Blue
+}
+
+// Difference is a setting which differs between two crosshairs.
+type Difference struct {
+	// JSON name of the setting, e.g. "size".
+	Field string
+	A     interface{}
+	B     interface{}
+}
+
+// Diff returns all settings which differ between a and b in the order of the Settings fields.
+func Diff(a, b *Settings) []Difference {
+	var diffs []Difference
+
+	valueA := reflect.ValueOf(a).Elem()
+	valueB := reflect.ValueOf(b).Elem()
+	fields := valueA.Type()
+
+	for i := 0; i < fields.NumField(); i++ {
+		fieldA := valueA.Field(i).Interface()
+		fieldB := valueB.Field(i).Interface()
+
+		if fieldA == fieldB {
+			continue
+		}
+
+		name := strings.Split(fields.Field(i).Tag.Get("json"), ",")[0]
+		diffs = append(diffs, Difference{Field: name, A: fieldA, B: fieldB})
+	}
+
+	return diffs
+}
+
+// Distance returns how different two crosshairs look, 0 means they look the same.
+//
+// Only settings visible on a static crosshair are weighed, one unit roughly equals
+// a change of 1 in size or gap. Dynamic split settings and recoil are ignored.
+func Distance(a, b *Settings) float64 {
+	distance := math.Abs(a.Size-b.Size) +
+		math.Abs(a.Gap-b.Gap) +
+		2*math.Abs(a.Thickness-b.Thickness)
+
+	if a.Style != b.Style {
+		distance += 1
+	}
+
+	if a.Dot != b.Dot {
+		distance += 1
+	}
+
+	if a.TStyle != b.TStyle {
+		distance += 2
+	}
+
+	if a.DrawOutline != b.DrawOutline {
+		distance += 1
+	} else if a.DrawOutline {
+		distance += math.Abs(a.OutlineThickness - b.OutlineThickness)
+	}
+
+	// Up to 3 for opposite colors.
+	redA, greenA, blueA := a.RGB()
+	redB, greenB, blueB := b.RGB()
+	colorDistance := math.Sqrt(float64(square(redA-redB) + square(greenA-greenB) + square(blueA-blueB)))
+	distance += 3 * colorDistance / math.Sqrt(3*255*255)
+
+	distance += math.Abs(float64(a.effectiveAlpha()-b.effectiveAlpha())) / 255
+
+	return distance
+}
+
+// Similarity maps the distance of two crosshairs to a value between 0 and 1, 1 means they look the same.
+func Similarity(a, b *Settings) float64 {
+	return 1 / (1 + Distance(a, b))
+}
+
+func (s *Settings) effectiveAlpha() int {
+	if s.UseAlpha {
+		return s.Alpha
+	}
+	return 255
+}
+
+func square(value int) int {
+	return value * value
+}
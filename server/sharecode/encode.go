@@ -0,0 +1,152 @@
+package sharecode
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Validate checks whether all settings are within the ranges the game (and the share code format) supports.
+func (s *Settings) Validate() error {
+	intRanges := []struct {
+		name     string
+		value    int
+		min, max int
+	}{
+		{"style", s.Style, 0, 5},
+		{"color", s.Color, 0, 5},
+		{"red", s.Red, 0, 255},
+		{"green", s.Green, 0, 255},
+		{"blue", s.Blue, 0, 255},
+		{"alpha", s.Alpha, 0, 255},
+		{"split_distance", s.SplitDistance, 0, 127},
+	}
+
+	for _, r := range intRanges {
+		if r.value < r.min || r.value > r.max {
+			return fmt.Errorf("%s must be between %d and %d", r.name, r.min, r.max)
+		}
+	}
+
+	floatRanges := []struct {
+		name     string
+		value    float64
+		min, max float64
+	}{
+		{"size", s.Size, 0, 819.1},
+		{"thickness", s.Thickness, 0, 6.3},
+		{"gap", s.Gap, -12.8, 12.7},
+		{"fixed_gap", s.FixedGap, -12.8, 12.7},
+		{"outline_thickness", s.OutlineThickness, 0, 3},
+		{"inner_split_alpha", s.InnerSplitAlpha, 0, 1},
+		{"outer_split_alpha", s.OuterSplitAlpha, 0, 1},
+		{"split_size_ratio", s.SplitSizeRatio, 0, 1},
+	}
+
+	for _, r := range floatRanges {
+		if math.IsNaN(r.value) || r.value < r.min || r.value > r.max {
+			return fmt.Errorf("%s must be between %s and %s", r.name, formatFloat(r.min), formatFloat(r.max))
+		}
+	}
+
+	return nil
+}
+
+// Encode validates the settings and builds the matching share code.
+func Encode(s *Settings) (string, error) {
+	if err := s.Validate(); err != nil {
+		return "", err
+	}
+
+	bytes := settingsToBytes(s)
+	bytes[0] = checksum(bytes)
+
+	value := new(big.Int).SetBytes(bytes)
+	base := big.NewInt(int64(len(dictionary)))
+	digit := new(big.Int)
+
+	var code strings.Builder
+
+	for i := 0; i < codeLength; i++ {
+		value.DivMod(value, base, digit)
+		code.WriteByte(dictionary[digit.Int64()])
+	}
+
+	chars := code.String()
+
+	return fmt.Sprintf("CSGO-%s-%s-%s-%s-%s", chars[0:5], chars[5:10], chars[10:15], chars[15:20], chars[20:25]), nil
+}
+
+func settingsToBytes(s *Settings) []byte {
+	size := tenths(s.Size)
+
+	bytes := make([]byte, bytesLength)
+	bytes[1] = 1
+	bytes[2] = byte(int8(tenths(s.Gap)))
+	bytes[3] = byte(int(math.Round(s.OutlineThickness*2)) & 7)
+	bytes[4] = byte(s.Red)
+	bytes[5] = byte(s.Green)
+	bytes[6] = byte(s.Blue)
+	bytes[7] = byte(s.Alpha)
+	bytes[8] = byte(s.SplitDistance&0x7f) | flag(s.FollowRecoil, 0x80)
+	bytes[9] = byte(int8(tenths(s.FixedGap)))
+	bytes[10] = byte(s.Color&7) | flag(s.DrawOutline, 8) | byte(tenths(s.InnerSplitAlpha)<<4)
+	bytes[11] = byte(tenths(s.OuterSplitAlpha)&0xf) | byte(tenths(s.SplitSizeRatio)<<4)
+	bytes[12] = byte(tenths(s.Thickness) & 0x3f)
+	bytes[13] = byte(s.Style<<1&0xe) | flag(s.Dot, 0x10) | flag(s.GapUseWeaponValue, 0x20) | flag(s.UseAlpha, 0x40) | flag(s.TStyle, 0x80)
+	bytes[14] = byte(size & 0xff)
+	bytes[15] = byte(size >> 8 & 0x1f)
+
+	return bytes
+}
+
+func tenths(value float64) int {
+	return int(math.Round(value * 10))
+}
+
+func flag(set bool, mask byte) byte {
+	if set {
+		return mask
+	}
+	return 0
+}
+
+// Commands returns the console commands which apply the settings in game.
+func (s *Settings) Commands() []string {
+	return []string{
+		fmt.Sprintf("cl_crosshairstyle %d", s.Style),
+		fmt.Sprintf("cl_crosshairsize %s", formatFloat(s.Size)),
+		fmt.Sprintf("cl_crosshairthickness %s", formatFloat(s.Thickness)),
+		fmt.Sprintf("cl_crosshairgap %s", formatFloat(s.Gap)),
+		fmt.Sprintf("cl_fixedcrosshairgap %s", formatFloat(s.FixedGap)),
+		fmt.Sprintf("cl_crosshair_drawoutline %d", boolToInt(s.DrawOutline)),
+		fmt.Sprintf("cl_crosshair_outlinethickness %s", formatFloat(s.OutlineThickness)),
+		fmt.Sprintf("cl_crosshairdot %d", boolToInt(s.Dot)),
+		fmt.Sprintf("cl_crosshaircolor %d", s.Color),
+		fmt.Sprintf("cl_crosshaircolor_r %d", s.Red),
+		fmt.Sprintf("cl_crosshaircolor_g %d", s.Green),
+		fmt.Sprintf("cl_crosshaircolor_b %d", s.Blue),
+		fmt.Sprintf("cl_crosshairusealpha %d", boolToInt(s.UseAlpha)),
+		fmt.Sprintf("cl_crosshairalpha %d", s.Alpha),
+		fmt.Sprintf("cl_crosshair_t %d", boolToInt(s.TStyle)),
+		fmt.Sprintf("cl_crosshairgap_useweaponvalue %d", boolToInt(s.GapUseWeaponValue)),
+		fmt.Sprintf("cl_crosshair_recoil %d", boolToInt(s.FollowRecoil)),
+		fmt.Sprintf("cl_crosshair_dynamic_splitdist %d", s.SplitDistance),
+		fmt.Sprintf("cl_crosshair_dynamic_splitalpha_innermod %s", formatFloat(s.InnerSplitAlpha)),
+		fmt.Sprintf("cl_crosshair_dynamic_splitalpha_outermod %s", formatFloat(s.OuterSplitAlpha)),
+		fmt.Sprintf("cl_crosshair_dynamic_maxdist_splitratio %s", formatFloat(s.SplitSizeRatio)),
+	}
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func boolToInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,146 @@
+// Package sharecode converts Counter-Strike crosshair share codes (CSGO-xxxxx-xxxxx-xxxxx-xxxxx-xxxxx)
+// from and to their actual crosshair settings.
+package sharecode
+
+import (
+	"errors"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Intentionally no 0, 1, I, g and l characters in dictionary.
+	dictionary = "ABCDEFGHJKLMNOPQRSTUVWXYZabcdefhijkmnopqrstuvwxyz23456789"
+
+	codeLength  = 25
+	bytesLength = 18
+
+	pattern = `^CSGO(-[` + dictionary + `]{5}){5}$`
+)
+
+var (
+	ErrInvalidFormat    = errors.New("share code does not match format CSGO-xxxxx-xxxxx-xxxxx-xxxxx-xxxxx")
+	ErrInvalidCharacter = errors.New("share code contains invalid characters")
+	ErrInvalidLength    = errors.New("share code exceeds maximum value")
+	ErrChecksumMismatch = errors.New("share code checksum mismatch")
+
+	sharecodeRegex = regexp.MustCompile(pattern)
+)
+
+// Settings holds the decoded values of a crosshair share code.
+//
+// Field names follow the in-game settings, console names can be found next to each field.
+type Settings struct {
+	Style             int     `json:"style"`                // cl_crosshairstyle
+	Size              float64 `json:"size"`                 // cl_crosshairsize
+	Thickness         float64 `json:"thickness"`            // cl_crosshairthickness
+	Gap               float64 `json:"gap"`                  // cl_crosshairgap
+	FixedGap          float64 `json:"fixed_gap"`            // cl_fixedcrosshairgap
+	DrawOutline       bool    `json:"draw_outline"`         // cl_crosshair_drawoutline
+	OutlineThickness  float64 `json:"outline_thickness"`    // cl_crosshair_outlinethickness
+	Dot               bool    `json:"dot"`                  // cl_crosshairdot
+	Color             int     `json:"color"`                // cl_crosshaircolor
+	Red               int     `json:"red"`                  // cl_crosshaircolor_r
+	Green             int     `json:"green"`                // cl_crosshaircolor_g
+	Blue              int     `json:"blue"`                 // cl_crosshaircolor_b
+	UseAlpha          bool    `json:"use_alpha"`            // cl_crosshairusealpha
+	Alpha             int     `json:"alpha"`                // cl_crosshairalpha
+	TStyle            bool    `json:"t_style"`              // cl_crosshair_t
+	GapUseWeaponValue bool    `json:"gap_use_weapon_value"` // cl_crosshairgap_useweaponvalue
+	FollowRecoil      bool    `json:"follow_recoil"`        // cl_crosshair_recoil
+	SplitDistance     int     `json:"split_distance"`       // cl_crosshair_dynamic_splitdist
+	InnerSplitAlpha   float64 `json:"inner_split_alpha"`    // cl_crosshair_dynamic_splitalpha_innermod
+	OuterSplitAlpha   float64 `json:"outer_split_alpha"`    // cl_crosshair_dynamic_splitalpha_outermod
+	SplitSizeRatio    float64 `json:"split_size_ratio"`     // cl_crosshair_dynamic_maxdist_splitratio
+}
+
+// Decode validates a share code including its checksum and returns the crosshair settings.
+func Decode(code string) (*Settings, error) {
+	bytes, err := codeToBytes(code)
+	if err != nil {
+		return nil, err
+	}
+
+	if checksum(bytes) != bytes[0] {
+		return nil, ErrChecksumMismatch
+	}
+
+	return bytesToSettings(bytes), nil
+}
+
+// IsValid reports whether the share code can be decoded.
+func IsValid(code string) bool {
+	_, err := Decode(code)
+	return err == nil
+}
+
+func codeToBytes(code string) ([]byte, error) {
+	if !strings.HasPrefix(code, "CSGO-") || len(code) != len("CSGO-")+codeLength+4 {
+		return nil, ErrInvalidFormat
+	}
+
+	if !sharecodeRegex.MatchString(code) {
+		return nil, ErrInvalidCharacter
+	}
+
+	chars := []rune(strings.ReplaceAll(strings.TrimPrefix(code, "CSGO-"), "-", ""))
+
+	value := big.NewInt(0)
+	base := big.NewInt(int64(len(dictionary)))
+
+	// The code is stored little endian, the most significant character is the last one.
+	for i := len(chars) - 1; i >= 0; i-- {
+		index := strings.IndexRune(dictionary, chars[i])
+		if index < 0 {
+			return nil, ErrInvalidCharacter
+		}
+
+		value.Mul(value, base)
+		value.Add(value, big.NewInt(int64(index)))
+	}
+
+	raw := value.Bytes()
+	if len(raw) > bytesLength {
+		return nil, ErrInvalidLength
+	}
+
+	bytes := make([]byte, bytesLength)
+	copy(bytes[bytesLength-len(raw):], raw)
+
+	return bytes, nil
+}
+
+func checksum(bytes []byte) byte {
+	var sum int
+	for _, b := range bytes[1:] {
+		sum += int(b)
+	}
+	return byte(sum & 0xff)
+}
+
+func bytesToSettings(bytes []byte) *Settings {
+	return &Settings{
+		Gap:               float64(int8(bytes[2])) / 10,
+		OutlineThickness:  float64(bytes[3]&7) / 2,
+		Red:               int(bytes[4]),
+		Green:             int(bytes[5]),
+		Blue:              int(bytes[6]),
+		Alpha:             int(bytes[7]),
+		SplitDistance:     int(bytes[8] & 0x7f),
+		FollowRecoil:      bytes[8]&0x80 != 0,
+		FixedGap:          float64(int8(bytes[9])) / 10,
+		Color:             int(bytes[10] & 7),
+		DrawOutline:       bytes[10]&8 != 0,
+		InnerSplitAlpha:   float64(bytes[10]>>4) / 10,
+		OuterSplitAlpha:   float64(bytes[11]&0xf) / 10,
+		SplitSizeRatio:    float64(bytes[11]>>4) / 10,
+		Thickness:         float64(bytes[12]&0x3f) / 10,
+		Style:             int(bytes[13]&0xe) >> 1,
+		Dot:               bytes[13]&0x10 != 0,
+		GapUseWeaponValue: bytes[13]&0x20 != 0,
+		UseAlpha:          bytes[13]&0x40 != 0,
+		TStyle:            bytes[13]&0x80 != 0,
+		Size:              float64(int(bytes[15]&0x1f)<<8+int(bytes[14])) / 10,
+	}
+}
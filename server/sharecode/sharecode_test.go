@@ -0,0 +1,121 @@
+package sharecode
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		code string
+		want Settings
+	}{
+		{
+			code: "CSGO-O4Jsi-V36wY-rTMGK-9w7qF-jQ8WB",
+			want: Settings{
+				Style: 2, Size: 33, Thickness: 4.1, Gap: 1, FixedGap: -10, OutlineThickness: 1.5, Dot: true,
+				Color: 5, Red: 50, Green: 250, Blue: 84, Alpha: 200, TStyle: true,
+				SplitDistance: 127, InnerSplitAlpha: 0.6, OuterSplitAlpha: 0.8, SplitSizeRatio: 0.3,
+			},
+		},
+		{
+			code: "CSGO-6G2cS-WzcxT-fH3dp-Rf7oq-X9oJN",
+			want: *DefaultSettings(),
+		},
+		{
+			code: "CSGO-ejaUm-2nJUY-Od9yh-eHhGU-sPZfE",
+			want: Settings{
+				Style: 4, Size: 2, Thickness: 0.5, Gap: -2, FixedGap: 3, OutlineThickness: 1,
+				Color: 5, Red: 0, Green: 255, Blue: 255, UseAlpha: true, Alpha: 255,
+				SplitDistance: 3, InnerSplitAlpha: 1, OuterSplitAlpha: 0.5, SplitSizeRatio: 0.3,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			got, err := Decode(tt.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("Decode(%q) = %+v, want %+v", tt.code, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want error
+	}{
+		{"empty", "", ErrInvalidFormat},
+		{"missing prefix", "O4Jsi-V36wY-rTMGK-9w7qF-jQ8WB", ErrInvalidFormat},
+		{"too short", "CSGO-O4Jsi-V36wY-rTMGK-9w7qF-jQ8W", ErrInvalidFormat},
+		{"character not in dictionary", "CSGO-04Jsi-V36wY-rTMGK-9w7qF-jQ8WB", ErrInvalidCharacter},
+		{"lowercase l", "CSGO-O4Jsl-V36wY-rTMGK-9w7qF-jQ8WB", ErrInvalidCharacter},
+		{"misplaced dash", "CSGO-O4Jsi-V36wYr-TMGK-9w7qF-jQ8WB", ErrInvalidCharacter},
+		{"bad checksum", "CSGO-P4Jsi-V36wY-rTMGK-9w7qF-jQ8WB", ErrChecksumMismatch},
+		{"value too large", "CSGO-zzzzz-zzzzz-zzzzz-zzzzz-zzzzz", ErrInvalidLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.code); !errors.Is(err, tt.want) {
+				t.Errorf("Decode(%q) returned %v, want %v", tt.code, err, tt.want)
+			}
+			if IsValid(tt.code) {
+				t.Errorf("IsValid(%q) = true", tt.code)
+			}
+		})
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	codes := []string{
+		"CSGO-O4Jsi-V36wY-rTMGK-9w7qF-jQ8WB",
+		"CSGO-6G2cS-WzcxT-fH3dp-Rf7oq-X9oJN",
+		"CSGO-ejaUm-2nJUY-Od9yh-eHhGU-sPZfE",
+	}
+
+	for _, code := range codes {
+		settings, err := Decode(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		encoded, err := Encode(settings)
+		if err != nil {
+			t.Fatalf("Encode of %s: %s", code, err)
+		}
+		if encoded != code {
+			t.Errorf("Encode(Decode(%q)) = %q", code, encoded)
+		}
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(s *Settings)
+	}{
+		{"style", func(s *Settings) { s.Style = 6 }},
+		{"red", func(s *Settings) { s.Red = 256 }},
+		{"size", func(s *Settings) { s.Size = 819.2 }},
+		{"gap", func(s *Settings) { s.Gap = -12.9 }},
+		{"split alpha", func(s *Settings) { s.InnerSplitAlpha = 1.1 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := DefaultSettings()
+			tt.modify(settings)
+			if _, err := Encode(settings); err == nil {
+				t.Error("Encode accepted invalid settings")
+			}
+		})
+	}
+}
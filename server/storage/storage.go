@@ -2,6 +2,7 @@ package storage
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -19,9 +20,13 @@ import (
 
 const (
 	userPPBucketName     = "profiles"
+	crosshairsBucketName = "crosshairs"
 	allowedFileExtension = "png"
 )
 
+// Returned if there is no object for the user (e.g. no avatar uploaded).
+var ErrObjectNotFound = errors.New("no matching object found")
+
 type Service struct {
 	client *minio.Client
 }
@@ -121,17 +126,25 @@ func (s *Service) CheckMinioVersion() (string, error) {
 }
 
 func (s *Service) CreateUserProfilePicturesBucket() error {
+	return s.createPublicReadBucket(userPPBucketName)
+}
+
+func (s *Service) CreateCrosshairPreviewsBucket() error {
+	return s.createPublicReadBucket(crosshairsBucketName)
+}
+
+func (s *Service) createPublicReadBucket(bucketName string) error {
 	if !s.CheckMinioConnection() {
 		return errors.New("minio client not online")
 	}
 
-	userPPBucketExists, err := s.client.BucketExists(context.Background(), userPPBucketName)
+	bucketExists, err := s.client.BucketExists(context.Background(), bucketName)
 	if err != nil {
 		return err
 	}
 
-	if !userPPBucketExists {
-		if err := s.client.MakeBucket(context.Background(), userPPBucketName, minio.MakeBucketOptions{
+	if !bucketExists {
+		if err := s.client.MakeBucket(context.Background(), bucketName, minio.MakeBucketOptions{
 			Region:        "eu-west-1",
 			ObjectLocking: false,
 		}); err != nil {
@@ -141,10 +154,10 @@ func (s *Service) CreateUserProfilePicturesBucket() error {
 
 	readOnlyPolicy := `{"Version":"2012-10-17",
 	"Statement":[{"Effect":"Allow","Principal":{"AWS":["*"]},"Action":["s3:GetBucketLocation"],
-	"Resource":["arn:aws:s3:::` + userPPBucketName + `"]},
-	{"Effect":"Allow","Principal":{"AWS":["*"]},"Action":["s3:GetObject"],"Resource":["arn:aws:s3:::` + userPPBucketName + `/*"]}]}`
+	"Resource":["arn:aws:s3:::` + bucketName + `"]},
+	{"Effect":"Allow","Principal":{"AWS":["*"]},"Action":["s3:GetObject"],"Resource":["arn:aws:s3:::` + bucketName + `/*"]}]}`
 
-	return s.client.SetBucketPolicy(context.Background(), userPPBucketName, readOnlyPolicy)
+	return s.client.SetBucketPolicy(context.Background(), bucketName, readOnlyPolicy)
 }
 
 func (s *Service) UpdateUserProfilePicture(fileName, filePath string) error {
@@ -174,7 +187,30 @@ func (s *Service) GetUserProfilePictureLink(userID string) (string, error) {
 		}
 	}
 
-	return "", errors.New("no matching object found")
+	return "", ErrObjectNotFound
+}
+
+// Returns the uploaded avatar of the user as PNG.
+func (s *Service) GetUserProfilePicture(userID string) ([]byte, error) {
+	if !s.CheckMinioConnection() {
+		return nil, errors.New("minio client not online")
+	}
+
+	object, err := s.client.GetObject(context.Background(), userPPBucketName, fmt.Sprintf("%s.png", userID), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	return data, nil
 }
 
 func (s *Service) DeleteUserProfilePicture(userID string) error {
@@ -195,7 +231,35 @@ func (s *Service) DeleteUserProfilePicture(userID string) error {
 		}
 	}
 
-	return errors.New("no matching object found")
+	return ErrObjectNotFound
+}
+
+// Uploads a rendered crosshair preview and returns its public link.
+//
+// Previews are named after the share code, so crosshairs with the same code share one object.
+func (s *Service) UploadCrosshairPreview(code string, data []byte) (string, error) {
+	if !s.CheckMinioConnection() {
+		return "", errors.New("minio client not online")
+	}
+
+	objectName := fmt.Sprintf("%s.png", code)
+
+	_, err := s.client.StatObject(context.Background(), crosshairsBucketName, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+			return "", err
+		}
+
+		_, err = s.client.PutObject(context.Background(), crosshairsBucketName, objectName, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+			ContentType:     "image/png",
+			ContentLanguage: "en-US",
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%s/%s/%s", s.client.EndpointURL().String(), crosshairsBucketName, objectName), nil
 }
 
 func CheckFileValid(file *multipart.FileHeader) error {
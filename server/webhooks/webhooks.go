@@ -0,0 +1,314 @@
+// Package webhooks POSTs events to the webhooks configured by admins.
+//
+// Deliveries are queued in the database together with their event (see database.Service.AddEvent)
+// so they survive restarts. Workers claim due deliveries, send them signed with the secret of
+// the webhook and retry failed ones with an exponential backoff until they run out of attempts.
+// Every delivery is kept with the result of its last attempt as delivery log.
+//
+// Receivers verify a delivery by computing the HMAC-SHA256 of "<timestamp>.<body>" with the
+// secret and comparing it to the signature header, see Sign and Verify.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devusSs/crosshairs/database"
+	"github.com/devusSs/crosshairs/logging"
+	"github.com/google/uuid"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	// "sha256=" followed by the hex encoded HMAC.
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	MaxAttempts    = 8
+	baseRetryDelay = 30 * time.Second
+	maxRetryDelay  = 6 * time.Hour
+
+	// Maximum runtime of a single attempt, the claim lease needs to be longer.
+	requestTimeout = 10 * time.Second
+	claimLease     = 2 * time.Minute
+	claimBatchSize = 20
+
+	// How often workers look for due deliveries.
+	pollInterval = 5 * time.Second
+
+	// Only the start of responses is logged.
+	maxResponseBody = 1024
+
+	// Random bytes of a secret, hex encoded it is twice as long.
+	secretSize = 32
+)
+
+var ErrWebhookDisabled = errors.New("webhook is disabled")
+
+type Service struct {
+	db     database.Service
+	client *http.Client
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewService returns a service sending deliveries with the client, nil uses a client with a request timeout.
+func NewService(db database.Service, client *http.Client) *Service {
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+
+	return &Service{
+		db:     db,
+		client: client,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start launches the workers, they run until Stop is called.
+func (s *Service) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+}
+
+// Stop waits for the running deliveries to finish.
+func (s *Service) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *Service) work() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		// Keep going while there are full batches, deliveries may pile up after downtime.
+		for {
+			delivered, err := s.DeliverDue(context.Background())
+			if err != nil {
+				log.Printf("%s Error delivering webhooks: %s\n", logging.ErrSign, err.Error())
+			}
+			if err != nil || delivered < claimBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// DeliverDue sends one batch of due deliveries and returns how many were attempted.
+func (s *Service) DeliverDue(ctx context.Context) (int, error) {
+	deliveries, err := s.db.ClaimWebhookDeliveries(claimBatchSize, claimLease)
+	if err != nil {
+		return 0, err
+	}
+
+	// Deliveries of a batch often go to the same webhooks.
+	webhooks := make(map[uuid.UUID]*database.Webhook)
+
+	for _, delivery := range deliveries {
+		webhook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			webhook, err = s.db.GetWebhookByID(delivery.WebhookID)
+			if err != nil {
+				if !database.IsNotFoundError(err) {
+					return 0, err
+				}
+				webhook = nil
+			}
+			webhooks[delivery.WebhookID] = webhook
+		}
+
+		switch {
+		case webhook == nil:
+			s.fail(delivery, "webhook does not exist anymore")
+		case !webhook.Enabled:
+			s.fail(delivery, ErrWebhookDisabled.Error())
+		default:
+			s.attempt(ctx, webhook, delivery, true)
+		}
+
+		if err := s.db.UpdateWebhookDelivery(delivery); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+// Test sends a ping to the webhook right away and returns the logged delivery, it is not retried.
+//
+// Disabled webhooks are tested as well so they can be checked before enabling them.
+func (s *Service) Test(ctx context.Context, webhook *database.Webhook) (*database.WebhookDelivery, error) {
+	body, err := json.Marshal(database.WebhookPayload{
+		ID:        uuid.New(),
+		Type:      database.WebhookPing,
+		Severity:  database.SeverityInfo,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := &database.WebhookDelivery{
+		// Set here, the ID is sent before the delivery is stored.
+		ID:            uuid.New(),
+		WebhookID:     webhook.ID,
+		EventType:     database.WebhookPing,
+		Payload:       body,
+		Status:        database.DeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+
+	s.attempt(ctx, webhook, delivery, false)
+
+	return s.db.AddWebhookDelivery(delivery)
+}
+
+// Sends the delivery once and records the result on it, failed deliveries are rescheduled if retry is set.
+func (s *Service) attempt(ctx context.Context, webhook *database.Webhook, delivery *database.WebhookDelivery, retry bool) {
+	now := time.Now()
+
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = 0
+	delivery.ResponseBody = ""
+	delivery.Error = ""
+
+	status, body, err := s.send(ctx, webhook, delivery)
+
+	delivery.DurationMS = time.Since(now).Milliseconds()
+	delivery.ResponseStatus = status
+	delivery.ResponseBody = body
+
+	if err == nil && status >= 200 && status < 300 {
+		delivered := time.Now()
+		delivery.Status = database.DeliverySucceeded
+		delivery.DeliveredAt = &delivered
+		return
+	}
+
+	if err != nil {
+		delivery.Error = err.Error()
+	} else {
+		delivery.Error = fmt.Sprintf("unexpected status code %d", status)
+	}
+
+	if !retry || delivery.Attempts >= MaxAttempts {
+		delivery.Status = database.DeliveryFailed
+		return
+	}
+
+	delivery.Status = database.DeliveryPending
+	delivery.NextAttemptAt = time.Now().Add(RetryDelay(delivery.Attempts))
+}
+
+func (s *Service) fail(delivery *database.WebhookDelivery, reason string) {
+	delivery.Status = database.DeliveryFailed
+	delivery.Error = reason
+}
+
+// Returns status code and start of the body of the response.
+func (s *Service) send(ctx context.Context, webhook *database.Webhook, delivery *database.WebhookDelivery) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+
+	timestamp := time.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "csgo-crosshairs-webhooks")
+	req.Header.Set(HeaderEvent, string(delivery.EventType))
+	req.Header.Set(HeaderDelivery, delivery.ID.String())
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, delivery.Payload))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseBody))
+	if err != nil {
+		return res.StatusCode, "", err
+	}
+
+	return res.StatusCode, string(body), nil
+}
+
+// RetryDelay returns how long to wait after the given number of failed attempts, 30s, 1m, 2m, ... up to 6h.
+func RetryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		return baseRetryDelay
+	}
+
+	delay := baseRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// GenerateSecret returns a new random hex encoded secret to sign deliveries with.
+func GenerateSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// Sign returns the value of the signature header for the body sent at timestamp (unix seconds).
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the signature header matches the timestamp header and body, for receivers.
+func Verify(secret, timestamp, signature string, body []byte) bool {
+	parsed, err := strconv.ParseInt(strings.TrimSpace(timestamp), 10, 64)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, parsed, body)), []byte(signature))
+}
@@ -0,0 +1,250 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devusSs/crosshairs/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Only implements what DeliverDue uses, other calls panic.
+type fakeDB struct {
+	database.Service
+
+	mu         sync.Mutex
+	webhooks   map[uuid.UUID]*database.Webhook
+	deliveries []*database.WebhookDelivery
+	updated    []*database.WebhookDelivery
+}
+
+func (f *fakeDB) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]*database.WebhookDelivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var claimed []*database.WebhookDelivery
+	for _, delivery := range f.deliveries {
+		if len(claimed) == limit {
+			break
+		}
+		if delivery.Status == database.DeliveryPending && !delivery.NextAttemptAt.After(time.Now()) {
+			claimed = append(claimed, delivery)
+		}
+	}
+	return claimed, nil
+}
+
+func (f *fakeDB) GetWebhookByID(id uuid.UUID) (*database.Webhook, error) {
+	webhook, ok := f.webhooks[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return webhook, nil
+}
+
+func (f *fakeDB) UpdateWebhookDelivery(delivery *database.WebhookDelivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updated = append(f.updated, delivery)
+	return nil
+}
+
+func newDelivery(webhookID uuid.UUID, attempts int) *database.WebhookDelivery {
+	return &database.WebhookDelivery{
+		ID:            uuid.New(),
+		WebhookID:     webhookID,
+		EventType:     database.WebhookPing,
+		Payload:       []byte(`{"type":"ping"}`),
+		Status:        database.DeliveryPending,
+		Attempts:      attempts,
+		NextAttemptAt: time.Now().Add(-time.Second),
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"type":"ping"}`)
+	timestamp := time.Now().Unix()
+	signature := Sign("secret", timestamp, body)
+
+	if !Verify("secret", strconv.FormatInt(timestamp, 10), signature, body) {
+		t.Fatal("valid signature was rejected")
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      []byte
+	}{
+		{"wrong secret", "other", strconv.FormatInt(timestamp, 10), signature, body},
+		{"wrong timestamp", "secret", strconv.FormatInt(timestamp+1, 10), signature, body},
+		{"invalid timestamp", "secret", "now", signature, body},
+		{"changed body", "secret", strconv.FormatInt(timestamp, 10), signature, []byte(`{"type":"pong"}`)},
+		{"missing prefix", "secret", strconv.FormatInt(timestamp, 10), signature[len("sha256="):], body},
+	}
+
+	for _, test := range tests {
+		if Verify(test.secret, test.timestamp, test.signature, test.body) {
+			t.Errorf("%s: invalid signature was accepted", test.name)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	first, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(first) != secretSize*2 {
+		t.Errorf("secret has length %d, want %d", len(first), secretSize*2)
+	}
+	if first == second {
+		t.Error("secrets are not random")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{8, 64 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, maxRetryDelay},
+		{100, maxRetryDelay},
+	}
+
+	for _, test := range tests {
+		if got := RetryDelay(test.attempts); got != test.want {
+			t.Errorf("RetryDelay(%d) = %s, want %s", test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestDeliverDue(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []*http.Request
+	)
+
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !Verify("secret", r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		received = append(received, r)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ok.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte("upstream down"))
+	}))
+	defer broken.Close()
+
+	okHook := &database.Webhook{ID: uuid.New(), URL: ok.URL, Secret: "secret", Enabled: true}
+	brokenHook := &database.Webhook{ID: uuid.New(), URL: broken.URL, Secret: "secret", Enabled: true}
+
+	succeeding := newDelivery(okHook.ID, 0)
+	retried := newDelivery(brokenHook.ID, 2)
+	exhausted := newDelivery(brokenHook.ID, MaxAttempts-1)
+
+	db := &fakeDB{
+		webhooks: map[uuid.UUID]*database.Webhook{
+			okHook.ID:     okHook,
+			brokenHook.ID: brokenHook,
+		},
+		deliveries: []*database.WebhookDelivery{succeeding, retried, exhausted},
+	}
+
+	delivered, err := NewService(db, ok.Client()).DeliverDue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered != 3 {
+		t.Fatalf("delivered %d deliveries, want 3", delivered)
+	}
+	if len(db.updated) != 3 {
+		t.Fatalf("updated %d deliveries, want 3", len(db.updated))
+	}
+
+	if succeeding.Status != database.DeliverySucceeded || succeeding.DeliveredAt == nil {
+		t.Errorf("delivery to working webhook has status %s", succeeding.Status)
+	}
+	if succeeding.Attempts != 1 || succeeding.ResponseStatus != http.StatusNoContent {
+		t.Errorf("delivery to working webhook has %d attempts and status code %d", succeeding.Attempts, succeeding.ResponseStatus)
+	}
+	if len(received) != 1 || received[0].Header.Get(HeaderDelivery) != succeeding.ID.String() {
+		t.Errorf("working webhook received %d signed deliveries", len(received))
+	}
+
+	if retried.Status != database.DeliveryPending || retried.Attempts != 3 {
+		t.Errorf("failed delivery has status %s after %d attempts, want pending", retried.Status, retried.Attempts)
+	}
+	if retried.ResponseStatus != http.StatusBadGateway || retried.ResponseBody != "upstream down" || retried.Error == "" {
+		t.Errorf("failed delivery did not log the response: %d %q %q", retried.ResponseStatus, retried.ResponseBody, retried.Error)
+	}
+	if wait := time.Until(retried.NextAttemptAt); wait < RetryDelay(3)-time.Minute || wait > RetryDelay(3) {
+		t.Errorf("failed delivery rescheduled in %s, want %s", wait, RetryDelay(3))
+	}
+
+	if exhausted.Status != database.DeliveryFailed || exhausted.Attempts != MaxAttempts {
+		t.Errorf("last attempt has status %s after %d attempts, want failed", exhausted.Status, exhausted.Attempts)
+	}
+
+	// Nothing is due anymore, the rescheduled delivery waits for its retry.
+	db.updated = nil
+	delivered, err = NewService(db, ok.Client()).DeliverDue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered != 0 {
+		t.Errorf("delivered %d deliveries which are not due", delivered)
+	}
+}
+
+func TestDeliverDueMissingOrDisabledWebhook(t *testing.T) {
+	disabled := &database.Webhook{ID: uuid.New(), URL: "http://127.0.0.1:1", Secret: "secret"}
+
+	missing := newDelivery(uuid.New(), 0)
+	skipped := newDelivery(disabled.ID, 0)
+
+	db := &fakeDB{
+		webhooks:   map[uuid.UUID]*database.Webhook{disabled.ID: disabled},
+		deliveries: []*database.WebhookDelivery{missing, skipped},
+	}
+
+	if _, err := NewService(db, nil).DeliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, delivery := range []*database.WebhookDelivery{missing, skipped} {
+		if delivery.Status != database.DeliveryFailed || delivery.Attempts != 0 {
+			t.Errorf("delivery has status %s after %d attempts, want failed without attempt", delivery.Status, delivery.Attempts)
+		}
+	}
+	if skipped.Error != ErrWebhookDisabled.Error() {
+		t.Errorf("delivery to disabled webhook failed with %q", skipped.Error)
+	}
+}